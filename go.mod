@@ -3,8 +3,12 @@ module github.com/lox/deep-analysis-mcp
 go 1.25.1
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.10.2
 	github.com/mark3labs/mcp-go v0.41.1
 	github.com/openai/openai-go v1.12.0
+	github.com/santhosh-tekuri/jsonschema/v6 v6.0.2
+	golang.org/x/text v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -20,5 +24,4 @@ require (
 	github.com/tidwall/sjson v1.2.5 // indirect
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// handleListArguments are the deep-analysis arguments holding lists of
+// strings. mcp-go's GetStringSlice quietly drops entries that aren't strings
+// and ignores a bare string in place of an array, so they are checked before
+// anything is read rather than silently left out of the prompt.
+var handleListArguments = []string{"files", "focus_files", "changed_files", "docs", "compare_models"}
+
+// checkStringLists validates that each named argument, when present, is an
+// array of non-empty strings, naming the argument and entry that is wrong.
+// Null stands for an omitted argument.
+func checkStringLists(request mcp.CallToolRequest, names []string) error {
+	args := request.GetArguments()
+	for _, name := range names {
+		value, ok := args[name]
+		if !ok || value == nil {
+			continue
+		}
+		var items []any
+		switch list := value.(type) {
+		case []any:
+			items = list
+		case []string:
+			for _, item := range list {
+				items = append(items, item)
+			}
+		case string:
+			return fmt.Errorf("invalid argument %s: expected an array of strings, got a string (wrap it in an array: [%q])", name, list)
+		default:
+			return fmt.Errorf("invalid argument %s: expected an array of strings, got %s", name, jsonType(value))
+		}
+		for i, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("invalid argument %s[%d]: expected a string, got %s", name, i, jsonType(item))
+			}
+			if strings.TrimSpace(s) == "" {
+				return fmt.Errorf("invalid argument %s[%d]: empty string", name, i)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonType names the JSON type of a decoded value for error messages
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64, int, int64:
+		return "a number"
+	case string:
+		return "a string"
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
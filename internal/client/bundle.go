@@ -0,0 +1,134 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const maxBundleToolOutput = 16 * 1024 // Truncate tool outputs saved in bundles
+
+// unsafeFileChars matches characters not allowed in bundle file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// bundle is a reproducible record of a single analysis
+type bundle struct {
+	ConversationID     string           `json:"conversation_id"`
+	Started            time.Time        `json:"started"`
+	Finished           time.Time        `json:"finished"`
+	Model              string           `json:"model"`
+	Settings           bundleSettings   `json:"settings"`
+	Instructions       string           `json:"instructions"`
+	Prompt             string           `json:"prompt"`
+	PreviousResponseID string           `json:"previous_response_id,omitempty"`
+	ToolCalls          []bundleToolCall `json:"tool_calls"`
+	Usage              bundleUsage      `json:"usage"`
+	Answer             string           `json:"answer"`
+	IsError            bool             `json:"is_error"`
+}
+
+// bundleSettings are the effective settings an analysis ran with
+type bundleSettings struct {
+	ReasoningBudget int64  `json:"reasoning_budget"`
+	MaxIterations   int    `json:"max_iterations"`
+	MaxToolCalls    int    `json:"max_tool_calls"`
+	MaxDuration     string `json:"max_duration"`
+	Continue        bool   `json:"continue"`
+	Ephemeral       bool   `json:"ephemeral"`
+	PlanOnly        bool   `json:"plan_only"`
+	TruncateHistory bool   `json:"truncate_history"`
+}
+
+// bundleToolCall is one tool call and its (possibly truncated) output
+type bundleToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Output    string          `json:"output"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// bundleUsage is the token usage of an analysis
+type bundleUsage struct {
+	Input     int64 `json:"input_tokens"`
+	Output    int64 `json:"output_tokens"`
+	Reasoning int64 `json:"reasoning_tokens"`
+}
+
+// newBundle starts recording an analysis, or returns nil when bundles are disabled
+func (c *DeepAnalysisClient) newBundle(a analysis) *bundle {
+	if c.bundleDir == "" {
+		return nil
+	}
+	started := a.started
+	if started.IsZero() {
+		started = time.Now()
+	}
+	return &bundle{
+		ConversationID: a.conversationID,
+		Started:        started,
+		Model:          c.modelName(a),
+		Settings: bundleSettings{
+			ReasoningBudget: a.budget,
+			MaxIterations:   c.maxIterations,
+			MaxToolCalls:    c.maxToolCalls,
+			MaxDuration:     c.maxDuration.String(),
+			Continue:        a.continueConversation,
+			Ephemeral:       a.ephemeral,
+			PlanOnly:        a.planOnly,
+			TruncateHistory: a.truncateHistory,
+		},
+		Instructions: c.systemPrompt,
+		Prompt:       a.prompt,
+	}
+}
+
+// addToolCall records a tool call; it is a no-op on a nil bundle
+func (b *bundle) addToolCall(name, args, output string) {
+	if b == nil {
+		return
+	}
+	call := bundleToolCall{Name: name, Arguments: json.RawMessage(args), Output: output}
+	if !json.Valid(call.Arguments) {
+		call.Arguments, _ = json.Marshal(args)
+	}
+	if len(output) > maxBundleToolOutput {
+		call.Output, call.Truncated = output[:maxBundleToolOutput], true
+	}
+	b.ToolCalls = append(b.ToolCalls, call)
+}
+
+// save writes the bundle with the final result to dir, named by conversation
+// ID and start time. Failures are logged and never fail the analysis.
+func (b *bundle) save(dir string, result *mcp.CallToolResult, used usage) {
+	if b == nil || result == nil {
+		return
+	}
+	b.Finished = time.Now()
+	b.Usage = bundleUsage{Input: used.input, Output: used.output, Reasoning: used.reasoning}
+	b.Answer = resultText(result)
+	b.IsError = result.IsError
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		logging.Errorf("Failed to encode analysis bundle: %v", err)
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		logging.Errorf("Failed to create bundle directory: %v", err)
+		return
+	}
+	name := fmt.Sprintf("%s-%s.json", unsafeFileChars.ReplaceAllString(b.ConversationID, "_"), b.Started.UTC().Format("20060102T150405.000Z"))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		logging.Errorf("Failed to write analysis bundle: %v", err)
+		return
+	}
+	log.Printf("Saved analysis bundle: %s", path)
+}
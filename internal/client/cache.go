@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// cachedTools maps tools whose results depend only on their arguments and the
+// files they touch to the argument naming those files
+var cachedTools = map[string]string{
+	"read_file":    "path",
+	"grep_in_file": "path",
+	"grep_files":   "path",
+	"glob_files":   "pattern",
+}
+
+// toolCache holds tool results for a single request, keyed by tool and
+// arguments and validated against the fingerprint of the files involved
+type toolCache struct {
+	entries map[string]cacheEntry
+	hits    int
+}
+
+// cacheEntry is a cached tool result and the file fingerprint it was computed from
+type cacheEntry struct {
+	fingerprint string
+	result      string
+}
+
+// newToolCache creates an empty per-request cache
+func newToolCache() *toolCache {
+	return &toolCache{entries: make(map[string]cacheEntry)}
+}
+
+// executeCached runs a tool call, serving repeated calls from cache while the
+// files they depend on are unchanged
+func (c *DeepAnalysisClient) executeCached(ctx context.Context, cache *toolCache, name, argsJSON string) (string, error) {
+	argName, ok := cachedTools[name]
+	if !ok {
+		return c.executeFunction(ctx, name, argsJSON)
+	}
+
+	var args map[string]any
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return c.executeFunction(ctx, name, argsJSON)
+	}
+	target, _ := args[argName].(string)
+	if target == "" {
+		return c.executeFunction(ctx, name, argsJSON)
+	}
+	// Re-marshal so equivalent arguments share a key regardless of field order
+	canonical, err := json.Marshal(args)
+	if err != nil {
+		return c.executeFunction(ctx, name, argsJSON)
+	}
+	key := name + ":" + string(canonical)
+
+	// A recursive grep_files depends on every file below the directories it matches
+	recursive, _ := args["recursive"].(bool)
+	fingerprint, err := c.fileOps.Fingerprint(ctx, target, recursive)
+	if err != nil {
+		return c.executeFunction(ctx, name, argsJSON)
+	}
+	if entry, ok := cache.entries[key]; ok && entry.fingerprint == fingerprint {
+		cache.hits++
+		log.Printf("Tool result served from cache: name=%s hits=%d", name, cache.hits)
+		return entry.result, nil
+	}
+
+	result, err := c.executeFunction(ctx, name, argsJSON)
+	if err == nil {
+		cache.entries[key] = cacheEntry{fingerprint: fingerprint, result: result}
+	}
+	return result, err
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	minCompareModels = 2
+	maxCompareModels = 3
+
+	// defaultCompareBudget bounds the output tokens of a comparison when the
+	// request sets no reasoning budget, so running several models is never unbounded
+	defaultCompareBudget = 128000
+)
+
+// WithCompareModels sets the models the compare_models argument may select.
+// Empty disables model comparison.
+func WithCompareModels(models []string) Option {
+	return func(c *DeepAnalysisClient) {
+		c.compareModels = models
+	}
+}
+
+// checkCompareModels validates the models requested for a comparison
+func (c *DeepAnalysisClient) checkCompareModels(models []string) error {
+	if len(c.compareModels) == 0 {
+		return fmt.Errorf("model comparison is disabled; start the server with -compare-models")
+	}
+	if len(models) < minCompareModels || len(models) > maxCompareModels {
+		return fmt.Errorf("compare_models takes %d to %d models, got %d", minCompareModels, maxCompareModels, len(models))
+	}
+	for i, model := range models {
+		if !slices.Contains(c.compareModels, model) {
+			return fmt.Errorf("model %q is not available for comparison; choose from: %s", model, strings.Join(c.compareModels, ", "))
+		}
+		if slices.Contains(models[:i], model) {
+			return fmt.Errorf("model %q is listed twice in compare_models", model)
+		}
+	}
+	return nil
+}
+
+// compareBudget splits a comparison's total output token budget evenly across
+// its calls, using defaultCompareBudget when the total is unlimited. It fails
+// when the total can't give every call the minOutputTokens the API requires.
+func compareBudget(total int64, models int, synthesize bool) (int64, error) {
+	calls := int64(models)
+	if synthesize {
+		calls++
+	}
+	if total == 0 {
+		total = defaultCompareBudget
+	}
+	if total < calls*minOutputTokens {
+		return 0, fmt.Errorf("reasoning_token_budget of %d is too small for compare_models: its %d calls need at least %d tokens each", total, calls, minOutputTokens)
+	}
+	return total / calls, nil
+}
+
+// runComparison runs the same analysis against each model concurrently and
+// returns their answers side by side, with token usage per model. With
+// synthesize, a final call on the default model reconciles the answers and
+// becomes the conversation's turn; otherwise every run is ephemeral and the
+// conversation is left unchanged. Each call is limited to budget output
+// tokens, its share of the comparison's total (see compareBudget).
+func (c *DeepAnalysisClient) runComparison(ctx context.Context, a analysis, models []string, synthesize bool, budget int64) *mcp.CallToolResult {
+	log.Printf("Comparing models: %s (synthesize=%v, budget per call=%d)", strings.Join(models, ", "), synthesize, budget)
+
+	results := make([]*mcp.CallToolResult, len(models))
+	used := make([]usage, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run := a
+			run.model = model
+			run.budget = budget
+			run.ephemeral = true
+			run.used = &used[i]
+			results[i] = c.analyze(ctx, run)
+		}()
+	}
+	wg.Wait()
+
+	var sections, answers []string
+	failed := 0
+	for i, model := range models {
+		text := stripFooters(resultText(results[i]))
+		if results[i].IsError {
+			failed++
+			text = "**Failed:** " + text
+		} else {
+			answers = append(answers, fmt.Sprintf("### Answer from %s\n\n%s", model, text))
+		}
+		sections = append(sections, fmt.Sprintf("## %s\n\n%s", model, text))
+	}
+	if failed == len(models) {
+		return mcp.NewToolResultError("Every model in the comparison failed:\n\n" + strings.Join(sections, "\n\n"))
+	}
+
+	var footer []string
+	for i, model := range models {
+		footer = append(footer, usageLine(model, used[i]))
+	}
+
+	if synthesize && len(answers) > 1 {
+		final := a
+		final.prompt = compareSynthesisPrompt(a.prompt, answers)
+		final.budget = budget
+		var synthesisUsed usage
+		final.used = &synthesisUsed
+		log.Printf("Synthesizing answers from %d models", len(answers))
+		result := c.analyze(ctx, final)
+		footer = append(footer, usageLine(c.modelName(final)+" (synthesis)", synthesisUsed))
+		if result.IsError {
+			sections = append(sections, "## Synthesis\n\n**Failed:** "+resultText(result))
+		} else {
+			sections = append(sections, fmt.Sprintf("## Synthesis (%s)\n\n%s", c.modelName(final), stripFooters(resultText(result))))
+		}
+	}
+
+	header := fmt.Sprintf("# Model comparison: %s", strings.Join(models, " vs "))
+	return mcp.NewToolResultText(header + "\n\n" + strings.Join(sections, "\n\n") + "\n\n---\nUsage per model:\n- " + strings.Join(footer, "\n- "))
+}
+
+// usageLine summarizes the tokens one model used
+func usageLine(model string, used usage) string {
+	return fmt.Sprintf("%s: %d input, %d output (%d reasoning) tokens", model, used.input, used.output, used.reasoning)
+}
+
+// compareSynthesisPrompt asks for one answer reconciling several models'
+// answers to the original prompt, which is repeated with its attachments
+func compareSynthesisPrompt(prompt string, answers []string) string {
+	return fmt.Sprintf(`The request below was given to %d different models independently. Their answers follow.
+
+%s
+
+Reconcile them into a single answer to the request: state where the models agree, examine each disagreement against the code (reading files with your tools where needed) and say which position the evidence supports, and call out anything only one model noticed.
+
+The original request:
+
+%s`, len(answers), strings.Join(answers, "\n\n"), prompt)
+}
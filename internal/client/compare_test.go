@@ -0,0 +1,31 @@
+package client
+
+import "testing"
+
+func TestCompareBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      int64
+		models     int
+		synthesize bool
+		want       int64
+		wantErr    bool
+	}{
+		{name: "split across models", total: 30000, models: 3, want: 10000},
+		{name: "synthesis takes a share", total: 30000, models: 2, synthesize: true, want: 10000},
+		{name: "unlimited uses the default", total: 0, models: 2, want: defaultCompareBudget / 2},
+		{name: "exactly the minimum", total: 3 * minOutputTokens, models: 2, synthesize: true, want: minOutputTokens},
+		{name: "too small", total: 3*minOutputTokens - 1, models: 2, synthesize: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compareBudget(tt.total, tt.models, tt.synthesize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("budget = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
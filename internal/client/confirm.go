@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultConfirmationTTL = 15 * time.Minute // How long a held action waits for approval
+
+// pendingAction is a command the model asked to run, held for approval
+type pendingAction struct {
+	description string
+	run         func(ctx context.Context) (string, error)
+	expires     time.Time
+}
+
+// actionStore holds actions awaiting approval through confirm_action
+type actionStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	actions map[string]*pendingAction
+}
+
+// WithConfirmation holds every tool call that runs a command (run_command,
+// check_vulns, test_coverage, check_doc_examples, build_profile and tools
+// manifest calls) for a human to approve with the confirm_action tool instead
+// of running it. Held actions expire after ttl (15 minutes if ttl isn't
+// positive).
+func WithConfirmation(enabled bool, ttl time.Duration) Option {
+	return func(c *DeepAnalysisClient) {
+		if !enabled {
+			c.actions = nil
+			return
+		}
+		if ttl <= 0 {
+			ttl = defaultConfirmationTTL
+		}
+		c.actions = &actionStore{ttl: ttl, actions: make(map[string]*pendingAction)}
+	}
+}
+
+// runOrHold runs a tool call that executes commands, or holds it for
+// approval when confirmation is required
+func (c *DeepAnalysisClient) runOrHold(ctx context.Context, description string, run func(ctx context.Context) (string, error)) (string, error) {
+	if c.actions == nil {
+		return run(ctx)
+	}
+	return c.actions.hold(description, run)
+}
+
+// hold stores an action for approval and returns the tool result telling the
+// model it didn't run
+func (s *actionStore) hold(description string, run func(ctx context.Context) (string, error)) (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate action ID: %w", err)
+	}
+	id := "act_" + hex.EncodeToString(b[:])
+
+	s.mu.Lock()
+	s.expire()
+	s.actions[id] = &pendingAction{description: description, run: run, expires: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+
+	log.Printf("Holding action for approval: action_id=%s %s", id, description)
+	return fmt.Sprintf("Not run: this server requires a human to approve commands. Action %s (%s) is pending approval with confirm_action for the next %s.\n"+
+		"Don't retry it. Continue without its output, and list the action ID and what it would show in your answer so the user can approve it and follow up.",
+		id, description, s.ttl), nil
+}
+
+// take removes and returns an unexpired action
+func (s *actionStore) take(id string) (*pendingAction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	action, ok := s.actions[id]
+	delete(s.actions, id)
+	return action, ok
+}
+
+// expire drops actions past their deadline. Callers must hold mu.
+func (s *actionStore) expire() {
+	now := time.Now()
+	for id, action := range s.actions {
+		if now.After(action.expires) {
+			delete(s.actions, id)
+		}
+	}
+}
+
+// commandDescription renders a command and its arguments for an approver
+func commandDescription(command string, args []string) string {
+	return strings.Join(append([]string{command}, args...), " ")
+}
+
+// HandleConfirmAction runs an action held by -require-confirmation and
+// returns its output
+func (c *DeepAnalysisClient) HandleConfirmAction(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if c.actions == nil {
+		return mcp.NewToolResultError("Actions aren't held for approval on this server (start it with -require-confirmation)"), nil
+	}
+	id, err := request.RequireString("action_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	action, ok := c.actions.take(id)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("Unknown, expired or already approved action: %s", id)), nil
+	}
+
+	log.Printf("Running approved action: action_id=%s %s", id, action.description)
+	output, err := action.run(ctx)
+	if err != nil {
+		logging.Errorf("Approved action failed: action_id=%s: %v", id, err)
+		return mcp.NewToolResultError(fmt.Sprintf("Approved action %s (%s) failed: %v", id, action.description, err)), nil
+	}
+	return mcp.NewToolResultText(c.fileOps.RelativizePaths(fmt.Sprintf("Approved action %s (%s):\n\n%s", id, action.description, output))), nil
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	defaultContextTokens   = 128000 // input token limit assumed for models missing from modelContextTokens
+	defaultContextFraction = 0.9    // share of the context window a prompt may use by default
+	charsPerToken          = 4      // rough estimate for English text and code
+)
+
+// modelContextTokens holds the input token limits of known model families,
+// matched by the longest prefix of the model name
+var modelContextTokens = map[string]int64{
+	"gpt-5":         272000,
+	"gpt-4.1":       1047576,
+	"gpt-4o":        128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o1-mini":       128000,
+	"o3":            200000,
+	"o4-mini":       200000,
+}
+
+// WithContextTokens sets the context window, in input tokens, that prompts
+// are fitted to, for models whose limit isn't known or differs. Zero or less
+// looks the model up instead.
+func WithContextTokens(tokens int64) Option {
+	return func(c *DeepAnalysisClient) {
+		c.contextWindow = max(tokens, 0)
+	}
+}
+
+// modelWindow returns the input token limit of a model: -context-tokens
+// when set, else the limit of its family, else defaultContextTokens
+func (c *DeepAnalysisClient) modelWindow(model string) int64 {
+	if c.contextWindow > 0 {
+		return c.contextWindow
+	}
+	window, ok := knownContextWindow(model)
+	if !ok {
+		return defaultContextTokens
+	}
+	return window
+}
+
+// knownContextWindow looks up a model's input token limit by the longest
+// matching family prefix
+func knownContextWindow(model string) (int64, bool) {
+	best := ""
+	for prefix := range modelContextTokens {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+	return modelContextTokens[best], true
+}
+
+// contextLimit returns the tokens a prompt to model may use
+func (c *DeepAnalysisClient) contextLimit(model string) int64 {
+	return int64(c.contextFraction * float64(c.modelWindow(model)))
+}
+
+// Context overflow policies
+const (
+	OverflowError = "error" // fail with an actionable message
+	OverflowTrim  = "trim"  // let the API drop the oldest conversation context
+	OverflowDrop  = "drop"  // drop the largest attachments until the prompt fits
+
+	OverflowMapReduce = "mapreduce" // analyze attachments in groups that fit, then synthesize
+)
+
+// estimateTokens roughly estimates the tokens in text
+func estimateTokens(text string) int64 {
+	return int64(len(text)+charsPerToken-1) / charsPerToken
+}
+
+// fitContext estimates the tokens a request will send (system prompt,
+// conversation history and the new prompt built from parts) and applies the
+// overflow policy when they exceed the configured share of the context window.
+// It returns the attachments to send, whether older history may be truncated,
+// and a warning describing anything that was changed.
+func (c *DeepAnalysisClient) fitContext(history int64, files, parts []string, build func([]string) string) ([]string, bool, string, error) {
+	limit := c.contextLimit(c.model)
+	system := estimateTokens(c.systemPrompt)
+	prompt := estimateTokens(build(parts))
+	if system+history+prompt <= limit {
+		return parts, false, "", nil
+	}
+	logging.Warnf("Estimated prompt exceeds context limit: history=%d prompt=%d limit=%d policy=%s", history, prompt, limit, c.contextOverflow)
+
+	switch c.contextOverflow {
+	case OverflowTrim:
+		if history > 0 && system+prompt <= limit {
+			return parts, true, fmt.Sprintf("The conversation history (~%d tokens) no longer fits in the context window; the oldest context may have been dropped.", history), nil
+		}
+
+	case OverflowDrop:
+		// Replace the largest attachments with a note until the prompt fits
+		kept := append([]string(nil), parts...)
+		var dropped []string
+		for _, i := range largestFirst(parts) {
+			if system+history+estimateTokens(build(kept)) <= limit {
+				break
+			}
+			kept[i] = formatOmittedAttachment(files[i], estimateTokens(parts[i]))
+			dropped = append(dropped, files[i])
+		}
+		if system+history+estimateTokens(build(kept)) <= limit {
+			return kept, false, fmt.Sprintf("%d attached files were dropped to fit the context window: %s", len(dropped), strings.Join(dropped, ", ")), nil
+		}
+
+	case OverflowMapReduce:
+		// Splitting only helps when there are attachments to spread across passes
+		if len(parts) > 1 && system+estimateTokens(build(nil)) <= limit {
+			return parts, false, "", errSplitAttachments
+		}
+	}
+
+	return nil, false, "", overflowError(system, history, prompt, limit, c.modelWindow(c.model), files, parts)
+}
+
+// overflowError explains why a prompt won't fit and how to make it fit
+func overflowError(system, history, prompt, limit, window int64, files, parts []string) error {
+	msg := fmt.Sprintf("Estimated input of ~%d tokens exceeds the limit of %d (%d token context window): system prompt ~%d, conversation history ~%d, new prompt ~%d.",
+		system+history+prompt, limit, window, system, history, prompt)
+
+	if len(parts) > 0 {
+		order := largestFirst(parts)
+		var largest []string
+		for _, i := range order[:min(len(order), 3)] {
+			largest = append(largest, fmt.Sprintf("%s (~%d tokens)", files[i], estimateTokens(parts[i])))
+		}
+		msg += " Largest attachments: " + strings.Join(largest, ", ") + "."
+	}
+
+	var fixes []string
+	if len(parts) > 0 {
+		fixes = append(fixes, "attach fewer or smaller files and let the analysis read what it needs")
+	}
+	if history > 0 {
+		fixes = append(fixes, "start a fresh conversation with continue=false")
+	}
+	fixes = append(fixes, "or restart the server with -context-overflow=trim, drop or mapreduce")
+	return fmt.Errorf("%s To fix: %s", msg, strings.Join(fixes, "; "))
+}
+
+// formatOmittedAttachment records an attachment dropped to fit the context window
+func formatOmittedAttachment(path string, tokens int64) string {
+	return fmt.Sprintf("File: %s\n%s\n", path, truncate.Marker("too large for the context window", fmt.Sprintf("all ~%d tokens", tokens), "Use grep_in_file or read_file to inspect it."))
+}
+
+// largestFirst returns the indices of parts ordered by size, largest first
+func largestFirst(parts []string) []int {
+	order := make([]int, len(parts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return len(parts[order[i]]) > len(parts[order[j]]) })
+	return order
+}
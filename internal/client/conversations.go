@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/server"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultConversationID is used when a request doesn't name a conversation
+const defaultConversationID = "default"
+
+// conversation is the server-side state of a multi-turn conversation
+type conversation struct {
+	responseID string
+	turns      int
+	usage      usage
+	context    int64      // estimated tokens of history carried into the next turn
+	planPaused bool       // the last turn returned a plan awaiting approval
+	budget     int64      // reasoning budget of the last turn
+	scratch    scratchpad // notes the model kept with scratch_write
+	created    time.Time
+	lastUsed   time.Time
+}
+
+// conversationKey returns the state key for a requested conversation ID,
+// prefixed with the request's transport when conversations aren't shared.
+// An empty ID stays empty.
+func (c *DeepAnalysisClient) conversationKey(ctx context.Context, conversationID string) string {
+	if c.shareConv || conversationID == "" {
+		return conversationID
+	}
+	if transport := server.TransportFromContext(ctx); transport != "" {
+		return transport + ":" + conversationID
+	}
+	return conversationID
+}
+
+// conversationShards is the number of independently locked partitions of the
+// conversation store, so requests for unrelated conversations don't contend
+const conversationShards = 32
+
+// conversationShard is one partition of the conversation store
+type conversationShard struct {
+	mu   sync.RWMutex
+	conv map[string]*conversation // conversation_id -> state
+}
+
+// conversationStore holds conversation state, sharded by a hash of the
+// conversation ID, optionally written through to a persistent store
+type conversationStore struct {
+	shards  [conversationShards]conversationShard
+	backing ConversationStore // nil keeps conversations in memory only
+}
+
+// newConversationStore creates an empty conversation store
+func newConversationStore() *conversationStore {
+	s := &conversationStore{}
+	for i := range s.shards {
+		s.shards[i].conv = make(map[string]*conversation)
+	}
+	return s
+}
+
+// update applies fn to the shard holding conversationID under its lock, then
+// saves the conversation if fn reports a turn boundary. Saving only at turn
+// boundaries (a turn recorded or a conversation cleared or paused) keeps the
+// per-iteration updates in memory; the turn's end saves them all at once.
+func (s *conversationStore) update(conversationID string, fn func(sh *conversationShard) bool) {
+	sh := s.shard(conversationID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if fn(sh) {
+		s.persist(sh, conversationID)
+	}
+}
+
+// shard returns the partition holding conversationID
+func (s *conversationStore) shard(conversationID string) *conversationShard {
+	// FNV-1a, inline so the lookup doesn't allocate
+	h := uint32(2166136261)
+	for i := 0; i < len(conversationID); i++ {
+		h ^= uint32(conversationID[i])
+		h *= 16777619
+	}
+	return &s.shards[h%conversationShards]
+}
+
+// conversation returns the state for conversationID, creating it if needed. Callers must hold mu.
+func (sh *conversationShard) conversation(conversationID string) *conversation {
+	conv, ok := sh.conv[conversationID]
+	if !ok {
+		now := time.Now()
+		conv = &conversation{created: now, lastUsed: now}
+		sh.conv[conversationID] = conv
+	}
+	return conv
+}
+
+// conversationInfo is a copy of a conversation's scalar state, safe to read
+// without holding the shard lock
+type conversationInfo struct {
+	responseID     string
+	turns          int
+	usage          usage
+	context        int64
+	budget         int64
+	scratchEntries int
+	scratchSize    int
+	created        time.Time
+	lastUsed       time.Time
+}
+
+// snapshot safely copies a conversation's scalar state, reporting whether it
+// exists. Use scratchCopy for its notes.
+func (s *conversationStore) snapshot(conversationID string) (conversationInfo, bool) {
+	sh := s.shard(conversationID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	conv, ok := sh.conv[conversationID]
+	if !ok {
+		return conversationInfo{}, false
+	}
+	return conversationInfo{
+		responseID:     conv.responseID,
+		turns:          conv.turns,
+		usage:          conv.usage,
+		context:        conv.context,
+		budget:         conv.budget,
+		scratchEntries: len(conv.scratch.entries),
+		scratchSize:    conv.scratch.size,
+		created:        conv.created,
+		lastUsed:       conv.lastUsed,
+	}, true
+}
+
+// scratchCopy returns a private copy of a conversation's scratchpad, empty
+// if the conversation doesn't exist
+func (s *conversationStore) scratchCopy(conversationID string) scratchpad {
+	sh := s.shard(conversationID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	if conv, ok := sh.conv[conversationID]; ok {
+		return conv.scratch.clone()
+	}
+	return scratchpad{}
+}
+
+// getRespID safely retrieves a response ID for a conversation
+func (c *DeepAnalysisClient) getRespID(conversationID string) string {
+	sh := c.conv.shard(conversationID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	if conv, ok := sh.conv[conversationID]; ok {
+		return conv.responseID
+	}
+	return ""
+}
+
+// setRespID safely stores a response ID for a conversation
+func (c *DeepAnalysisClient) setRespID(conversationID, responseID string) {
+	c.conv.update(conversationID, func(sh *conversationShard) bool {
+		sh.conversation(conversationID).responseID = responseID
+		return false // saved with the turn by recordTurn
+	})
+}
+
+// clearRespID safely clears a conversation's state
+func (c *DeepAnalysisClient) clearRespID(conversationID string) {
+	c.conv.update(conversationID, func(sh *conversationShard) bool {
+		delete(sh.conv, conversationID)
+		return true
+	})
+}
+
+// recordTurn safely records a completed turn and its token usage
+func (c *DeepAnalysisClient) recordTurn(conversationID string, used usage, budget int64) {
+	c.conv.update(conversationID, func(sh *conversationShard) bool {
+		conv := sh.conversation(conversationID)
+		conv.turns++
+		conv.usage.input += used.input
+		conv.usage.output += used.output
+		conv.usage.reasoning += used.reasoning
+		if used.context > 0 {
+			conv.context = used.context
+		}
+		conv.budget = budget
+		conv.lastUsed = time.Now()
+		return true
+	})
+}
+
+// contextTokens safely returns the estimated history size of a conversation
+func (c *DeepAnalysisClient) contextTokens(conversationID string) int64 {
+	sh := c.conv.shard(conversationID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	if conv, ok := sh.conv[conversationID]; ok && conv.responseID != "" {
+		return conv.context
+	}
+	return 0
+}
+
+// setPlanPaused safely records whether a conversation is waiting for plan approval
+func (c *DeepAnalysisClient) setPlanPaused(conversationID string, paused bool) {
+	c.conv.update(conversationID, func(sh *conversationShard) bool {
+		sh.conversation(conversationID).planPaused = paused
+		return true
+	})
+}
+
+// takePlanPaused safely reports and clears a conversation's pending plan approval
+func (c *DeepAnalysisClient) takePlanPaused(conversationID string) bool {
+	var paused bool
+	c.conv.update(conversationID, func(sh *conversationShard) bool {
+		conv, ok := sh.conv[conversationID]
+		paused = ok && conv.planPaused
+		if paused {
+			conv.planPaused = false
+		}
+		return paused
+	})
+	return paused
+}
+
+// HandleDescribe reports metadata about a conversation's server-side state
+func (c *DeepAnalysisClient) HandleDescribe(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conversationID := request.GetString("conversation_id", "")
+	if conversationID == "" {
+		conversationID = defaultConversationID
+	}
+	conversationID = c.conversationKey(ctx, conversationID)
+
+	snapshot, ok := c.conv.snapshot(conversationID)
+
+	if !ok {
+		return mcp.NewToolResultText(fmt.Sprintf("Conversation %q has no server-side state; the next request will start fresh.", conversationID)), nil
+	}
+
+	log.Printf("Describing conversation: id=%s turns=%d", conversationID, snapshot.turns)
+
+	budget := "unlimited"
+	if snapshot.budget > 0 {
+		budget = fmt.Sprintf("%d tokens", snapshot.budget)
+	}
+
+	lines := []string{
+		fmt.Sprintf("Conversation: %s", conversationID),
+		fmt.Sprintf("Turns: %d", snapshot.turns),
+		fmt.Sprintf("Current response_id: %s", snapshot.responseID),
+		fmt.Sprintf("Tokens used: input=%d output=%d reasoning=%d", snapshot.usage.input, snapshot.usage.output, snapshot.usage.reasoning),
+		fmt.Sprintf("Context size: ~%d of %d tokens", snapshot.context, c.modelWindow(c.model)),
+		fmt.Sprintf("Scratchpad: %d entries, %d of %d bytes", snapshot.scratchEntries, snapshot.scratchSize, maxScratchBytes),
+		fmt.Sprintf("Model: %s", c.model),
+		fmt.Sprintf("Settings: reasoning_budget=%s max_iterations=%d", budget, c.maxIterations),
+		fmt.Sprintf("Created: %s", snapshot.created.Format(time.RFC3339)),
+		fmt.Sprintf("Last used: %s (%s ago)", snapshot.lastUsed.Format(time.RFC3339), time.Since(snapshot.lastUsed).Round(time.Second)),
+	}
+	return mcp.NewToolResultText(strings.Join(lines, "\n")), nil
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// singleLockStore is the conversation store before sharding: one RWMutex
+// over one map, kept here as the benchmark baseline
+type singleLockStore struct {
+	mu   sync.RWMutex
+	conv map[string]*conversation
+}
+
+func (s *singleLockStore) getRespID(conversationID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if conv, ok := s.conv[conversationID]; ok {
+		return conv.responseID
+	}
+	return ""
+}
+
+func (s *singleLockStore) setRespID(conversationID, responseID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conv, ok := s.conv[conversationID]
+	if !ok {
+		conv = &conversation{}
+		s.conv[conversationID] = conv
+	}
+	conv.responseID = responseID
+}
+
+// BenchmarkConversationStore runs a read-mostly mix of lookups and updates
+// across many concurrent conversations, against the sharded store and the
+// single-lock baseline. Run with -cpu to vary the parallelism.
+func BenchmarkConversationStore(b *testing.B) {
+	const conversations = 1024
+	ids := make([]string, conversations)
+	for i := range ids {
+		ids[i] = "conv-" + strconv.Itoa(i)
+	}
+
+	run := func(b *testing.B, get func(string) string, set func(string, string)) {
+		var next atomic.Uint64
+		b.RunParallel(func(pb *testing.PB) {
+			i := next.Add(1) * 7919
+			for pb.Next() {
+				id := ids[i%conversations]
+				if i%4 == 0 {
+					set(id, "resp_"+id)
+				} else {
+					get(id)
+				}
+				i++
+			}
+		})
+	}
+
+	b.Run("sharded", func(b *testing.B) {
+		c := &DeepAnalysisClient{conv: newConversationStore()}
+		run(b, c.getRespID, c.setRespID)
+	})
+	b.Run("single lock", func(b *testing.B) {
+		s := &singleLockStore{conv: make(map[string]*conversation)}
+		run(b, s.getRespID, s.setRespID)
+	})
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go/responses"
+)
+
+// WithShowUsage appends a line reporting the tokens an analysis used, and
+// its estimated cost when prices are set, to the text of its result
+func WithShowUsage(show bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.showUsage = show
+	}
+}
+
+// WithTokenPrices sets the prices, in US dollars per million tokens, used to
+// estimate what an analysis cost. Output tokens include reasoning tokens.
+// Zero prices disable the estimate.
+func WithTokenPrices(inputPerMillion, outputPerMillion float64) Option {
+	return func(c *DeepAnalysisClient) {
+		c.inputPrice = max(inputPerMillion, 0)
+		c.outputPrice = max(outputPerMillion, 0)
+	}
+}
+
+// estimatedCost returns what the tokens used cost in US dollars, and false
+// when no prices are set
+func (c *DeepAnalysisClient) estimatedCost(used usage) (float64, bool) {
+	if c.inputPrice == 0 && c.outputPrice == 0 {
+		return 0, false
+	}
+	return (float64(used.input)*c.inputPrice + float64(used.output)*c.outputPrice) / 1e6, true
+}
+
+// usageMeterKey carries a request's usageMeter in a context
+type usageMeterKey struct{}
+
+// usageMeter totals the tokens of every Responses API call made for one tool
+// request: each analysis (map-reduce passes and compared models included) and
+// each structured extraction
+type usageMeter struct {
+	mu    sync.Mutex
+	used  usage
+	calls int
+}
+
+// withUsageMeter starts metering the model calls made under ctx
+func withUsageMeter(ctx context.Context) (context.Context, *usageMeter) {
+	m := &usageMeter{}
+	return context.WithValue(ctx, usageMeterKey{}, m), m
+}
+
+// meterUsage adds tokens used under ctx to its request's meter, if any
+func meterUsage(ctx context.Context, used usage) {
+	m, ok := ctx.Value(usageMeterKey{}).(*usageMeter)
+	if !ok || used.input+used.output == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used.input += used.input
+	m.used.output += used.output
+	m.used.reasoning += used.reasoning
+	m.calls++
+}
+
+// meterResponse adds the tokens of a single response to its request's meter
+func meterResponse(ctx context.Context, response *responses.Response) {
+	var used usage
+	used.add(response)
+	meterUsage(ctx, used)
+}
+
+// reportUsage attaches the tokens a request used to its result as structured
+// metadata under _meta.usage, and with -show-usage as a footer. Requests that
+// made no model calls report nothing.
+func (c *DeepAnalysisClient) reportUsage(result *mcp.CallToolResult, m *usageMeter) {
+	m.mu.Lock()
+	used, calls := m.used, m.calls
+	m.mu.Unlock()
+	if result == nil || calls == 0 {
+		return
+	}
+
+	fields := map[string]any{
+		"input_tokens":     used.input,
+		"output_tokens":    used.output,
+		"reasoning_tokens": used.reasoning,
+	}
+	footer := fmt.Sprintf("\n\n---\nTokens: %d input, %d output (%d reasoning)", used.input, used.output, used.reasoning)
+	if cost, ok := c.estimatedCost(used); ok {
+		fields["estimated_cost_usd"] = cost
+		footer += fmt.Sprintf(", estimated cost $%.4f", cost)
+	}
+
+	if result.Meta == nil {
+		result.Meta = &mcp.Meta{}
+	}
+	if result.Meta.AdditionalFields == nil {
+		result.Meta.AdditionalFields = make(map[string]any)
+	}
+	result.Meta.AdditionalFields["usage"] = fields
+
+	if c.showUsage && !result.IsError {
+		appendText(result, footer)
+	}
+}
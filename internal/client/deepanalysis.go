@@ -2,11 +2,16 @@ package client
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"sync"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/lox/deep-analysis-mcp/internal/logging"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -14,109 +19,846 @@ import (
 )
 
 const (
-	defaultModel  = "gpt-5-pro"
-	maxIterations = 10 // Limit function call iterations
+	defaultModel         = "gpt-5-pro"
+	defaultMaxIterations = 10 // Limit function call iterations
+
+	// minOutputTokens is the smallest max_output_tokens value the API accepts
+	minOutputTokens = 16
+
+	defaultMaxToolArgsSize = 64 * 1024 // 64KB
+	defaultContextLines    = 2         // grep_in_file context when the model passes null
+	defaultMaxAttached     = 20        // attached files accepted per request
+	defaultEmptyRetries    = 1         // re-issues of a request whose completed response is empty
 )
 
 // FileOps defines the interface for file operations
 type FileOps interface {
 	ReadFile(ctx context.Context, path string) (string, error)
-	GrepFiles(ctx context.Context, pattern, path string, ignoreCase bool) (string, error)
+	ReadFileRange(ctx context.Context, path string, startLine, endLine int) (string, error)
+	GrepFiles(ctx context.Context, pattern, path string, ignoreCase, withBlame, recursive bool, beforeContext, afterContext int) (string, error)
+	GrepInFile(ctx context.Context, path, pattern string, ignoreCase bool, startLine, endLine, contextLines int) (string, error)
+	TailFile(ctx context.Context, path string, lines int, pattern string) (string, error)
 	GlobFiles(ctx context.Context, pattern string) (string, error)
+	ListDirectory(ctx context.Context, path string, recursive bool) (string, error)
+	MatchFiles(ctx context.Context, pattern string) ([]string, error)
+	Fingerprint(ctx context.Context, pattern string, recursive bool) (string, error)
+	FindConflicts(ctx context.Context, pattern string) (string, error)
+	FindOwners(ctx context.Context, pattern, root string) (string, error)
+	FindCycles(ctx context.Context, root string) (string, error)
+	FindTodos(ctx context.Context, pattern string, markers []string) (string, error)
+	GoMetrics(ctx context.Context, path string, topN int) (string, error)
+	LocateSymbol(ctx context.Context, name, root string, includeReferences bool) (string, error)
+	FindImplementations(ctx context.Context, name, root string) (string, error)
+	APISurface(ctx context.Context, dir string) (string, error)
+	CallGraph(ctx context.Context, dir, root string, depth int) (string, error)
+	TraceInteraction(ctx context.Context, dir, entry, format string, depth int, includeExternal bool) (string, error)
+	UnusedSymbols(ctx context.Context, dir, scope string) (string, error)
+	ValidateSchema(ctx context.Context, dataPath, schemaPath string) (string, error)
+	ResolveConfig(ctx context.Context, sources []string, envPrefix string, keys []string) (string, error)
+	JSONDiff(ctx context.Context, expected, actual string) (string, error)
+	DataFlow(ctx context.Context, path, function, variable string) (string, error)
+	GrepDocs(ctx context.Context, pattern, path string, ignoreCase bool) (string, error)
+	DiffDirs(ctx context.Context, oldDir, newDir string, includeDiffs bool) (string, error)
+	GitFileDiff(ctx context.Context, path, rev string) (string, error)
+	FileHistory(ctx context.Context, path string, maxCommits int, includeDiffs bool) (string, error)
+	APIDiff(ctx context.Context, dir, oldRev, newRev string) (string, error)
+	RunCommand(ctx context.Context, command string, args []string) (string, error)
+	CheckVulns(ctx context.Context, dir string) (string, error)
+	TestCoverage(ctx context.Context, dir, profile string) (string, error)
+	CheckDocExamples(ctx context.Context, pattern string) (string, error)
+	BuildProfile(ctx context.Context, dir string, incremental bool) (string, error)
+	RunTool(ctx context.Context, argv []string, input []byte, timeout time.Duration) (string, error)
+	RelativizePaths(text string) string
 }
 
 // DeepAnalysisClient handles communication with OpenAI's Responses API
 type DeepAnalysisClient struct {
 	client  *openai.Client
 	fileOps FileOps
-	conv    map[string]string // conversation_id -> response_id
-	mu      sync.RWMutex
+	conv    *conversationStore
 	tools   []responses.ToolUnionParam
+	jobs    *jobStore
+	actions *actionStore // actions held for approval, nil unless -require-confirmation
+
+	model             string               // model analyses run on unless a request selects another
+	reasoningBudget   int64                // default reasoning token budget, 0 means unlimited
+	ignoreCaseDefault bool                 // grep_files ignore_case when the model passes null
+	allowExec         bool                 // expose the run_command tool
+	allowVulnCheck    bool                 // expose the check_vulns tool
+	allowCoverage     bool                 // expose the test_coverage tool
+	allowDocExamples  bool                 // expose the check_doc_examples tool
+	allowBuildProfile bool                 // expose the build_profile tool
+	allowDocURLs      bool                 // let the docs argument fetch http(s) URLs
+	compareModels     []string             // models compare_models may select, empty disables comparison
+	autoContext       []string             // project files attached when a conversation starts
+	allowEnv          bool                 // expose the list_env tool
+	envValues         []string             // environment variables list_env shows values for
+	allowGit          bool                 // expose git history lookups: grep_files with_blame, git_file_diff rev, api_diff and file_history
+	maxToolArgsSize   int                  // largest tool-call arguments accepted from the model, in bytes
+	verifyRefs        bool                 // check path:line references in answers
+	emptyFallback     bool                 // surface refusals when there's no text
+	emptyRetries      int                  // times to re-issue a request whose completed response is empty
+	maxAttached       int                  // attached files accepted per request
+	truncateAttached  bool                 // drop excess attached files with a warning instead of failing
+	maxDuration       time.Duration        // wall-clock limit on a whole analysis, 0 means unlimited
+	maxIterations     int                  // rounds of tool calls per analysis before it stops
+	maxToolCalls      int                  // limit on tool calls per analysis, 0 means unlimited
+	maxRepeatedCalls  int                  // identical tool call repeats before the model is asked to conclude, 0 disables deduplication
+	bundleDir         string               // directory analysis bundles are saved to, empty disables them
+	showUsage         bool                 // append token usage and estimated cost to results
+	inputPrice        float64              // US dollars per million input tokens, 0 if unknown
+	outputPrice       float64              // US dollars per million output tokens, 0 if unknown
+	maxReadBytes      int64                // limit on file content returned to the model per request, 0 means unlimited
+	externalTools     []ExternalTool       // command-backed tools from a tools manifest
+	shareConv         bool                 // share conversation state across transports rather than partitioning it
+	contextOverflow   string               // what to do when a prompt won't fit: error, trim, drop or mapreduce
+	contextFraction   float64              // share of the context window a prompt may use
+	contextWindow     int64                // input tokens prompts are fitted to, 0 looks them up by model
+	toolSlots         chan struct{}        // global limit on concurrent tool executions, nil means unlimited
+	rateLimiter       *conversationLimiter // per-client request rate limit, nil means unlimited
+	promptVars        map[string]string
+	systemPrompt      string
+}
+
+// Option configures a DeepAnalysisClient
+type Option func(*DeepAnalysisClient)
+
+// WithModel sets the model analyses run on. An empty name keeps the default.
+func WithModel(name string) Option {
+	return func(c *DeepAnalysisClient) {
+		if name != "" {
+			c.model = name
+		}
+	}
+}
+
+// WithReasoningBudget sets the default reasoning token budget for requests
+// that don't specify reasoning_token_budget. Zero disables the cap.
+func WithReasoningBudget(tokens int64) Option {
+	return func(c *DeepAnalysisClient) {
+		c.reasoningBudget = tokens
+	}
+}
+
+// WithIgnoreCaseDefault sets whether grep_files is case-insensitive when
+// the model doesn't specify ignore_case
+func WithIgnoreCaseDefault(ignoreCase bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.ignoreCaseDefault = ignoreCase
+	}
+}
+
+// WithCommandExecution exposes the run_command tool to the model. The
+// FileOps implementation remains responsible for enforcing its allowlist.
+func WithCommandExecution(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowExec = enabled
+	}
+}
+
+// WithVulnCheck exposes the check_vulns tool, which runs govulncheck. The
+// FileOps implementation must also allow the govulncheck command.
+func WithVulnCheck(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowVulnCheck = enabled
+	}
+}
+
+// WithTestCoverage exposes the test_coverage tool, which runs go test with
+// coverage. The FileOps implementation must also allow the go command.
+func WithTestCoverage(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowCoverage = enabled
+	}
+}
+
+// WithDocExamples exposes the check_doc_examples tool, which compiles the Go
+// code blocks of markdown files. The FileOps implementation must also allow
+// the go command.
+func WithDocExamples(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowDocExamples = enabled
+	}
+}
+
+// WithBuildProfile exposes the build_profile tool, which times go build per
+// package. The FileOps implementation must also allow the go command.
+func WithBuildProfile(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowBuildProfile = enabled
+	}
+}
+
+// WithEnvListing exposes the list_env tool, which lists the names of the
+// server's environment variables. Only the named variables have their values
+// shown, and OPENAI_API_KEY never does.
+func WithEnvListing(enabled bool, values []string) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowEnv = enabled
+		c.envValues = values
+	}
+}
+
+// WithGitHistory exposes the with_blame option of grep_files, the rev option of
+// git_file_diff and the api_diff and file_history tools. The FileOps implementation must also have git
+// access enabled.
+func WithGitHistory(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowGit = enabled
+	}
+}
+
+// WithMaxToolArgsSize caps the size of tool-call arguments accepted from the model
+func WithMaxToolArgsSize(bytes int) Option {
+	return func(c *DeepAnalysisClient) {
+		if bytes > 0 {
+			c.maxToolArgsSize = bytes
+		}
+	}
+}
+
+// WithPromptVars sets variables interpolated into the system prompt template
+// (e.g. project, language, standards)
+func WithPromptVars(vars map[string]string) Option {
+	return func(c *DeepAnalysisClient) {
+		c.promptVars = vars
+	}
+}
+
+// WithReferenceVerification checks path:line references in final answers
+// against the filesystem and flags any that don't resolve
+func WithReferenceVerification(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.verifyRefs = enabled
+	}
+}
+
+// WithEmptyResponseFallback controls whether a response with no text returns
+// the model's refusal instead of a bare error
+func WithEmptyResponseFallback(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.emptyFallback = enabled
+	}
+}
+
+// WithEmptyResponseRetries re-issues a request up to retries times when the
+// API completes it with neither text nor tool calls, before giving up
+func WithEmptyResponseRetries(retries int) Option {
+	return func(c *DeepAnalysisClient) {
+		c.emptyRetries = max(retries, 0)
+	}
+}
+
+// WithMaxAttachedFiles caps the number of files a request may attach. When
+// truncate is true excess files are dropped with a warning, otherwise the
+// request fails.
+func WithMaxAttachedFiles(limit int, truncate bool) Option {
+	return func(c *DeepAnalysisClient) {
+		if limit > 0 {
+			c.maxAttached = limit
+		}
+		c.truncateAttached = truncate
+	}
+}
+
+// WithMaxAnalysisDuration caps the wall-clock time of a whole analysis,
+// including tool execution. When the limit passes the model is asked to
+// conclude from what it has gathered. Zero disables the limit.
+func WithMaxAnalysisDuration(d time.Duration) Option {
+	return func(c *DeepAnalysisClient) {
+		c.maxDuration = d
+	}
+}
+
+// WithMaxIterations sets the rounds of tool calls an analysis may make before
+// it stops and returns the partial answer gathered so far. Zero or less keeps
+// the default.
+func WithMaxIterations(n int) Option {
+	return func(c *DeepAnalysisClient) {
+		if n > 0 {
+			c.maxIterations = n
+		}
+	}
+}
+
+// WithMaxToolCalls caps the number of tool calls a single analysis may make.
+// Calls beyond the limit are refused and the model is asked to conclude.
+// Zero disables the limit.
+func WithMaxToolCalls(n int) Option {
+	return func(c *DeepAnalysisClient) {
+		c.maxToolCalls = max(n, 0)
+	}
+}
+
+// WithMaxRepeatedToolCalls answers a tool call identical to an earlier one in
+// the same analysis with the earlier result rather than running it again, and
+// asks the model to conclude once a call has been repeated n times. Zero
+// disables deduplication.
+func WithMaxRepeatedToolCalls(n int) Option {
+	return func(c *DeepAnalysisClient) {
+		c.maxRepeatedCalls = max(n, 0)
+	}
+}
+
+// WithMaxReadBytes caps the file content (from read_file, greps, diffs and
+// similar tools) returned to the model within one request. Once spent,
+// further reads are refused. Zero disables the limit.
+func WithMaxReadBytes(n int64) Option {
+	return func(c *DeepAnalysisClient) {
+		c.maxReadBytes = max(n, 0)
+	}
+}
+
+// WithExternalTools exposes command-backed tools loaded from a tools manifest
+func WithExternalTools(tools []ExternalTool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.externalTools = tools
+	}
+}
+
+// WithSharedConversations sets whether conversation IDs refer to the same
+// state whichever transport a request arrives on. When false, state is
+// partitioned by transport so identical IDs don't collide.
+func WithSharedConversations(shared bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.shareConv = shared
+	}
+}
+
+// WithBundleDir saves a JSON bundle of every completed analysis (settings,
+// prompt, tool calls, usage and answer) to dir. Empty disables bundles.
+func WithBundleDir(dir string) Option {
+	return func(c *DeepAnalysisClient) {
+		c.bundleDir = dir
+	}
+}
+
+// WithContextOverflow sets how prompts estimated to exceed fraction of the
+// model's context window are handled: OverflowError, OverflowTrim, OverflowDrop
+// or OverflowMapReduce
+func WithContextOverflow(policy string, fraction float64) Option {
+	return func(c *DeepAnalysisClient) {
+		if policy != "" {
+			c.contextOverflow = policy
+		}
+		if fraction > 0 && fraction <= 1 {
+			c.contextFraction = fraction
+		}
+	}
+}
+
+// WithMaxConcurrentTools bounds the number of tool executions running at once
+// across all in-flight requests. Zero disables the limit.
+func WithMaxConcurrentTools(limit int) Option {
+	return func(c *DeepAnalysisClient) {
+		if limit > 0 {
+			c.toolSlots = make(chan struct{}, limit)
+		} else {
+			c.toolSlots = nil
+		}
+	}
 }
 
 // New creates a new DeepAnalysisClient instance
-func New(apiKey string, fileOps FileOps) *DeepAnalysisClient {
+func New(apiKey string, fileOps FileOps, opts ...Option) *DeepAnalysisClient {
 	client := openai.NewClient(option.WithAPIKey(apiKey))
 
 	c := &DeepAnalysisClient{
 		client:  &client,
 		fileOps: fileOps,
-		conv:    make(map[string]string),
+		model:   defaultModel,
+		conv:    newConversationStore(),
+		jobs:    newJobStore(),
+
+		maxToolArgsSize: defaultMaxToolArgsSize,
+		maxIterations:   defaultMaxIterations,
+		emptyFallback:   true,
+		emptyRetries:    defaultEmptyRetries,
+		shareConv:       true,
+		maxAttached:     defaultMaxAttached,
+		contextOverflow: OverflowError,
+		contextFraction: defaultContextFraction,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if _, ok := knownContextWindow(c.model); !ok && c.contextWindow == 0 {
+		logging.Warnf("Context window of model %s is unknown; assuming %d tokens (set -context-tokens)", c.model, defaultContextTokens)
 	}
-	c.tools = c.buildTools()
+	c.tools = append(c.buildTools(), c.externalToolParams()...)
+
+	// Render the system prompt once so template problems surface at startup
+	prompt, err := buildSystemPrompt(c.promptVars)
+	if err != nil {
+		panic(fmt.Sprintf("invalid system prompt template: %v", err))
+	}
+	c.systemPrompt = prompt
 
 	return c
 }
 
+// Model returns the model analyses run on by default
+func (c *DeepAnalysisClient) Model() string {
+	return c.model
+}
+
 // Handle processes a consultation request using Responses API
-func (c *DeepAnalysisClient) Handle(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (c *DeepAnalysisClient) Handle(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	ctx, meter := withUsageMeter(ctx)
+	defer func() { c.reportUsage(result, meter) }()
+	started := time.Now()
 	task, err := request.RequireString("task")
 	if err != nil {
-		log.Printf("ERROR: Failed to get task: %v", err)
+		logging.Errorf("Failed to get task: %v", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Reject malformed list arguments up front, before a background job starts
+	if err := checkStringLists(request, handleListArguments); err != nil {
+		logging.Errorf("%v", err)
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
+	if request.GetBool("async", false) {
+		return c.startAsync(ctx, request), nil
+	}
+
 	context := request.GetString("context", "")
 	files := request.GetStringSlice("files", nil)
+	changedFiles := request.GetStringSlice("changed_files", nil)
 	continueConversation := request.GetBool("continue", true)
 	conversationID := request.GetString("conversation_id", "")
-	
+	budget := int64(request.GetInt("reasoning_token_budget", int(c.reasoningBudget)))
+	extractStructured := request.GetBool("extract_structured", false)
+	confidenceAnnotations := request.GetBool("confidence_annotations", false)
+	priorFindings := request.GetString("prior_findings", "")
+	ephemeral := request.GetBool("ephemeral", false)
+	emitPlan := request.GetBool("emit_plan", false)
+	pausePlan := request.GetBool("pause_for_approval", false)
+	outputLanguage := request.GetString("language", "")
+	focusFiles := request.GetStringSlice("focus_files", nil)
+	docs := request.GetStringSlice("docs", nil)
+	compareModels := request.GetStringSlice("compare_models", nil)
+	compareSynthesis := request.GetBool("compare_synthesis", false)
+	if budget < 0 {
+		return mcp.NewToolResultError("reasoning_token_budget must not be negative"), nil
+	}
+
+	var compareCallBudget int64
+	if len(compareModels) > 0 {
+		if err := c.checkCompareModels(compareModels); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if compareCallBudget, err = compareBudget(budget, len(compareModels), compareSynthesis); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if pausePlan {
+			return mcp.NewToolResultError("compare_models can't be combined with pause_for_approval"), nil
+		}
+	}
+
 	// Use default conversation ID if none provided
 	if conversationID == "" {
-		conversationID = "default"
-	}
-	
-	// Read attached files if provided
-	var filesContent string
-	if len(files) > 0 {
-		log.Printf("Reading %d attached files", len(files))
-		var fileParts []string
-		for _, filePath := range files {
-			content, err := c.fileOps.ReadFile(ctx, filePath)
-			if err != nil {
-				log.Printf("WARNING: Failed to read file %s: %v", filePath, err)
-				fileParts = append(fileParts, fmt.Sprintf("File: %s\nError: %v\n", filePath, err))
-			} else {
-				log.Printf("Successfully read file: %s (%d bytes)", filePath, len(content))
-				fileParts = append(fileParts, fmt.Sprintf("File: %s\n```\n%s\n```\n", filePath, content))
-			}
+		conversationID = defaultConversationID
+	}
+	conversationID = c.conversationKey(ctx, conversationID)
+
+	// Keep any one conversation from monopolizing the server
+	if err := c.waitForRate(ctx); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	// Approve a paused plan by continuing its conversation, or ask for a new plan
+	if pausePlan && ephemeral {
+		return mcp.NewToolResultError("pause_for_approval can't be combined with ephemeral: the paused plan must be stored to be approved"), nil
+	}
+	switch {
+	case continueConversation && !ephemeral && c.takePlanPaused(conversationID):
+		log.Printf("Continuing from an approved plan: conversation_id=%s", conversationID)
+		task = planApprovedTask(task)
+	case pausePlan:
+		task = planOnlyTask(task)
+	case emitPlan:
+		task = planFirstTask(task)
+	}
+
+	// Ask for the answer in another language, leaving code untouched
+	if outputLanguage != "" {
+		tag, name, err := parseLanguage(outputLanguage)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if name != "" {
+			task = languageTask(task, tag, name)
+		}
+	}
+
+	// Incremental re-analysis only makes sense on top of an earlier turn
+	if len(changedFiles) > 0 && (!continueConversation || c.getRespID(conversationID) == "") {
+		return mcp.NewToolResultError(fmt.Sprintf("changed_files requires an existing conversation to update; run a full analysis in conversation %q first (with continue=true)", conversationID)), nil
+	}
+
+	// Bound the number of attached files before reading any of them
+	var warnings []string
+	if total := len(files) + len(changedFiles); total > c.maxAttached {
+		if !c.truncateAttached {
+			logging.Errorf("Too many attached files: %d (max %d)", total, c.maxAttached)
+			return mcp.NewToolResultError(fmt.Sprintf("Too many attached files: %d (max %d). Attach the most relevant files and let the analysis discover the rest.", total, c.maxAttached)), nil
+		}
+		logging.Warnf("Truncating attached files: %d -> %d", total, c.maxAttached)
+		warnings = append(warnings, fmt.Sprintf("Only the first %d of %d attached files were included; the rest were dropped.", c.maxAttached, total))
+		// Keep changed files first since an incremental turn depends on them
+		changedFiles = changedFiles[:min(len(changedFiles), c.maxAttached)]
+		files = files[:c.maxAttached-len(changedFiles)]
+	}
+
+	if len(docs) > maxReferenceDocs {
+		return mcp.NewToolResultError(fmt.Sprintf("Too many reference documents: %d (max %d). Pass the documentation most relevant to the task.", len(docs), maxReferenceDocs)), nil
+	}
+
+	// Steer the investigation towards focus files, dropping any that don't exist
+	if len(focusFiles) > 0 {
+		found, missing := c.checkFocusFiles(ctx, focusFiles)
+		if len(missing) > 0 {
+			logging.Warnf("%d focus files not found: %s", len(missing), strings.Join(missing, ", "))
+			warnings = append(warnings, "These focus files were not found and were left out of the hint: "+strings.Join(missing, ", "))
+		}
+		if len(found) > 0 {
+			task = focusTask(task, found)
+		}
+	}
+
+	// Read attached files if provided, reporting progress to clients that asked
+	// for it, as grep_files does with its matches during the analysis
+	ctx = c.withProgress(ctx, request, len(files)+len(changedFiles))
+	fileParts := c.readAttachments(ctx, files)
+
+	// Point an incremental turn at what changed since the last analysis
+	var changedContent string
+	if len(changedFiles) > 0 {
+		log.Printf("Incremental re-analysis: %d changed files", len(changedFiles))
+		task = incrementalTask(task, changedFiles)
+		changedContent = joinStrings(c.readAttachments(ctx, changedFiles), "\n")
+	}
+
+	// Load prior findings from a file if a path was given, otherwise use the text as-is
+	if priorFindings != "" {
+		priorFindings = c.loadPriorFindings(ctx, priorFindings)
+	}
+
+	// Keep the prompt within the model's context window, trimming project
+	// context and then reference documentation before attached code
+	var history int64
+	if continueConversation {
+		history = c.contextTokens(conversationID)
+	}
+	var projectNames, projectParts []string
+	if !continueConversation || c.getRespID(conversationID) == "" {
+		projectNames, projectParts = c.readProjectContext(ctx)
+	}
+	docParts := c.readReferenceDocs(ctx, docs)
+	projectParts, warning := c.fitDocuments(history, "project context files", projectNames, projectParts, func(parts []string) string {
+		return buildPrompt(task, joinStrings(parts, "\n"), context, priorFindings, joinStrings(docParts, "\n"), changedContent, joinStrings(fileParts, "\n"))
+	})
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
+	projectContent := joinStrings(projectParts, "\n")
+	docParts, warning = c.fitDocuments(history, "reference documents", docs, docParts, func(parts []string) string {
+		return buildPrompt(task, projectContent, context, priorFindings, joinStrings(parts, "\n"), changedContent, joinStrings(fileParts, "\n"))
+	})
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
+	docsContent := joinStrings(docParts, "\n")
+	fileParts, truncateHistory, warning, err := c.fitContext(history, files, fileParts, func(parts []string) string {
+		return buildPrompt(task, projectContent, context, priorFindings, docsContent, changedContent, joinStrings(parts, "\n"))
+	})
+	split := errors.Is(err, errSplitAttachments)
+	if err != nil && !split {
+		logging.Errorf("%v", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
+
+	prompt := buildPrompt(task, projectContent, context, priorFindings, docsContent, changedContent, joinStrings(fileParts, "\n"))
+
+	log.Printf("Received request: task_len=%d context_len=%d files=%d changed_files=%d focus_files=%d docs=%d continue=%v conversation_id=%q reasoning_budget=%d extract_structured=%v ephemeral=%v", len(task), len(context), len(files), len(changedFiles), len(focusFiles), len(docs), continueConversation, conversationID, budget, extractStructured, ephemeral)
+
+	a := analysis{
+		prompt:               prompt,
+		conversationID:       conversationID,
+		continueConversation: continueConversation,
+		budget:               budget,
+		started:              started,
+		truncateHistory:      truncateHistory,
+		ephemeral:            ephemeral,
+		planOnly:             pausePlan,
+	}
+	switch {
+	case split && len(compareModels) > 0:
+		return mcp.NewToolResultError("The attached files exceed the context window, and compare_models can't be combined with splitting them across passes. Attach fewer files to compare models."), nil
+	case len(compareModels) > 0:
+		result = c.runComparison(ctx, a, compareModels, compareSynthesis, compareCallBudget)
+	case split:
+		result = c.mapReduce(ctx, a, mapReduceInput{
+			task:           task,
+			projectContent: projectContent,
+			context:        context,
+			priorFindings:  priorFindings,
+			docsContent:    docsContent,
+			changedContent: changedContent,
+			files:          files,
+			parts:          fileParts,
+		})
+	default:
+		result = c.analyze(ctx, a)
+	}
+
+	// Hold the conversation at the plan until the caller approves it
+	if pausePlan && !result.IsError {
+		c.setPlanPaused(conversationID, true)
+		appendText(result, planPausedNote)
+	}
+
+	// Optionally add a machine-readable summary of the answer
+	switch {
+	case result.IsError:
+	case confidenceAnnotations:
+		c.addConfidenceSummary(ctx, result)
+	case extractStructured:
+		c.addStructuredSummary(ctx, result)
+	}
+
+	// Flag file references in the answer that don't exist
+	if c.verifyRefs && !result.IsError {
+		c.verifyReferences(ctx, result)
+	}
+
+	// Surface input warnings ahead of the answer
+	if len(warnings) > 0 && !result.IsError {
+		prependText(result, "**Warning:** "+joinStrings(warnings, "\n**Warning:** ")+"\n\n")
+	}
+
+	return result, nil
+}
+
+// readAttachments reads and fences the given files for inclusion in the
+// prompt, returning one part per file
+func (c *DeepAnalysisClient) readAttachments(ctx context.Context, files []string) []string {
+	if len(files) == 0 {
+		return nil
+	}
+	log.Printf("Reading %d attached files", len(files))
+	var fileParts []string
+	for _, filePath := range files {
+		content, err := c.fileOps.ReadFile(ctx, filePath)
+		if err != nil {
+			logging.Warnf("Failed to read file %s: %v", filePath, err)
+			fileParts = append(fileParts, formatAttachmentError(filePath, err))
+			notifyAttached(ctx, filePath, 0, err)
+		} else {
+			logging.Debugf("Successfully read file: %s (%d bytes)", filePath, len(content))
+			fileParts = append(fileParts, formatAttachment(filePath, content))
+			notifyAttached(ctx, filePath, len(content), nil)
 		}
-		filesContent = "\n" + fmt.Sprintf("Attached Files:\n%s\n", joinStrings(fileParts, "\n"))
 	}
-	
-	// Build the full prompt with context and files if provided
-	var prompt string
-	if context != "" && filesContent != "" {
-		prompt = fmt.Sprintf("Context:\n%s%s\nTask:\n%s", context, filesContent, task)
-	} else if context != "" {
-		prompt = fmt.Sprintf("Context:\n%s\n\nTask:\n%s", context, task)
-	} else if filesContent != "" {
-		prompt = fmt.Sprintf("%s\nTask:\n%s", filesContent, task)
-	} else {
-		prompt = task
+	return fileParts
+}
+
+// incrementalTask frames a follow-up turn as an update to the previous analysis
+func incrementalTask(task string, changed []string) string {
+	return fmt.Sprintf(`These files changed since your last analysis in this conversation; their current contents are under "Changed Files":
+- %s
+
+Update your previous conclusions incrementally rather than starting over: say which findings still hold, which are resolved or changed, and what the changes newly introduce. Only re-read unchanged files where the changes depend on them.
+
+%s`, strings.Join(changed, "\n- "), task)
+}
+
+// loadPriorFindings reads prior findings from a file when value is a readable path,
+// falling back to treating value as inline text
+func (c *DeepAnalysisClient) loadPriorFindings(ctx context.Context, value string) string {
+	if strings.ContainsAny(value, "\n\r") {
+		return value
+	}
+	content, err := c.fileOps.ReadFile(ctx, value)
+	if err != nil {
+		log.Printf("Using prior_findings as inline text (not a readable file: %v)", err)
+		return value
+	}
+	log.Printf("Loaded prior findings from file: %s (%d bytes)", value, len(content))
+	return content
+}
+
+// formatAttachment fences a file's content for inclusion in the prompt,
+// labelled with its path and language
+func formatAttachment(path, content string) string {
+	return fmt.Sprintf("File: %s\n%s\n", path, fenceBlock(content, fenceLanguage(path)))
+}
+
+// fenceBlock wraps content in a code fence longer than any run of backticks
+// inside it, so fenced Markdown can't end the block early
+func fenceBlock(content, language string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + language + "\n" + strings.TrimSuffix(content, "\n") + "\n" + fence
+}
+
+// fenceLanguages maps file extensions and names to code fence info strings
+var fenceLanguages = map[string]string{
+	".go": "go", ".mod": "go.mod", ".sum": "text",
+	".py": "python", ".rb": "ruby", ".rs": "rust", ".java": "java", ".kt": "kotlin",
+	".js": "javascript", ".jsx": "jsx", ".ts": "typescript", ".tsx": "tsx",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp", ".cs": "csharp",
+	".swift": "swift", ".php": "php", ".sh": "bash", ".bash": "bash", ".zsh": "zsh",
+	".sql": "sql", ".proto": "protobuf", ".tf": "hcl", ".hcl": "hcl",
+	".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml", ".xml": "xml",
+	".html": "html", ".css": "css", ".md": "markdown", ".diff": "diff", ".patch": "diff",
+	"Makefile": "makefile", "Dockerfile": "dockerfile",
+}
+
+// fenceLanguage returns the code fence language for a path, or "" when unknown
+func fenceLanguage(path string) string {
+	name := filepath.Base(path)
+	if lang, ok := fenceLanguages[name]; ok {
+		return lang
+	}
+	return fenceLanguages[strings.ToLower(filepath.Ext(name))]
+}
+
+// formatAttachmentError records a file that couldn't be attached
+func formatAttachmentError(path string, err error) string {
+	return fmt.Sprintf("File: %s\nError: %v\n", path, err)
+}
+
+// buildPrompt assembles the user prompt from the task and optional sections
+func buildPrompt(task, projectContent, context, priorFindings, docsContent, changedContent, filesContent string) string {
+	var sections []string
+	if projectContent != "" {
+		sections = append(sections, "Project Context:\n"+projectContent)
+	}
+	if context != "" {
+		sections = append(sections, "Context:\n"+context)
+	}
+	if priorFindings != "" {
+		sections = append(sections, "Previous Findings:\n"+priorFindings)
+	}
+	if docsContent != "" {
+		sections = append(sections, "Reference Documentation:\n"+docsContent)
+	}
+	if changedContent != "" {
+		sections = append(sections, "Changed Files:\n"+changedContent)
+	}
+	if filesContent != "" {
+		sections = append(sections, "Attached Files:\n"+filesContent)
+	}
+	if len(sections) == 0 {
+		return task
+	}
+	sections = append(sections, "Task:\n"+task)
+	return joinStrings(sections, "\n\n")
+}
+
+// analysis holds the parsed parameters of a single deep-analysis request
+type analysis struct {
+	prompt               string
+	conversationID       string
+	continueConversation bool
+	budget               int64
+	started              time.Time // when the request arrived, for the duration limit
+	truncateHistory      bool      // let the API drop the oldest conversation context when it overflows
+	ephemeral            bool      // don't store the response ID or record the turn
+	planOnly             bool      // answer with a plan and no tool calls
+	model                string    // model to run, the client's model when empty
+	used                 *usage    // receives the token usage when set
+}
+
+// modelName returns the model the analysis runs on
+func (c *DeepAnalysisClient) modelName(a analysis) string {
+	if a.model != "" {
+		return a.model
+	}
+	return c.model
+}
+
+// timeLimitSkipped is the output of tool calls skipped once the analysis time limit has passed
+const timeLimitSkipped = "Skipped: the analysis time limit was reached"
+
+// wrapUpPrompt asks the model to conclude once the analysis time limit has passed
+const wrapUpPrompt = "The time limit for this analysis has been reached. Do not call any more tools. Give your best-effort conclusion now from the evidence gathered so far, and say clearly what you were unable to verify."
+
+// analyze runs the model and tool-call loop for a request and returns the final result
+func (c *DeepAnalysisClient) analyze(ctx context.Context, a analysis) (result *mcp.CallToolResult) {
+	a.prompt = c.fileOps.RelativizePaths(a.prompt)
+	prompt := a.prompt
+	conversationID := a.conversationID
+	budget := a.budget
+
+	// Ephemeral turns may read the conversation head but never move it
+	storeID := conversationID
+	if a.ephemeral {
+		storeID = ""
+	}
+
+	var used usage
+	if storeID != "" {
+		defer func() { c.recordTurn(storeID, used, budget) }()
+	}
+	if a.used != nil {
+		defer func() { *a.used = used }()
+	}
+	defer func() { meterUsage(ctx, used) }()
+	rec := c.newBundle(a)
+	defer func() { rec.save(c.bundleDir, result, used) }()
+	defer func() { c.relativizeResult(result) }()
+
+	// Derive the deadline for the whole analysis and report elapsed time against it
+	var deadline time.Time
+	if c.maxDuration > 0 {
+		if a.started.IsZero() {
+			a.started = time.Now()
+		}
+		deadline = a.started.Add(c.maxDuration)
+		defer func() {
+			if !result.IsError {
+				appendText(result, durationFooter(time.Since(a.started), c.maxDuration))
+			}
+		}()
 	}
-	
-	log.Printf("Received request: task_len=%d context_len=%d files=%d continue=%v conversation_id=%q", len(task), len(context), len(files), continueConversation, conversationID)
 
 	// Get previous response ID if continuing
 	var prevResponseID string
-	if continueConversation {
+	if a.continueConversation {
 		prevResponseID = c.getRespID(conversationID)
 		if prevResponseID != "" {
 			log.Printf("Continuing conversation: id=%s response_id=%s", conversationID, prevResponseID)
 		} else {
 			log.Printf("Starting fresh conversation: id=%s", conversationID)
 		}
-	} else {
+	} else if storeID != "" {
 		log.Printf("Starting fresh conversation (continue=false)")
 		// Clear existing conversation state
-		c.clearRespID(conversationID)
+		c.clearRespID(storeID)
+	}
+	if a.ephemeral {
+		log.Printf("Ephemeral turn: conversation %s will not be updated", conversationID)
 	}
 
 	// Build the request parameters
 	params := responses.ResponseNewParams{
-		Model:        defaultModel,
-		Instructions: openai.Opt(buildSystemPrompt()),
+		Model:        c.modelName(a),
+		Instructions: openai.Opt(c.systemPrompt),
 		Tools:        c.tools,
 	}
 
@@ -131,202 +873,297 @@ func (c *DeepAnalysisClient) Handle(ctx context.Context, request mcp.CallToolReq
 	// Add previous response ID if continuing
 	if prevResponseID != "" {
 		params.PreviousResponseID = openai.Opt(prevResponseID)
+		if rec != nil {
+			rec.PreviousResponseID = prevResponseID
+		}
+	}
+
+	// Cap output (including reasoning) tokens when a budget is set
+	if budget > 0 {
+		params.MaxOutputTokens = openai.Int(max(budget, minOutputTokens))
+	}
+	if a.truncateHistory {
+		params.Truncation = responses.ResponseNewParamsTruncationAuto
+	}
+	if a.planOnly {
+		params.ToolChoice = responses.ResponseNewParamsToolChoiceUnion{
+			OfToolChoiceMode: openai.Opt(responses.ToolChoiceOptionsNone),
+		}
 	}
 
 	// Call OpenAI Responses API
-	log.Printf("Calling OpenAI Responses API: model=%s", defaultModel)
+	logging.Debugf("Calling OpenAI Responses API: model=%s", c.modelName(a))
 	response, err := c.client.Responses.New(ctx, params)
 	if err != nil {
-		log.Printf("ERROR: OpenAI API call failed: %v", err)
-		return mcp.NewToolResultError(fmt.Sprintf("OpenAI API error: %v", err)), nil
+		logging.Errorf("OpenAI API call failed: %v", err)
+		return mcp.NewToolResultError(fmt.Sprintf("OpenAI API error: %v", err))
 	}
 
 	// Save the response ID for conversation continuity
-	if conversationID != "" {
-		c.setRespID(conversationID, response.ID)
+	if storeID != "" {
+		c.setRespID(storeID, response.ID)
 	}
-	log.Printf("Received response: id=%s status=%s", response.ID, response.Status)
+	logging.Debugf("Received response: id=%s status=%s", response.ID, response.Status)
+
+	var lastText string
+	cache := newToolCache()
+	repeats := newRepeatTracker(c.maxRepeatedCalls)
+	toolCalls := 0
+	iterations := 0
+	emptyRetries := 0
+	reads := &readBudget{limit: c.maxReadBytes}
+	scratch := c.newScratchSession(storeID, conversationID)
+	defer func() {
+		log.Printf("Analysis finished: conversation=%s iterations=%d/%d tool_calls=%d bytes_read=%d", conversationID, iterations, c.maxIterations, toolCalls, reads.used)
+	}()
 
 	// Handle tool calls in a loop
-	for i := 0; i < maxIterations; i++ {
+	for i := 0; i < c.maxIterations; i++ {
+		iterations = i + 1
+		used.add(response)
+		text := extractTextContent(response)
+		if text != "" {
+			lastText = text
+			reportProgress(ctx, text)
+		}
+
+		// Stop with the best answer so far once the reasoning budget is spent
+		if budget > 0 && budgetReached(response) {
+			log.Printf("Reasoning budget reached: budget=%d output_tokens=%d reasoning_tokens=%d", budget, used.output, used.reasoning)
+			return budgetExhaustedResult(lastText, budget, used)
+		}
+
 		// Check if there are tool calls to execute
-		toolCalls := extractToolCalls(response)
-		log.Printf("Iteration %d: found %d tool calls", i+1, len(toolCalls))
+		calls := extractToolCalls(response)
+		logging.Debugf("Iteration %d: found %d tool calls", i+1, len(calls))
 
-		if len(toolCalls) == 0 {
-			// No more tool calls, extract and return final text response
-			text := extractTextContent(response)
+		if len(calls) == 0 {
+			// No more tool calls, return final text response
 			log.Printf("No tool calls, returning text response: len=%d", len(text))
 			if text == "" {
-				log.Printf("ERROR: No text content in response")
-				return mcp.NewToolResultError("No text content in response"), nil
+				// A completed response with no output is usually transient, so re-issue the same request
+				if refusal, _ := inspectEmptyResponse(response); emptyRetries < c.emptyRetries && refusal == "" && response.Status == responses.ResponseStatusCompleted {
+					emptyRetries++
+					logging.Warnf("Empty response, retrying (%d/%d): id=%s", emptyRetries, c.emptyRetries, response.ID)
+					response, err = c.client.Responses.New(ctx, params)
+					if err != nil {
+						logging.Errorf("Retry API call failed: %v", err)
+						if lastText != "" {
+							return interruptedResult(lastText, err)
+						}
+						return mcp.NewToolResultError(fmt.Sprintf("OpenAI API error: %v", err))
+					}
+					if storeID != "" {
+						c.setRespID(storeID, response.ID)
+					}
+					i-- // retries don't count as iterations
+					continue
+				}
+				logging.Errorf("No text content in response")
+				return c.emptyResponseResult(response)
 			}
-			return mcp.NewToolResultText(text), nil
+			if budget > 0 {
+				text += budgetFooter(budget, used)
+			}
+			return mcp.NewToolResultText(text)
+		}
+
+		// Don't start another round of tool calls without budget to answer
+		if budget > 0 && budget-used.output < minOutputTokens {
+			log.Printf("Reasoning budget exhausted before follow-up: budget=%d output_tokens=%d", budget, used.output)
+			return budgetExhaustedResult(lastText, budget, used)
 		}
 
-		// Execute tool calls
-		toolOutputs := make(responses.ResponseInputParam, 0, len(toolCalls))
-		for _, toolCall := range toolCalls {
+		// Execute tool calls, skipping any left once the time limit has passed
+		// and refusing any beyond the tool call limit
+		toolOutputs := make(responses.ResponseInputParam, 0, len(calls))
+		refused, stuck := false, false
+		for _, toolCall := range calls {
+			if pastDeadline(deadline) {
+				rec.addToolCall(toolCall.Name, toolCall.Arguments, timeLimitSkipped)
+				toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(toolCall.ID, timeLimitSkipped))
+				continue
+			}
+			if earlier, ok, conclude := repeats.repeated(toolCall.Name, toolCall.Arguments); ok {
+				log.Printf("Repeated tool call answered from its earlier result: name=%s", toolCall.Name)
+				stuck = stuck || conclude
+				rec.addToolCall(toolCall.Name, toolCall.Arguments, earlier)
+				toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(toolCall.ID, earlier))
+				continue
+			}
+			if c.maxToolCalls > 0 && toolCalls >= c.maxToolCalls {
+				refused = true
+				refusal := fmt.Sprintf("Refused: this analysis has reached its limit of %d tool calls. Conclude with the evidence you have gathered.", c.maxToolCalls)
+				rec.addToolCall(toolCall.Name, toolCall.Arguments, refusal)
+				toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(toolCall.ID, refusal))
+				continue
+			}
+			toolCalls++
 			log.Printf("Executing tool: name=%s id=%s args_len=%d", toolCall.Name, toolCall.ID, len(toolCall.Arguments))
-			result, err := c.executeFunction(ctx, toolCall.Name, toolCall.Arguments)
+			result, err := "", reads.check(toolCall.Name)
+			switch {
+			case err != nil:
+			case scratchTools[toolCall.Name]:
+				result, err = scratch.execute(toolCall.Name, toolCall.Arguments)
+			default:
+				result, err = c.executeCached(ctx, cache, toolCall.Name, toolCall.Arguments)
+			}
 			if err != nil {
-				log.Printf("Tool execution error: %v", err)
+				logging.Errorf("Tool execution error: %v", err)
 				result = fmt.Sprintf("Error: %v", err)
 			} else {
-				log.Printf("Tool execution success: result_len=%d", len(result))
+				logging.Debugf("Tool execution success: result_len=%d", len(result))
+				result = reads.charge(toolCall.Name, result)
+			}
+			result = c.fileOps.RelativizePaths(result)
+			// Errors may be transient (timeouts, rate limits, the read budget), so a retry runs again
+			if err == nil {
+				repeats.record(toolCall.Name, toolCall.Arguments, result)
 			}
+			rec.addToolCall(toolCall.Name, toolCall.Arguments, result)
 
 			toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(toolCall.ID, result))
 		}
 
+		// Ask for a conclusion instead of another round once the time limit has passed
+		wrapUp := pastDeadline(deadline)
+		if wrapUp {
+			log.Printf("Analysis time limit reached: limit=%s elapsed=%s", c.maxDuration, time.Since(a.started).Round(time.Second))
+			toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfMessage(wrapUpPrompt, responses.EasyInputMessageRoleUser))
+		}
+
 		// Continue the response with tool outputs
-		log.Printf("Continuing with %d tool outputs", len(toolOutputs))
+		logging.Debugf("Continuing with %d tool outputs", len(toolOutputs))
 		params = responses.ResponseNewParams{
-			Model:              defaultModel,
+			Model:              c.modelName(a),
 			PreviousResponseID: openai.Opt(response.ID),
 			Input: responses.ResponseNewParamsInputUnion{
 				OfInputItemList: toolOutputs,
 			},
 			Tools: c.tools,
 		}
+		if budget > 0 {
+			params.MaxOutputTokens = openai.Int(budget - used.output)
+		}
+		if a.truncateHistory {
+			params.Truncation = responses.ResponseNewParamsTruncationAuto
+		}
+		if refused {
+			log.Printf("Tool call limit reached: limit=%d", c.maxToolCalls)
+		}
+		if stuck {
+			log.Printf("Model is repeating tool calls, asking it to conclude: limit=%d", c.maxRepeatedCalls)
+		}
+		if wrapUp || refused || stuck {
+			params.ToolChoice = responses.ResponseNewParamsToolChoiceUnion{
+				OfToolChoiceMode: openai.Opt(responses.ToolChoiceOptionsNone),
+			}
+		}
 
 		response, err = c.client.Responses.New(ctx, params)
 		if err != nil {
-			log.Printf("ERROR: Follow-up API call failed: %v", err)
-			return mcp.NewToolResultError(fmt.Sprintf("OpenAI API error: %v", err)), nil
+			logging.Errorf("Follow-up API call failed: %v", err)
+			if lastText != "" {
+				log.Printf("Returning partial text from earlier iteration: len=%d", len(lastText))
+				return interruptedResult(lastText, err)
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("OpenAI API error: %v", err))
 		}
 
 		// Update response ID
-		if conversationID != "" {
-			c.setRespID(conversationID, response.ID)
+		if storeID != "" {
+			c.setRespID(storeID, response.ID)
+		}
+		logging.Debugf("Updated response: id=%s status=%s", response.ID, response.Status)
+
+		if wrapUp {
+			used.add(response)
+			return timeLimitResult(extractTextContent(response), lastText, c.maxDuration)
 		}
-		log.Printf("Updated response: id=%s status=%s", response.ID, response.Status)
 	}
 
-	log.Printf("ERROR: Max iterations (%d) reached", maxIterations)
-	return mcp.NewToolResultError("Max function call iterations reached"), nil
+	// The last round's tool outputs were answered but the answer not yet read
+	used.add(response)
+	if text := extractTextContent(response); text != "" {
+		lastText = text
+	}
+	logging.Errorf("Max iterations (%d) reached: partial_len=%d", c.maxIterations, len(lastText))
+	return iterationLimitResult(lastText, c.maxIterations)
 }
 
-// getRespID safely retrieves a response ID for a conversation
-func (c *DeepAnalysisClient) getRespID(conversationID string) string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.conv[conversationID]
+// usage accumulates token usage across the responses of a single request
+type usage struct {
+	input     int64
+	output    int64
+	reasoning int64
+	context   int64 // input plus output tokens of the latest response, carried into the next turn
 }
 
-// setRespID safely stores a response ID for a conversation
-func (c *DeepAnalysisClient) setRespID(conversationID, responseID string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.conv[conversationID] = responseID
+// add records the token usage reported on a response
+func (u *usage) add(response *responses.Response) {
+	u.input += response.Usage.InputTokens
+	u.output += response.Usage.OutputTokens
+	u.reasoning += response.Usage.OutputTokensDetails.ReasoningTokens
+	u.context = response.Usage.InputTokens + response.Usage.OutputTokens
 }
 
-// clearRespID safely clears a conversation's response ID
-func (c *DeepAnalysisClient) clearRespID(conversationID string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.conv, conversationID)
+// budgetReached reports whether a response was cut off by max_output_tokens
+func budgetReached(response *responses.Response) bool {
+	return response.Status == responses.ResponseStatusIncomplete &&
+		response.IncompleteDetails.Reason == "max_output_tokens"
 }
 
-// buildTools defines the tools available to the model
-func (c *DeepAnalysisClient) buildTools() []responses.ToolUnionParam {
-	return []responses.ToolUnionParam{
-		responses.ToolParamOfFunction(
-			"read_file",
-			map[string]any{
-				"type": "object",
-				"properties": map[string]any{
-					"path": map[string]any{
-						"type":        "string",
-						"description": "Path to the file to read (supports ~ for home directory)",
-						"minLength":   1,
-					},
-				},
-				"required":             []string{"path"},
-				"additionalProperties": false,
-			},
-			true, // strict
-		),
-		responses.ToolParamOfFunction(
-			"grep_files",
-			map[string]any{
-				"type": "object",
-				"properties": map[string]any{
-					"pattern": map[string]any{
-						"type":        "string",
-						"description": "Regular expression pattern to search for",
-						"minLength":   1,
-					},
-					"path": map[string]any{
-						"type":        "string",
-						"description": "File path or glob pattern (e.g., '*.go', 'src/*.js') using shell-style wildcards (* and ?)",
-						"minLength":   1,
-					},
-					"ignore_case": map[string]any{
-						"type":        "boolean",
-						"description": "Perform case-insensitive search",
-						"default":     false,
-					},
-				},
-				"required":             []string{"pattern", "path", "ignore_case"},
-				"additionalProperties": false,
-			},
-			true, // strict
-		),
-		responses.ToolParamOfFunction(
-			"glob_files",
-			map[string]any{
-				"type": "object",
-				"properties": map[string]any{
-					"pattern": map[string]any{
-						"type":        "string",
-						"description": "Glob pattern (e.g., '**/*.go', 'internal/**/test_*.go', '*.{js,ts}'). Use ** for recursive matching, * for files/dirs, ? for single char.",
-						"minLength":   1,
-					},
-				},
-				"required":             []string{"pattern"},
-				"additionalProperties": false,
-			},
-			true, // strict
-		),
-	}
+// budgetFooter reports reasoning tokens consumed against the budget
+func budgetFooter(budget int64, used usage) string {
+	return fmt.Sprintf("\n\n---\nReasoning tokens: %d (budget: %d, output tokens: %d)", used.reasoning, budget, used.output)
 }
 
-// executeFunction executes a function call requested by the model
-func (c *DeepAnalysisClient) executeFunction(ctx context.Context, name, argsJSON string) (string, error) {
-	switch name {
-	case "read_file":
-		var args struct {
-			Path string `json:"path"`
-		}
-		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-			return "", fmt.Errorf("invalid arguments: %w", err)
-		}
-		return c.fileOps.ReadFile(ctx, args.Path)
+// budgetExhaustedResult returns the best partial answer when the reasoning budget runs out
+func budgetExhaustedResult(partial string, budget int64, used usage) *mcp.CallToolResult {
+	if partial == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("Reasoning token budget of %d was reached before the model produced an answer", budget))
+	}
+	note := fmt.Sprintf("**Note:** the reasoning token budget of %d was reached before the analysis concluded; the answer below is partial.\n\n", budget)
+	return mcp.NewToolResultText(note + partial + budgetFooter(budget, used))
+}
 
-	case "grep_files":
-		var args struct {
-			Pattern    string `json:"pattern"`
-			Path       string `json:"path"`
-			IgnoreCase bool   `json:"ignore_case"`
-		}
-		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-			return "", fmt.Errorf("invalid arguments: %w", err)
-		}
-		return c.fileOps.GrepFiles(ctx, args.Pattern, args.Path, args.IgnoreCase)
+// iterationLimitResult returns the last partial answer once an analysis has
+// used all its rounds of tool calls without concluding
+func iterationLimitResult(partial string, limit int) *mcp.CallToolResult {
+	if partial == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("Max function call iterations (%d) reached before the model produced an answer", limit))
+	}
+	note := fmt.Sprintf("**Note:** the analysis reached its limit of %d rounds of tool calls before concluding; the answer below is partial.\n\n", limit)
+	return mcp.NewToolResultText(note + partial)
+}
 
-	case "glob_files":
-		var args struct {
-			Pattern string `json:"pattern"`
-		}
-		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-			return "", fmt.Errorf("invalid arguments: %w", err)
-		}
-		return c.fileOps.GlobFiles(ctx, args.Pattern)
+// pastDeadline reports whether a deadline is set and has passed
+func pastDeadline(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
 
-	default:
-		return "", fmt.Errorf("unknown function: %s", name)
+// timeLimitResult returns the model's wrap-up conclusion, or the last partial
+// answer if it gave none, once the analysis time limit has passed
+func timeLimitResult(conclusion, partial string, limit time.Duration) *mcp.CallToolResult {
+	if conclusion == "" {
+		conclusion = partial
+	}
+	if conclusion == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("Analysis time limit of %s was reached before the model produced an answer", limit))
 	}
+	note := fmt.Sprintf("**Note:** the analysis time limit of %s was reached; the answer below is a best-effort conclusion from the evidence gathered so far.\n\n", limit)
+	return mcp.NewToolResultText(note + conclusion)
+}
+
+// durationFooter reports the wall-clock time an analysis took against its limit
+func durationFooter(elapsed, limit time.Duration) string {
+	return fmt.Sprintf("\n\n---\nElapsed: %s (limit: %s)", elapsed.Round(time.Second), limit)
+}
+
+// interruptedResult returns partial text salvaged when a follow-up API call fails
+func interruptedResult(partial string, err error) *mcp.CallToolResult {
+	warning := fmt.Sprintf("**Warning:** the analysis was interrupted by an OpenAI API error (%v); the answer below is partial and may be incomplete.\n\n", err)
+	return mcp.NewToolResultText(warning + partial)
 }
 
 // ToolCall represents a function tool call
@@ -340,16 +1177,16 @@ type ToolCall struct {
 func extractToolCalls(response *responses.Response) []ToolCall {
 	var toolCalls []ToolCall
 
-	log.Printf("Extracting tool calls from %d output items", len(response.Output))
+	logging.Debugf("Extracting tool calls from %d output items", len(response.Output))
 	for i, item := range response.Output {
-		log.Printf("Output item %d: type=%s", i, item.Type)
+		logging.Debugf("Output item %d: type=%s", i, item.Type)
 		if item.Type == "function_call" {
 			toolCalls = append(toolCalls, ToolCall{
 				ID:        item.CallID,
 				Name:      item.Name,
 				Arguments: item.Arguments,
 			})
-			log.Printf("Found function call: name=%s id=%s", item.Name, item.CallID)
+			logging.Debugf("Found function call: name=%s id=%s", item.Name, item.CallID)
 		}
 	}
 
@@ -360,16 +1197,16 @@ func extractToolCalls(response *responses.Response) []ToolCall {
 func extractTextContent(response *responses.Response) string {
 	var textParts []string
 
-	log.Printf("Extracting text content from %d output items", len(response.Output))
+	logging.Debugf("Extracting text content from %d output items", len(response.Output))
 	for i, item := range response.Output {
-		log.Printf("Output item %d: type=%s content_items=%d", i, item.Type, len(item.Content))
+		logging.Debugf("Output item %d: type=%s content_items=%d", i, item.Type, len(item.Content))
 		if item.Type == "message" {
 			for j, contentItem := range item.Content {
-				log.Printf("  Content item %d: type=%s", j, contentItem.Type)
+				logging.Debugf("  Content item %d: type=%s", j, contentItem.Type)
 				// The Responses API uses "output_text" not "text"
 				if contentItem.Type == "text" || contentItem.Type == "output_text" {
 					textParts = append(textParts, contentItem.Text)
-					log.Printf("  Found text: len=%d", len(contentItem.Text))
+					logging.Debugf("  Found text: len=%d", len(contentItem.Text))
 				}
 			}
 		}
@@ -383,10 +1220,75 @@ func extractTextContent(response *responses.Response) string {
 		result += part
 	}
 
-	log.Printf("Extracted %d text parts, total length=%d", len(textParts), len(result))
+	logging.Debugf("Extracted %d text parts, total length=%d", len(textParts), len(result))
 	return result
 }
 
+// emptyResponseResult explains a response that finished without text content
+func (c *DeepAnalysisClient) emptyResponseResult(response *responses.Response) *mcp.CallToolResult {
+	refusal, types := inspectEmptyResponse(response)
+
+	if c.emptyFallback && refusal != "" {
+		log.Printf("Response was a refusal: len=%d", len(refusal))
+		return mcp.NewToolResultError("The model declined to answer: " + refusal)
+	}
+
+	return mcp.NewToolResultError(fmt.Sprintf("No text content in response (status=%s, output item types=[%s])", response.Status, strings.Join(types, ", ")))
+}
+
+// inspectEmptyResponse collects refusals and output item types from a
+// response. Reasoning summaries aren't requested (not every model accepts the
+// reasoning parameter), so reasoning items never carry text to fall back on.
+func inspectEmptyResponse(response *responses.Response) (refusal string, types []string) {
+	var refusals []string
+	for _, item := range response.Output {
+		types = append(types, item.Type)
+		if item.Type != "message" {
+			continue
+		}
+		for _, content := range item.Content {
+			if content.Type == "refusal" && content.Refusal != "" {
+				refusals = append(refusals, content.Refusal)
+			}
+		}
+	}
+	return joinStrings(refusals, "\n"), types
+}
+
+// prependText adds text to the start of a result's main text content
+func prependText(result *mcp.CallToolResult, text string) {
+	if len(result.Content) > 0 {
+		if tc, ok := result.Content[0].(mcp.TextContent); ok {
+			tc.Text = text + tc.Text
+			result.Content[0] = tc
+			return
+		}
+	}
+	result.Content = append([]mcp.Content{mcp.NewTextContent(text)}, result.Content...)
+}
+
+// relativizeResult rewrites absolute paths in a result's text content (see -relative-paths)
+func (c *DeepAnalysisClient) relativizeResult(result *mcp.CallToolResult) {
+	for i, content := range result.Content {
+		if tc, ok := content.(mcp.TextContent); ok {
+			tc.Text = c.fileOps.RelativizePaths(tc.Text)
+			result.Content[i] = tc
+		}
+	}
+}
+
+// appendText adds text to the end of a result's main text content
+func appendText(result *mcp.CallToolResult, text string) {
+	if len(result.Content) > 0 {
+		if tc, ok := result.Content[0].(mcp.TextContent); ok {
+			tc.Text += text
+			result.Content[0] = tc
+			return
+		}
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(text))
+}
+
 // joinStrings joins strings with a separator
 func joinStrings(parts []string, sep string) string {
 	result := ""
@@ -399,9 +1301,42 @@ func joinStrings(parts []string, sep string) string {
 	return result
 }
 
-// buildSystemPrompt creates the system prompt
-func buildSystemPrompt() string {
-	return `You are an expert deep analysis AI consulted for the most challenging and complex problems.
+// systemPromptTemplate is parsed at startup; variables come from -prompt-var flags
+var systemPromptTemplate = template.Must(template.New("system").Option("missingkey=zero").Parse(systemPromptText))
+
+// buildSystemPrompt renders the system prompt with the configured variables
+func buildSystemPrompt(vars map[string]string) (string, error) {
+	var extra []string
+	for _, key := range sortedKeys(vars) {
+		switch key {
+		case "project", "language", "standards":
+		default:
+			extra = append(extra, fmt.Sprintf("- %s: %s", key, vars[key]))
+		}
+	}
+
+	var b strings.Builder
+	err := systemPromptTemplate.Execute(&b, map[string]any{
+		"project":   vars["project"],
+		"language":  vars["language"],
+		"standards": vars["standards"],
+		"extra":     extra,
+	})
+	return b.String(), err
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// systemPromptText is the system prompt template
+const systemPromptText = `You are an expert deep analysis AI consulted for the most challenging and complex problems{{with .project}} in the {{.}} project{{end}}.
 
 Your role is to provide deep, systematic analysis through multi-step reasoning:
 
@@ -444,19 +1379,134 @@ You have access to the following tools to gather information:
    - Examples: "**/*.go" (all Go files), "internal/**/test_*.go" (test files in internal), "*.{js,ts}" (JS/TS files)
    - Use this FIRST when you don't know exact file paths
    - Directories marked with trailing /
+   - A pattern matching nothing returns "No files matched the pattern" (as do grep_files and other pattern tools), followed by hints such as a missing directory or where files with that extension do exist. Fix the pattern using the hints; don't conclude the files don't exist
 
-2. **read_file(path)**: Read the contents of any file
+2. **read_file(path, start_line, end_line)**: Read the contents of any file
    - Use after discovering files with glob_files
    - Supports ~ for home directory
+   - start_line/end_line: Read only that range of lines (1-based), or null for the whole file. Whole files are limited to 5MB; page through larger files with ranges
 
-3. **grep_files(pattern, path, ignore_case)**: Search for regex patterns in files
+3. **grep_files(pattern, path, ignore_case, recursive, context_lines, before_context, after_context)**: Search for regex patterns in files; set recursive to search inside directories the path matches
    - pattern: Regular expression to search for
-   - path: Glob pattern for files to search (e.g., "*.go", "src/**/*.js")
+   - ignore_case: true/false, or null to use the server default
+   - path: Glob pattern for files to search (e.g., "*.go", "src/**/*.js", "*.{go,mod,sum}")
+   - context_lines (or before_context/after_context): Show surrounding lines like grep -C, so you often don't need a follow-up read_file
    - Use to find specific code patterns across multiple files
 
+4. **grep_in_file(path, pattern, ignore_case, start_line, end_line, context_lines)**: Search one file of any size
+   - Streams the file, so it works on huge logs that read_file rejects
+   - Returns matching line numbers with surrounding context; narrow with start_line/end_line
+   - Use to locate a pattern in a large file, then search again with a tight line range to read around it
+
+5. **find_todos(pattern, markers)**: List TODO/FIXME/XXX/HACK markers grouped by marker and file
+   - pattern: Glob pattern for files to search (e.g., "**/*.go")
+   - markers: Markers to look for, or null for the defaults
+   - Use for tech-debt reviews and "what's left to do" questions
+
+6. **go_metrics(path, top_n)**: Per-function line counts and cyclomatic complexity for a Go file or package directory
+   - Lists the most complex functions first and flags complexity >= 10
+   - Use for refactoring questions to find objective simplification targets
+
+7. **git_file_diff(path, rev)**: Show the unified diff of one file against a git revision
+   - rev: Revision to compare against, or null for HEAD (only offered when git history is enabled)
+   - Use to see exactly what changed in a file versus what is committed
+
+8. **locate_symbol(name, path, include_references)**: Find where a Go symbol is defined across a whole tree
+   - name: Function, type, var or const name, or Type.Method for a method
+   - path: Directory to search recursively, or null for the project root
+   - Set include_references to also list identifier uses (matched by name, so may include unrelated symbols)
+
+9. **api_surface(path)**: List the exported API of a Go package directory with signatures and doc comments
+   - Excludes unexported symbols and test files
+   - Use for compatibility reviews and "will this change break callers" questions
+
+10. **call_graph(path, function, depth)**: Static call graph of a Go package rooted at one function
+   - function: Function name or Type.Method; depth: levels to expand, or null for 3
+   - Best-effort: calls are matched by name, and external, dynamic, unresolved and ambiguous calls are flagged
+   - Use to trace execution paths when debugging
+
+11. **grep_docs(pattern, path, ignore_case)**: Search only Go doc comments, returning each match with the symbol it documents
+   - path: A .go file, or a directory searched recursively; null for the project root
+   - Use for "why does this work this way" questions, where design intent lives in comments rather than code
+
+12. **diff_dirs(old_path, new_path, include_diffs)**: Compare two directory trees without git
+   - Lists files added, removed and modified (by content hash); set include_diffs for capped unified diffs of modified files
+   - Use for "what changed between these versions" questions, such as vendored dependencies or release snapshots
+
+13. **unused_symbols(path, scope)**: List exported symbols of a Go package with no references in the package or under scope
+   - scope: Directory searched for dependents, or null for the project root
+   - Best-effort name matching: results are likely unused, not definitively (reflection, build tags and interface satisfaction aren't considered)
+   - Use for cleanup and tech-debt questions, then verify candidates before recommending removal
+
+14. **validate_schema(path, schema_path)**: Validate a JSON or YAML file against a JSON Schema file
+   - Returns "valid", or each violation with the JSON pointer of the offending value; every document of a multi-document YAML file is checked
+   - Use for config correctness (Kubernetes manifests, API specs, CI config) instead of judging by eye
+
+15. **data_flow(path, function, variable)**: Trace one variable through a Go function
+   - Lists each declaration, assignment, mutation (field, element or pointee), address-taken and use with its line, numbering shadowed declarations
+   - Best-effort and intra-procedural: changes through pointers and method calls are flagged, not followed
+   - Use when debugging "where does this value come from and where does it go" in a large function
+
+16. **find_conflicts(pattern)**: Find unresolved merge conflict markers in files matching a glob
+   - Reports each conflict with its line range and the ours, base (diff3) and theirs sections
+   - Use first when a build breaks after a merge or rebase
+
+17. **json_diff(expected, actual)**: Structurally compare two JSON documents (inline or file paths), listing added, removed and changed values by JSON path
+   - Key order and whitespace are ignored and numbers are compared by value, so only real differences are reported
+   - Use for "why doesn't this response/fixture/config match" questions instead of comparing large JSON by eye
+
+18. **find_owners(pattern, root)**: List the owners of each file matching a glob according to the repository's CODEOWNERS file
+   - root: Repository root holding CODEOWNERS (in .github/, the root or docs/); null for the project root
+   - Reports the rule (line and pattern) that decided each file; the last matching rule wins
+   - Use for "who should review this" questions instead of guessing from names or history
+
+19. **find_cycles(path)**: Report every import cycle among the Go packages of a module
+   - path: Directory to scan recursively, inside a module with a go.mod; null for the project root
+   - Lists each cycle once with the file and line of every import in it, shortest first; test files are skipped
+   - Use for "do we have circular dependencies and where" questions instead of piecing the graph together by hand
+
+20. **scratch_write(key, value)** and **scratch_read(key)**: Your working memory for this conversation
+   - Notes persist across iterations and later turns of the conversation (up to 64KB in total) and are cleared with it
+   - scratch_read with a null key lists the keys; writing an empty value deletes one
+   - Record intermediate conclusions (call chains traced, hypotheses ruled out, key line numbers) so you can recall them instead of re-reading files
+
+21. **resolve_config(sources, env_prefix, keys)**: Merge layered configuration and report each key's effective value and which source set it
+   - sources: Config files (JSON, YAML, .env, properties, INI) or "args: <flags>", lowest precedence first, in the order the application applies them (typically defaults, config file, environment, flags)
+   - Keys match across sources ignoring case and ".", "_" and "-", so APP_DB_HOST (with env_prefix APP_) overrides db.host
+   - Use for "why is this config value what it is" questions instead of comparing the files by hand
+
+22. **list_directory(path, recursive)**: List a directory's entries, directories with a trailing / and files with their size
+   - recursive: List the whole tree indented by depth; hidden, vendor, node_modules, dist and build directories are shown but not entered
+   - Use to learn a project's layout instead of globbing with * patterns
+
+23. **trace_interaction(path, function, format, depth, include_external)**: Sequence diagram (Mermaid or PlantUML) of the calls reachable from one Go function
+   - Participants are receiver types and the package itself; include_external adds calls into other packages
+   - Dynamic, unresolved and ambiguous calls are drawn dashed and listed as uncertain, since calls are matched by name
+   - Use to explain how components interact along a code path, or when the user asks for a diagram
+
+24. **find_implementations(name, path)**: List the Go types whose methods satisfy an interface, with file:line
+   - name: Interface name, or pkg.Interface to pick one package's; path: Directory to search recursively, or null for the project root
+   - Matches by method name and signature without type checking; types with every method name but a differing signature are listed as near misses
+   - Use instead of grepping for method names to find what implements an interface
+
+**Truncated Output**:
+Whenever a tool result, attachment or document is cut short to fit a limit, the cut is marked with "⟦TRUNCATED: <reason>, <what> omitted⟧", often followed by a hint. Treat everything past the marker as unseen: don't conclude that something is absent because it isn't shown. Follow the hint or narrow the request (a tighter pattern, a line range, a smaller directory) to fetch the omitted part when it matters.
+
 **Attached Files**:
 Sometimes files will be pre-attached to your prompt under "Attached Files". Review these carefully as they contain the key code/config you need to analyze.
 
+**Changed Files**:
+On a follow-up turn, a "Changed Files" section holds the current contents of files edited since your last answer in this conversation. Revise your earlier conclusions against them instead of repeating the whole analysis.
+
+**Project Context**:
+A "Project Context" section holds the project's own orientation files, such as its README or agent guidelines. Use them to understand the project's purpose and conventions; they aren't the subject of the task unless it says so.
+
+**Reference Documentation**:
+A "Reference Documentation" section holds documentation the caller supplied for libraries or APIs involved. Prefer it over your own recollection of those APIs, but it describes dependencies: the code under analysis is in the attached files and on disk.
+
+**Previous Findings**:
+A "Previous Findings" section contains conclusions from an earlier session of this investigation. Build on them rather than starting over, but re-verify anything the current task depends on.
+
 **CRITICAL WORKFLOW** - Use these tools PROACTIVELY and FREQUENTLY:
 1. **Discover**: Use glob_files to find relevant files if you don't know exact paths
 2. **Review**: Read any pre-attached files first
@@ -464,5 +1514,15 @@ Sometimes files will be pre-attached to your prompt under "Attached Files". Revi
 4. **Search**: Use grep_files to find patterns or references across the codebase
 5. **Verify**: Don't make assumptions - gather evidence before concluding
 
-You are being consulted because standard approaches have proven insufficient. Bring your full analytical capabilities to bear, and let the evidence guide your recommendations.`
-}
+{{if or .language .standards .extra}}**Project Information**:
+{{- with .language}}
+- Primary language: {{.}}
+{{- end}}
+{{- with .standards}}
+- Coding standards: {{.}} (hold recommendations to these standards)
+{{- end}}
+{{- range .extra}}
+{{.}}
+{{- end}}
+
+{{end}}You are being consulted because standard approaches have proven insufficient. Bring your full analytical capabilities to bear, and let the evidence guide your recommendations.`
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openai/openai-go/responses"
+)
+
+func TestEmptyResponseResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		fallback  bool
+		response  string
+		wantError bool
+		wantText  string
+	}{
+		{
+			name:      "refusal",
+			fallback:  true,
+			response:  `{"status":"completed","output":[{"type":"message","role":"assistant","content":[{"type":"refusal","refusal":"I can't help with that."}]}]}`,
+			wantError: true,
+			wantText:  "The model declined to answer: I can't help with that.",
+		},
+		{
+			name:      "refusal without fallback",
+			fallback:  false,
+			response:  `{"status":"completed","output":[{"type":"message","role":"assistant","content":[{"type":"refusal","refusal":"I can't help with that."}]}]}`,
+			wantError: true,
+			wantText:  "No text content in response (status=completed, output item types=[message])",
+		},
+		{
+			name:      "reasoning only",
+			fallback:  true,
+			response:  `{"status":"completed","output":[{"type":"reasoning","summary":[]}]}`,
+			wantError: true,
+			wantText:  "No text content in response (status=completed, output item types=[reasoning])",
+		},
+		{
+			name:      "empty",
+			fallback:  true,
+			response:  `{"status":"incomplete","output":[]}`,
+			wantError: true,
+			wantText:  "No text content in response (status=incomplete, output item types=[])",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response responses.Response
+			if err := json.Unmarshal([]byte(tt.response), &response); err != nil {
+				t.Fatalf("unmarshal response: %v", err)
+			}
+
+			c := &DeepAnalysisClient{emptyFallback: tt.fallback}
+			result := c.emptyResponseResult(&response)
+			if result.IsError != tt.wantError {
+				t.Errorf("IsError = %v, want %v", result.IsError, tt.wantError)
+			}
+			if got := resultText(result); got != tt.wantText {
+				t.Errorf("text = %q, want %q", got, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	envRedacted    = "«set»"
+	maxEnvValueLen = 1024 // Limit characters shown for an allowlisted value
+)
+
+// envSecrets are variables whose values are never shown, even when allowlisted
+var envSecrets = map[string]bool{
+	"OPENAI_API_KEY": true,
+}
+
+// listEnv lists the server's environment variables, optionally only those
+// starting with prefix. Values are shown for allowlisted names only.
+func (c *DeepAnalysisClient) listEnv(prefix string) string {
+	names := make([]string, 0)
+	values := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if name == "" || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		names = append(names, name)
+		values[name] = value
+	}
+	if len(names) == 0 {
+		if prefix != "" {
+			return fmt.Sprintf("No environment variables start with %q", prefix)
+		}
+		return "No environment variables are set"
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d environment variables (values shown for allowlisted names only; others are %s):\n", len(names), envRedacted)
+	for _, name := range names {
+		value := envRedacted
+		if slices.Contains(c.envValues, name) && !envSecrets[name] {
+			value = values[name]
+			marker := ""
+			if len(value) > maxEnvValueLen {
+				marker = " " + truncate.Marker(fmt.Sprintf("value limit of %d bytes", maxEnvValueLen), fmt.Sprintf("%d bytes", len(value)-maxEnvValueLen), "")
+				value = value[:maxEnvValueLen]
+			}
+			value = fmt.Sprintf("%q", value) + marker
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, value)
+	}
+	return b.String()
+}
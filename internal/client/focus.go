@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// checkFocusFiles splits focus paths, which may be globs, into those matching
+// at least one readable file and those that don't, with the reason for each
+func (c *DeepAnalysisClient) checkFocusFiles(ctx context.Context, paths []string) ([]string, []string) {
+	var found, missing []string
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		matches, err := c.fileOps.MatchFiles(ctx, path)
+		switch {
+		case err != nil:
+			missing = append(missing, fmt.Sprintf("%s (%v)", path, err))
+		case len(matches) == 0:
+			missing = append(missing, fmt.Sprintf("%s (no such file)", path))
+		default:
+			found = append(found, path)
+		}
+	}
+	return found, missing
+}
+
+// focusTask points the model at files to investigate first without attaching them
+func focusTask(task string, paths []string) string {
+	return fmt.Sprintf(`%s
+
+The caller expects these files to be the most relevant. They are not attached: read them first, with read_file or grep_in_file as needed, before widening the investigation, and don't limit yourself to them if the evidence leads elsewhere:
+- %s`, task, strings.Join(paths, "\n- "))
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	maxBackgroundJobs = 4         // Limit concurrently running async analyses
+	jobTTL            = time.Hour // How long completed results are kept
+)
+
+// job tracks a single background analysis
+type job struct {
+	started  time.Time
+	finished time.Time
+	partial  string
+	result   *mcp.CallToolResult
+}
+
+// jobStore holds background analyses and their results
+type jobStore struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	running int
+}
+
+// newJobStore creates an empty job store
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string]*job)}
+}
+
+// start registers a new job, failing if too many are already running
+func (s *jobStore) start() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	if s.running >= maxBackgroundJobs {
+		return "", fmt.Errorf("too many background analyses running (max %d); poll existing jobs or retry later", maxBackgroundJobs)
+	}
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	id := "job_" + hex.EncodeToString(b[:])
+
+	s.jobs[id] = &job{started: time.Now()}
+	s.running++
+	return id, nil
+}
+
+// progress records the latest partial text for a running job
+func (s *jobStore) progress(id, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		j.partial = text
+	}
+}
+
+// finish stores the final result of a job
+func (s *jobStore) finish(id string, result *mcp.CallToolResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		j.result = result
+		j.finished = time.Now()
+		s.running--
+	}
+}
+
+// get returns a snapshot of a job
+func (s *jobStore) get(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	j, ok := s.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// expire drops completed jobs older than jobTTL. Callers must hold mu.
+func (s *jobStore) expire() {
+	for id, j := range s.jobs {
+		if j.result != nil && time.Since(j.finished) > jobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// progressKey carries the progress callback for background jobs in a context
+type progressKey struct{}
+
+// reportProgress forwards partial text to the background job running this request, if any
+func reportProgress(ctx context.Context, text string) {
+	if fn, ok := ctx.Value(progressKey{}).(func(string)); ok {
+		fn(text)
+	}
+}
+
+// startAsync runs the analysis in the background and returns a job handle immediately
+func (c *DeepAnalysisClient) startAsync(ctx context.Context, request mcp.CallToolRequest) *mcp.CallToolResult {
+	id, err := c.jobs.start()
+	if err != nil {
+		logging.Errorf("Failed to start background analysis: %v", err)
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	// Re-run the same request synchronously inside the goroutine
+	args := make(map[string]any, len(request.GetArguments())+1)
+	for k, v := range request.GetArguments() {
+		args[k] = v
+	}
+	args["async"] = false
+	request.Params.Arguments = args
+	// The progress token belongs to the request that is about to return
+	request.Params.Meta = nil
+
+	// Keep request values such as the transport, but outlive the request itself
+	ctx = context.WithValue(context.WithoutCancel(ctx), progressKey{}, func(text string) {
+		c.jobs.progress(id, text)
+	})
+
+	log.Printf("Starting background analysis: job_id=%s", id)
+	go func() {
+		result, err := c.Handle(ctx, request)
+		if err != nil {
+			result = mcp.NewToolResultError(err.Error())
+		}
+		c.jobs.finish(id, result)
+		log.Printf("Background analysis finished: job_id=%s", id)
+	}()
+
+	return mcp.NewToolResultText(fmt.Sprintf("Analysis started in the background.\nJob ID: %s\nPoll with get_analysis_result(job_id) for the result. Results are kept for %s after completion.", id, jobTTL))
+}
+
+// HandleResult returns the status or result of a background analysis
+func (c *DeepAnalysisClient) HandleResult(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	j, ok := c.jobs.get(id)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("Unknown or expired job: %s", id)), nil
+	}
+
+	if j.result != nil {
+		log.Printf("Returning background result: job_id=%s", id)
+		return j.result, nil
+	}
+
+	status := fmt.Sprintf("Job %s is still running (started %s ago).", id, time.Since(j.started).Round(time.Second))
+	if j.partial != "" {
+		status += "\n\nPartial results so far:\n\n" + j.partial
+	}
+	return mcp.NewToolResultText(status), nil
+}
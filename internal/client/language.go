@@ -0,0 +1,32 @@
+package client
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// parseLanguage validates a BCP-47 language tag and returns it with its English
+// name. English, the default, returns an empty name since it needs no instruction.
+func parseLanguage(code string) (language.Tag, string, error) {
+	tag, err := language.Parse(code)
+	if err != nil {
+		return language.Und, "", fmt.Errorf("invalid language %q: expected a BCP-47 tag such as \"de\" or \"pt-BR\"", code)
+	}
+	if base, _ := tag.Base(); base.String() == "en" {
+		return tag, "", nil
+	}
+	name := display.English.Tags().Name(tag)
+	if name == "" {
+		name = tag.String()
+	}
+	return tag, name, nil
+}
+
+// languageTask asks for the answer in the given language without translating code
+func languageTask(task string, tag language.Tag, name string) string {
+	return fmt.Sprintf(`%s
+
+Write your answer in %s (%s). Keep code, identifiers, file paths, commands, error messages and quoted tool output exactly as they are, untranslated.`, task, name, tag)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// logTask is the prompt for analyzing the tail of a log file
+const logTask = `Analyze the tail of the log file %s, included under "Context". Identify:
+- The distinct errors and warnings, with how often each occurs and when it first and last appears in this excerpt
+- Which errors look like root causes and which are downstream symptoms
+- The most likely root cause, supported by the log lines and, where useful, the code that emits them (use your tools to find it)
+- What to check or change next
+
+Quote the relevant log lines when citing evidence.`
+
+// HandleAnalyzeLog tails a log file, optionally filtering it, and runs an
+// analysis focused on errors, their frequency and likely root causes
+func (c *DeepAnalysisClient) HandleAnalyzeLog(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	ctx, meter := withUsageMeter(ctx)
+	defer func() { c.reportUsage(result, meter) }()
+	started := time.Now()
+	path, err := request.RequireString("path")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	lines := request.GetInt("lines", 0)
+	pattern := request.GetString("pattern", "")
+	question := request.GetString("question", "")
+	conversationID := c.conversationKey(ctx, request.GetString("conversation_id", ""))
+	if err := c.waitForRate(ctx); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	log.Printf("Analyzing log: path=%s lines=%d pattern=%q", path, lines, pattern)
+
+	tail, err := c.fileOps.TailFile(ctx, path, lines, pattern)
+	if err != nil {
+		logging.Errorf("Failed to tail log: %v", err)
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read log: %v", err)), nil
+	}
+
+	task := fmt.Sprintf(logTask, path)
+	if question != "" {
+		task += "\n\nIn particular: " + question
+	}
+
+	result = c.analyze(ctx, analysis{
+		prompt:               buildPrompt(task, "", fenceBlock(tail, ""), "", "", "", ""),
+		conversationID:       conversationID,
+		continueConversation: false,
+		budget:               c.reasoningBudget,
+		started:              started,
+	})
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+)
+
+// toolNamePattern matches the function names the Responses API accepts
+var toolNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ExternalTool is a command-backed tool declared in a tools manifest. The
+// model's arguments are passed to the command as JSON on stdin and its
+// stdout is returned as the tool result.
+type ExternalTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+	Command     []string       `json:"command"`
+	Timeout     string         `json:"timeout"`
+
+	timeout time.Duration
+}
+
+// LoadToolsManifest reads and validates a JSON tools manifest of the form
+// {"tools": [{"name", "description", "parameters", "command", "timeout"}]}
+func LoadToolsManifest(path string) ([]ExternalTool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tools manifest: %w", err)
+	}
+	var manifest struct {
+		Tools []ExternalTool `json:"tools"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse tools manifest %s: %w", path, err)
+	}
+
+	// Built-in tools, including those behind flags, can't be shadowed
+	seen := make(map[string]bool)
+	builtins := (&DeepAnalysisClient{allowExec: true, allowGit: true, allowVulnCheck: true, allowCoverage: true, allowDocExamples: true, allowBuildProfile: true, allowEnv: true}).buildTools()
+	for _, tool := range builtins {
+		seen[tool.OfFunction.Name] = true
+	}
+	for i := range manifest.Tools {
+		tool := &manifest.Tools[i]
+		if !toolNamePattern.MatchString(tool.Name) {
+			return nil, fmt.Errorf("tools manifest: invalid tool name %q (use up to 64 letters, digits, _ and -)", tool.Name)
+		}
+		if seen[tool.Name] {
+			return nil, fmt.Errorf("tools manifest: tool %q is declared twice or conflicts with a built-in tool", tool.Name)
+		}
+		seen[tool.Name] = true
+		if tool.Description == "" {
+			return nil, fmt.Errorf("tools manifest: tool %q needs a description", tool.Name)
+		}
+		if len(tool.Command) == 0 || tool.Command[0] == "" {
+			return nil, fmt.Errorf("tools manifest: tool %q needs a command", tool.Name)
+		}
+		if tool.Parameters == nil {
+			tool.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		if tool.Parameters["type"] != "object" {
+			return nil, fmt.Errorf("tools manifest: parameters of tool %q must be a JSON schema with type \"object\"", tool.Name)
+		}
+		if tool.Timeout != "" {
+			if tool.timeout, err = time.ParseDuration(tool.Timeout); err != nil || tool.timeout <= 0 {
+				return nil, fmt.Errorf("tools manifest: invalid timeout %q for tool %q", tool.Timeout, tool.Name)
+			}
+		}
+	}
+	return manifest.Tools, nil
+}
+
+// externalToolParams returns the tool definitions for manifest tools. Their
+// schemas are operator-written, so they aren't held to strict mode.
+func (c *DeepAnalysisClient) externalToolParams() []responses.ToolUnionParam {
+	var tools []responses.ToolUnionParam
+	for _, tool := range c.externalTools {
+		param := responses.ToolParamOfFunction(tool.Name, tool.Parameters, false)
+		param.OfFunction.Description = openai.String(tool.Description)
+		tools = append(tools, param)
+	}
+	return tools
+}
+
+// externalTool returns the manifest tool with the given name, or nil
+func (c *DeepAnalysisClient) externalTool(name string) *ExternalTool {
+	for i := range c.externalTools {
+		if c.externalTools[i].Name == name {
+			return &c.externalTools[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// errSplitAttachments tells Handle the attachments must be analyzed in groups (OverflowMapReduce)
+var errSplitAttachments = errors.New("attachments exceed the context window and must be split")
+
+// mapReduceInput holds the prompt pieces of a request whose attachments are split across passes
+type mapReduceInput struct {
+	task, projectContent, context, priorFindings, docsContent, changedContent string
+	files, parts                                                              []string // attachment paths and their fenced contents
+}
+
+// mapReduce analyzes oversized attachments in groups that each fit the context
+// window, then synthesizes the partial answers in a final call that continues
+// the conversation as a single analysis would. Partial passes run as fresh,
+// ephemeral turns so they don't need or disturb the conversation history.
+func (c *DeepAnalysisClient) mapReduce(ctx context.Context, a analysis, in mapReduceInput) *mcp.CallToolResult {
+	limit := c.contextLimit(c.modelName(a))
+	system := estimateTokens(c.systemPrompt)
+
+	// Pack attachments in order into groups whose partial prompt fits
+	partialPrompt := func(pass, passes int, group []int) string {
+		parts := make([]string, len(group))
+		paths := make([]string, len(group))
+		for i, idx := range group {
+			parts[i], paths[i] = in.parts[idx], in.files[idx]
+		}
+		return buildPrompt(partialTask(in.task, pass, passes, paths), in.projectContent, in.context, in.priorFindings, in.docsContent, in.changedContent, joinStrings(parts, "\n"))
+	}
+	var groups [][]int
+	var current, omitted []int
+	for i := range in.parts {
+		if system+estimateTokens(partialPrompt(0, 0, append(current, i))) <= limit {
+			current = append(current, i)
+			continue
+		}
+		if len(current) > 0 {
+			groups = append(groups, current)
+			current = nil
+		}
+		if system+estimateTokens(partialPrompt(0, 0, []int{i})) > limit {
+			omitted = append(omitted, i) // too large even on its own
+			continue
+		}
+		current = []int{i}
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	if len(groups) == 0 {
+		return mcp.NewToolResultError("No attached file fits in the context window on its own, even split into separate passes. Attach smaller files or let the analysis read what it needs with grep_in_file and read_file.")
+	}
+
+	log.Printf("Map-reduce analysis: %d attached files in %d partial passes (%d omitted)", len(in.files), len(groups), len(omitted))
+
+	var partials []string
+	for i, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Analysis cancelled after %d of %d partial passes: %v", i, len(groups), err))
+		}
+		log.Printf("Map-reduce partial pass %d of %d: %d files", i+1, len(groups), len(group))
+		result := c.analyze(ctx, analysis{
+			prompt:         partialPrompt(i+1, len(groups), group),
+			conversationID: a.conversationID,
+			budget:         a.budget,
+			started:        a.started,
+			ephemeral:      true,
+			planOnly:       a.planOnly,
+		})
+		if result.IsError {
+			prependText(result, fmt.Sprintf("Partial pass %d of %d failed: ", i+1, len(groups)))
+			return result
+		}
+		paths := make([]string, len(group))
+		for j, idx := range group {
+			paths[j] = in.files[idx]
+		}
+		partials = append(partials, fmt.Sprintf("### Pass %d of %d (%s)\n\n%s", i+1, len(groups), strings.Join(paths, ", "), stripFooters(resultText(result))))
+	}
+
+	// Synthesize the partial answers as the conversation's turn
+	prompt := buildPrompt(synthesisTask(in.task, partials), in.projectContent, in.context, in.priorFindings, in.docsContent, "", "")
+	final := a
+	final.prompt = prompt
+	if a.continueConversation && system+c.contextTokens(a.conversationID)+estimateTokens(prompt) > limit {
+		final.truncateHistory = true
+	}
+	log.Printf("Map-reduce synthesis of %d partial passes", len(partials))
+	result := c.analyze(ctx, final)
+	if result.IsError {
+		return result
+	}
+
+	note := fmt.Sprintf("**Note:** the attached files exceeded the context window, so they were analyzed in %d partial passes and this answer synthesizes them (%d model calls).", len(groups), len(groups)+1)
+	if len(omitted) > 0 {
+		names := make([]string, len(omitted))
+		for i, idx := range omitted {
+			names[i] = in.files[idx]
+		}
+		note += " " + truncate.Marker("too large for a pass on their own", fmt.Sprintf("%d files (%s)", len(omitted), strings.Join(names, ", ")), "")
+	}
+	prependText(result, note+"\n\n")
+	return result
+}
+
+// partialTask scopes the task to one group of attachments in a map-reduce analysis
+func partialTask(task string, pass, passes int, files []string) string {
+	return fmt.Sprintf(`The attached files are too large for one request, so they are being analyzed in %d partial passes. This is pass %d, covering only:
+- %s
+
+Answer the task below as far as these files allow. Report concrete findings with file:line evidence, and note open questions that depend on code outside this pass; a final step will merge all passes.
+
+%s`, passes, pass, strings.Join(files, "\n- "), task)
+}
+
+// synthesisTask asks for one answer merged from the partial passes
+func synthesisTask(task string, partials []string) string {
+	return fmt.Sprintf(`The attached files were too large for one request, so they were analyzed in %d partial passes, each over a subset of the files. Their answers follow.
+
+%s
+
+Synthesize these into a single answer to the task below: merge overlapping findings, resolve contradictions and open questions (reading files with your tools where needed), and don't mention the passes unless it matters to the conclusion.
+
+%s`, len(partials), strings.Join(partials, "\n\n"), task)
+}
+
+// stripFooters removes the usage and elapsed-time footers appended to an answer
+func stripFooters(text string) string {
+	for {
+		i := strings.LastIndex(text, "\n\n---\n")
+		if i < 0 || strings.Contains(text[i+len("\n\n---\n"):], "\n") {
+			return text
+		}
+		text = text[:i]
+	}
+}
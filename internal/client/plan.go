@@ -0,0 +1,31 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// planFirstTask asks for an investigation plan at the top of the answer
+func planFirstTask(task string) string {
+	return task + `
+
+Before investigating, decide on a short numbered investigation plan (3-8 steps). Start your answer with it under a "Plan" heading, then carry it out and give your findings.`
+}
+
+// planOnlyTask asks for an investigation plan without carrying it out
+func planOnlyTask(task string) string {
+	return task + `
+
+Do not investigate yet. Reply only with a short numbered investigation plan (3-8 steps): what you will look at, which tools you will use, and what each step should establish. The caller will review the plan before you carry it out.`
+}
+
+// planApprovedTask tells the model its paused plan was approved, with any adjustments
+func planApprovedTask(task string) string {
+	task = strings.TrimSpace(task)
+	return fmt.Sprintf(`Your investigation plan was approved. Carry it out now and give your findings. The caller's response to the plan, including any adjustments to make:
+
+%s`, task)
+}
+
+// planPausedNote explains how to continue after a paused plan
+const planPausedNote = "\n\n---\nThe analysis is paused for plan approval. To proceed, call deep-analysis again with continue=true in this conversation; the task may approve the plan as-is or describe changes to it."
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lox/deep-analysis-mcp/internal/fileops"
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const maxMatchProgressBytes = 4 * 1024 // Limit matches streamed in one progress notification
+
+// progressNotifierKey carries a request's progress notifier in a context
+type progressNotifierKey struct{}
+
+// progressNotifier sends progress notifications for a request whose client
+// asked for them, counting every notification so progress only increases
+type progressNotifier struct {
+	mu          sync.Mutex
+	token       mcp.ProgressToken
+	progress    int
+	attached    int
+	attachTotal int
+}
+
+// withProgress enables progress notifications when the client sent a
+// progress token: one per attached file of the attachTotal a request
+// attaches, and one per file with matches as grep_files searches
+func (c *DeepAnalysisClient) withProgress(ctx context.Context, request mcp.CallToolRequest, attachTotal int) context.Context {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil || server.ServerFromContext(ctx) == nil {
+		return ctx
+	}
+	p := &progressNotifier{token: request.Params.Meta.ProgressToken, attachTotal: attachTotal}
+	ctx = context.WithValue(ctx, progressNotifierKey{}, p)
+	return fileops.WithMatchReporter(ctx, func(path string, lines []string) {
+		message := fmt.Sprintf("grep_files: %d matches in %s\n%s", len(lines), path, strings.Join(lines, "\n"))
+		message = truncate.Bytes(message, maxMatchProgressBytes, "progress message limit", "The full matches are in the tool result.")
+		p.send(ctx, c.fileOps.RelativizePaths(message), 0)
+	})
+}
+
+// send notifies the client of one more step, with a total when it is known
+func (p *progressNotifier) send(ctx context.Context, message string, total int) {
+	p.mu.Lock()
+	p.progress++
+	params := map[string]any{
+		"progressToken": p.token,
+		"progress":      p.progress,
+		"message":       message,
+	}
+	p.mu.Unlock()
+	if total > 0 {
+		params["total"] = total
+	}
+	if err := server.ServerFromContext(ctx).SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+		logging.Debugf("Failed to send progress notification: %v", err)
+	}
+}
+
+// notifyAttached tells the client another file was read, so interactive
+// clients show the work done before the API call starts. It does nothing
+// without a progress token.
+func notifyAttached(ctx context.Context, path string, size int, readErr error) {
+	p, ok := ctx.Value(progressNotifierKey{}).(*progressNotifier)
+	if !ok || p.attachTotal == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.attached++
+	attached := p.attached
+	p.mu.Unlock()
+	message := fmt.Sprintf("Attached %s (file %d of %d, %d bytes read)", path, attached, p.attachTotal, size)
+	if readErr != nil {
+		message = fmt.Sprintf("Failed to read %s (file %d of %d)", path, attached, p.attachTotal)
+	}
+	p.send(ctx, message, p.attachTotal)
+}
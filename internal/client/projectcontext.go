@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxProjectContextBytes = 64 * 1024 // content kept per project context file
+
+// WithAutoContext attaches the given project files, such as README.md or
+// AGENTS.md, as project context when an analysis starts a conversation.
+// Missing files are skipped.
+func WithAutoContext(paths []string) Option {
+	return func(c *DeepAnalysisClient) {
+		c.autoContext = paths
+	}
+}
+
+// readProjectContext reads the -auto-context files that exist, returning
+// their paths and fenced contents. Each is capped at maxProjectContextBytes.
+func (c *DeepAnalysisClient) readProjectContext(ctx context.Context) ([]string, []string) {
+	var names, parts []string
+	for _, path := range c.autoContext {
+		content, err := c.fileOps.ReadFile(ctx, path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				logging.Debugf("Project context file not present: %s", path)
+			} else {
+				logging.Warnf("Failed to read project context file %s: %v", path, err)
+			}
+			continue
+		}
+		content = truncate.Bytes(content, maxProjectContextBytes, fmt.Sprintf("project context limit of %d bytes", maxProjectContextBytes), "Read the file for the rest.")
+		names = append(names, path)
+		parts = append(parts, formatAttachment(path, content))
+	}
+	return names, parts
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/server"
+)
+
+// bucketSweepInterval is how often buckets of idle clients are dropped; a
+// bucket that has refilled holds no state a new one wouldn't
+const bucketSweepInterval = time.Minute
+
+// conversationLimiter is a token bucket per client, so one client can't
+// monopolize the server: each request takes a token, and tokens refill at a
+// fixed rate up to the burst size. Clients are identified by transport and
+// MCP session rather than the conversation_id they choose, which would let a
+// client dodge its limit, and create buckets without bound, by varying it.
+type conversationLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	maxWait time.Duration
+	buckets map[string]*rateBucket
+	swept   time.Time // when idle buckets were last dropped
+}
+
+// rateBucket is one client's token bucket
+type rateBucket struct {
+	tokens float64 // may go negative while requests wait for reserved tokens
+	last   time.Time
+}
+
+// WithConversationRate limits each client session to perMinute analysis
+// requests across its conversations, allowing bursts of up to burst requests. A request over the limit
+// waits for its turn when that comes within maxWait, and is rejected
+// otherwise. A perMinute of zero disables the limit.
+func WithConversationRate(perMinute float64, burst int, maxWait time.Duration) Option {
+	return func(c *DeepAnalysisClient) {
+		if perMinute <= 0 {
+			c.rateLimiter = nil
+			return
+		}
+		c.rateLimiter = &conversationLimiter{
+			rate:    perMinute / 60,
+			burst:   float64(max(burst, 1)),
+			maxWait: max(maxWait, 0),
+			buckets: make(map[string]*rateBucket),
+		}
+	}
+}
+
+// waitForRate takes a token from the requesting client's bucket, waiting for
+// one if needed
+func (c *DeepAnalysisClient) waitForRate(ctx context.Context) error {
+	if c.rateLimiter == nil {
+		return nil
+	}
+	return c.rateLimiter.wait(ctx, server.ClientFromContext(ctx))
+}
+
+// wait takes a token for key, reserving the next one and sleeping until it
+// refills when the bucket is empty
+func (l *conversationLimiter) wait(ctx context.Context, key string) error {
+	l.mu.Lock()
+	now := time.Now()
+	b := l.bucket(key, now)
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*l.rate, l.burst)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	delay := time.Duration(math.Ceil((1 - b.tokens) / l.rate * float64(time.Second)))
+	if delay > l.maxWait {
+		l.mu.Unlock()
+		logging.Warnf("Client over its rate limit, rejecting request: client=%s retry_in=%s", key, delay.Round(time.Second))
+		return fmt.Errorf("this client is over its rate limit of %g requests per minute; retry in %s", l.rate*60, delay.Round(time.Second))
+	}
+	b.tokens--
+	l.mu.Unlock()
+
+	log.Printf("Client over its rate limit, waiting: client=%s wait=%s", key, delay.Round(time.Millisecond))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Return the reserved token so later requests don't wait for it
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// bucket returns key's bucket, creating a full one if needed. Buckets that
+// have refilled since their client's last request are dropped every
+// bucketSweepInterval. Callers must hold mu.
+func (l *conversationLimiter) bucket(key string, now time.Time) *rateBucket {
+	if now.Sub(l.swept) >= bucketSweepInterval {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	if b, ok := l.buckets[key]; ok {
+		return b
+	}
+	b := &rateBucket{tokens: l.burst, last: now}
+	l.buckets[key] = b
+	return b
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConversationLimiterDropsIdleBuckets(t *testing.T) {
+	l := &conversationLimiter{rate: 1, burst: 2, buckets: make(map[string]*rateBucket)}
+	ctx := context.Background()
+
+	for _, key := range []string{"http:a", "http:b", "http:c"} {
+		if err := l.wait(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(l.buckets) != 3 {
+		t.Fatalf("buckets = %d, want 3", len(l.buckets))
+	}
+
+	// Once the buckets have refilled and a sweep is due, only the active client's remains
+	l.mu.Lock()
+	for _, b := range l.buckets {
+		b.last = b.last.Add(-bucketSweepInterval)
+	}
+	l.swept = l.swept.Add(-bucketSweepInterval)
+	l.mu.Unlock()
+	if err := l.wait(ctx, "http:a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.buckets["http:a"]; len(l.buckets) != 1 || !ok {
+		t.Errorf("buckets after sweep = %v, want only http:a", l.buckets)
+	}
+}
+
+func TestConversationLimiterRejectsOverLimit(t *testing.T) {
+	l := &conversationLimiter{rate: 1.0 / 60, burst: 1, buckets: make(map[string]*rateBucket)}
+	ctx := context.Background()
+
+	if err := l.wait(ctx, "stdio:stdio"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.wait(ctx, "stdio:stdio"); err == nil {
+		t.Error("second request within the minute was allowed")
+	}
+	// Another client has its own bucket
+	if err := l.wait(ctx, "http:other"); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+}
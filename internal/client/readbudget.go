@@ -0,0 +1,53 @@
+package client
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+// readTools are the tools whose output is file content, counted against the
+// per-request read budget
+var readTools = map[string]bool{
+	"read_file":     true,
+	"grep_files":    true,
+	"grep_in_file":  true,
+	"grep_docs":     true,
+	"find_todos":    true,
+	"git_file_diff": true,
+	"diff_dirs":     true,
+	"api_surface":   true,
+}
+
+// readBudget tracks file content returned to the model within one request
+type readBudget struct {
+	limit int64 // 0 means unlimited
+	used  int64
+}
+
+// check refuses a read tool call once the budget is spent
+func (b *readBudget) check(name string) error {
+	if b.limit <= 0 || !readTools[name] || b.used < b.limit {
+		return nil
+	}
+	return fmt.Errorf("the read budget of %d bytes for this request is spent; be selective and conclude from what you have already read", b.limit)
+}
+
+// charge counts a read tool's output against the budget, truncating it to
+// whatever remains
+func (b *readBudget) charge(name, output string) string {
+	if !readTools[name] {
+		return output
+	}
+	if remaining := b.limit - b.used; b.limit > 0 && int64(len(output)) > remaining {
+		cut := int(remaining)
+		for cut > 0 && !utf8.RuneStart(output[cut]) {
+			cut--
+		}
+		b.used = b.limit
+		return output[:cut] + "\n" + truncate.Marker(fmt.Sprintf("the read budget of %d bytes for this request is now spent", b.limit), fmt.Sprintf("%d bytes", len(output)-cut), "Conclude from what you have read.")
+	}
+	b.used += int64(len(output))
+	return output
+}
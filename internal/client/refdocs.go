@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	maxReferenceDocs  = 10         // reference documents accepted per request
+	maxReferenceBytes = 256 * 1024 // content kept per reference document
+	docFetchTimeout   = 30 * time.Second
+)
+
+var (
+	htmlDropped = regexp.MustCompile(`(?is)<(script|style|noscript|svg|head)\b.*?</(script|style|noscript|svg|head)\s*>`)
+	htmlBreaks  = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6]|/pre|/section|/article)\b[^>]*>`)
+	htmlTags    = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines  = regexp.MustCompile(`\n[ \t]*(\n[ \t]*)+`)
+)
+
+// WithDocURLs lets the docs argument fetch http(s) URLs as well as read files
+func WithDocURLs(enabled bool) Option {
+	return func(c *DeepAnalysisClient) {
+		c.allowDocURLs = enabled
+	}
+}
+
+// readReferenceDocs reads reference documentation from files or, when
+// allowed, URLs. Each document is capped at maxReferenceBytes; failures are
+// recorded in place of the content, as for attachments.
+func (c *DeepAnalysisClient) readReferenceDocs(ctx context.Context, docs []string) []string {
+	if len(docs) == 0 {
+		return nil
+	}
+	log.Printf("Reading %d reference documents", len(docs))
+	parts := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		var content string
+		var err error
+		if isDocURL(doc) {
+			content, err = c.fetchDoc(ctx, doc)
+		} else {
+			content, err = c.fileOps.ReadFile(ctx, doc)
+		}
+		if err != nil {
+			logging.Warnf("Failed to read reference document %s: %v", doc, err)
+			parts = append(parts, fmt.Sprintf("Document: %s\nError: %v\n", doc, err))
+			continue
+		}
+		logging.Debugf("Read reference document: %s (%d bytes)", doc, len(content))
+		content = truncate.Bytes(content, maxReferenceBytes, fmt.Sprintf("reference document limit of %d bytes", maxReferenceBytes), "")
+		parts = append(parts, fmt.Sprintf("Document: %s\n%s\n", doc, fenceBlock(content, fenceLanguage(doc))))
+	}
+	return parts
+}
+
+// isDocURL reports whether a docs entry is an http(s) URL rather than a path
+func isDocURL(doc string) bool {
+	lower := strings.ToLower(doc)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// fetchDoc downloads a reference document, reducing HTML pages to their text
+func (c *DeepAnalysisClient) fetchDoc(ctx context.Context, url string) (string, error) {
+	if !c.allowDocURLs {
+		return "", fmt.Errorf("fetching URLs is disabled; start the server with -allow-doc-urls or pass a file path")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, docFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	req.Header.Set("Accept", "text/plain, text/markdown, text/html;q=0.9, */*;q=0.5")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch: %s", resp.Status)
+	}
+
+	// Read a little past the cap so HTML still has text left once tags are stripped
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4*maxReferenceBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	content := string(body)
+	if strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "html") {
+		content = htmlText(content)
+	}
+	return content, nil
+}
+
+// htmlText roughly reduces an HTML page to its readable text
+func htmlText(page string) string {
+	page = htmlDropped.ReplaceAllString(page, "")
+	page = htmlBreaks.ReplaceAllString(page, "\n")
+	page = html.UnescapeString(htmlTags.ReplaceAllString(page, ""))
+	return strings.TrimSpace(blankLines.ReplaceAllString(page, "\n\n"))
+}
+
+// fitDocuments drops supplementary documents, largest first, until the prompt
+// built from them fits the context window, so that they are trimmed before any
+// attached code. kind names the documents in the warning, which lists those
+// dropped.
+func (c *DeepAnalysisClient) fitDocuments(history int64, kind string, names, parts []string, build func([]string) string) ([]string, string) {
+	limit := c.contextLimit(c.model)
+	system := estimateTokens(c.systemPrompt)
+	if len(parts) == 0 || system+history+estimateTokens(build(parts)) <= limit {
+		return parts, ""
+	}
+
+	kept := append([]string(nil), parts...)
+	var dropped []string
+	for _, i := range largestFirst(parts) {
+		if system+history+estimateTokens(build(kept)) <= limit {
+			break
+		}
+		kept[i] = fmt.Sprintf("Document: %s\n%s\n", names[i], truncate.Marker("too large for the context window alongside the rest of the prompt", fmt.Sprintf("all ~%d tokens", estimateTokens(parts[i])), ""))
+		dropped = append(dropped, names[i])
+	}
+	logging.Warnf("Dropped %d %s to fit the context window", len(dropped), kind)
+	return kept, fmt.Sprintf("%d %s were dropped to fit the context window: %s", len(dropped), kind, strings.Join(dropped, ", "))
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const maxVerifiedReferences = 100 // Limit file references checked per answer
+
+// referencePattern matches path:line and path:start-end references such as
+// internal/client/deepanalysis.go:42. The path must have an extension and
+// start a word, which excludes host:port pairs inside URLs.
+var referencePattern = regexp.MustCompile(`(?:^|[\s(\[` + "`" + `"'])((?:~/|\.{1,2}/|/)?[\w.\-/]*\w\.[A-Za-z0-9]+):(\d+)(?:-(\d+))?`)
+
+// fileReference is a path:line reference found in an answer
+type fileReference struct {
+	text string
+	path string
+	line int
+}
+
+// verifyReferences checks path:line references in the answer against the
+// filesystem and appends a warning listing any that don't resolve
+func (c *DeepAnalysisClient) verifyReferences(ctx context.Context, result *mcp.CallToolResult) {
+	if len(result.Content) == 0 {
+		return
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		return
+	}
+
+	refs := findReferences(text.Text)
+	log.Printf("Verifying %d file references", len(refs))
+
+	lineCounts := make(map[string]int)
+	var problems []string
+	for _, ref := range refs {
+		if problem := c.checkReference(ctx, ref, lineCounts); problem != "" {
+			problems = append(problems, fmt.Sprintf("- `%s`: %s", ref.text, problem))
+		}
+	}
+
+	if len(problems) == 0 {
+		return
+	}
+
+	log.Printf("Found %d unresolved file references", len(problems))
+	text.Text += fmt.Sprintf("\n\n---\n**Warning:** %d file references in this answer could not be verified and may be inaccurate:\n%s", len(problems), strings.Join(problems, "\n"))
+	result.Content[0] = text
+}
+
+// checkReference returns why a reference doesn't resolve, or "" when it does
+// or can't be checked. lineCounts caches file line counts across calls.
+func (c *DeepAnalysisClient) checkReference(ctx context.Context, ref fileReference, lineCounts map[string]int) string {
+	count, seen := lineCounts[ref.path]
+	if !seen {
+		content, err := c.fileOps.ReadFile(ctx, ref.path)
+		switch {
+		case err == nil:
+			count = strings.Count(content, "\n")
+			if content != "" && !strings.HasSuffix(content, "\n") {
+				count++
+			}
+		case errors.Is(err, fs.ErrNotExist):
+			count = -1
+		default:
+			// Unreadable (too large, outside roots, ...) so we can't verify it
+			logging.Warnf("Cannot verify reference %s: %v", ref.text, err)
+			count = -2
+		}
+		lineCounts[ref.path] = count
+	}
+
+	switch {
+	case count == -1:
+		return "file does not exist"
+	case count >= 0 && ref.line > count:
+		return fmt.Sprintf("file has only %d lines", count)
+	default:
+		return ""
+	}
+}
+
+// findReferences extracts unique path:line references from text
+func findReferences(text string) []fileReference {
+	var refs []fileReference
+	seen := make(map[string]bool)
+	for _, m := range referencePattern.FindAllStringSubmatchIndex(text, -1) {
+		path := text[m[2]:m[3]]
+		lineText := text[m[4]:m[5]]
+		line, err := strconv.Atoi(lineText)
+		if err != nil || line == 0 {
+			continue
+		}
+		// Check the end of a range rather than the start
+		refText := path + ":" + lineText
+		if m[6] >= 0 {
+			end, err := strconv.Atoi(text[m[6]:m[7]])
+			if err == nil && end > line {
+				line = end
+			}
+			refText += "-" + text[m[6]:m[7]]
+		}
+		if seen[refText] {
+			continue
+		}
+		seen[refText] = true
+		refs = append(refs, fileReference{text: refText, path: path, line: line})
+		if len(refs) >= maxVerifiedReferences {
+			break
+		}
+	}
+	return refs
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// repeatTracker remembers the results of the tool calls made during one
+// analysis, so an identical call is answered with the earlier result instead
+// of being run again. A model stuck re-issuing the same call is asked to
+// conclude once it has repeated it limit times.
+type repeatTracker struct {
+	limit   int // 0 disables deduplication
+	results map[string]string
+	repeats map[string]int
+}
+
+// newRepeatTracker creates an empty per-request tracker
+func newRepeatTracker(limit int) *repeatTracker {
+	return &repeatTracker{limit: limit, results: make(map[string]string), repeats: make(map[string]int)}
+}
+
+// repeated returns the earlier result of an identical call with a note
+// discouraging the repeat, and whether the model should now be made to
+// conclude. ok is false when the call hasn't been made before.
+func (t *repeatTracker) repeated(name, argsJSON string) (result string, ok, conclude bool) {
+	if t.limit == 0 || scratchTools[name] {
+		return "", false, false
+	}
+	key := repeatKey(name, argsJSON)
+	earlier, ok := t.results[key]
+	if !ok {
+		return "", false, false
+	}
+	t.repeats[key]++
+	n := t.repeats[key]
+	if n >= t.limit {
+		return earlier + fmt.Sprintf("\n\nNote: you have now repeated this identical %s call %d times, and it returns the same result each time. Stop calling tools and conclude with the evidence you have gathered.", name, n), true, true
+	}
+	return earlier + fmt.Sprintf("\n\nNote: this %s call is identical to an earlier one in this analysis, so its earlier result is repeated above instead of running it again. Don't repeat calls: use this result, or change the arguments to learn something new.", name), true, false
+}
+
+// record keeps a call's result for later identical calls
+func (t *repeatTracker) record(name, argsJSON, result string) {
+	if t.limit == 0 || scratchTools[name] {
+		return
+	}
+	t.results[repeatKey(name, argsJSON)] = result
+}
+
+// repeatKey identifies a call by tool and arguments, re-marshalling the
+// arguments so field order and spacing don't matter
+func repeatKey(name, argsJSON string) string {
+	var args any
+	if err := json.Unmarshal([]byte(argsJSON), &args); err == nil {
+		if canonical, err := json.Marshal(args); err == nil {
+			argsJSON = string(canonical)
+		}
+	}
+	return name + ":" + argsJSON
+}
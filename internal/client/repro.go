@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// reproCase is a minimal reproduction in a form a user can apply directly
+type reproCase struct {
+	Summary string `json:"summary"`
+	Files   []struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	} `json:"files"`
+	Commands []string `json:"commands"`
+	Expected string   `json:"expected"`
+	Actual   string   `json:"actual"`
+}
+
+// reproCaseSchema is the strict JSON schema for reproCase
+var reproCaseSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"summary": map[string]any{
+			"type":        "string",
+			"description": "One sentence describing what the reproduction demonstrates",
+		},
+		"files": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":    map[string]any{"type": "string"},
+					"content": map[string]any{"type": "string"},
+				},
+				"required":             []string{"path", "content"},
+				"additionalProperties": false,
+			},
+		},
+		"commands": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+		"expected": map[string]any{"type": "string"},
+		"actual":   map[string]any{"type": "string"},
+	},
+	"required":             []string{"summary", "files", "commands", "expected", "actual"},
+	"additionalProperties": false,
+}
+
+// reproTask is the specialized prompt for turning a bug report into a repro
+const reproTask = `Turn the bug report below into a minimal, self-contained reproduction.
+
+Investigate the relevant code first so the reproduction exercises the real failure, not a guess. Then give:
+1. The files to create, each with its path and complete contents. Keep them as small as possible: remove everything not needed to trigger the bug.
+2. The exact commands to run, in order, from the directory the files are created in.
+3. The expected behaviour and the actual (buggy) behaviour the commands show.
+
+If the bug can't be reproduced in isolation, say why and give the smallest reproduction within the existing project instead.
+
+Bug report:
+%s`
+
+// HandleMinimalRepro asks the model for a minimal reproduction of a bug report
+// and returns it as structured files and commands alongside the prose
+func (c *DeepAnalysisClient) HandleMinimalRepro(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	ctx, meter := withUsageMeter(ctx)
+	defer func() { c.reportUsage(result, meter) }()
+	started := time.Now()
+	report, err := request.RequireString("bug_report")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := checkStringLists(request, []string{"files"}); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	files := request.GetStringSlice("files", nil)
+	reproContext := request.GetString("context", "")
+	conversationID := c.conversationKey(ctx, request.GetString("conversation_id", ""))
+	if err := c.waitForRate(ctx); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if len(files) > c.maxAttached {
+		return mcp.NewToolResultError(fmt.Sprintf("Too many attached files: %d (max %d). Attach the most relevant files and let the analysis discover the rest.", len(files), c.maxAttached)), nil
+	}
+
+	log.Printf("Building minimal repro: report_len=%d files=%d", len(report), len(files))
+
+	result = c.analyze(ctx, analysis{
+		prompt:               buildPrompt(fmt.Sprintf(reproTask, report), "", reproContext, "", "", "", joinStrings(c.readAttachments(ctx, files), "\n")),
+		conversationID:       conversationID,
+		continueConversation: false,
+		budget:               c.reasoningBudget,
+		started:              started,
+	})
+	if result.IsError {
+		return result, nil
+	}
+
+	// Restate the repro as files and commands the caller can apply directly
+	raw, err := c.extractJSON(ctx, resultText(result), "minimal_repro", "Extract the reproduction from the answer below: every file to create with its full contents, the commands to run in order, and the expected and actual behaviour. Copy file contents and commands exactly; do not invent any.", reproCaseSchema)
+	if err != nil {
+		logging.Warnf("Repro extraction failed: %v", err)
+		return result, nil
+	}
+	var repro reproCase
+	if err := json.Unmarshal([]byte(raw), &repro); err != nil {
+		logging.Warnf("Repro was not valid JSON: %v", err)
+		return result, nil
+	}
+
+	result.StructuredContent = repro
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Reproduction:\n```json\n%s\n```", raw)))
+	return result, nil
+}
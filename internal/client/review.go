@@ -0,0 +1,356 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// hunkHeader matches a unified diff hunk header such as @@ -10,7 +12,9 @@
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// diffFile is a file changed by a unified diff
+type diffFile struct {
+	path   string
+	status string   // modified, added, deleted or renamed
+	hunks  []string // new-file line ranges, e.g. 12-20
+}
+
+// defaultReviewMaxFiles is the number of files summarized individually in a per-file review
+const defaultReviewMaxFiles = 50
+
+// fileReview is a per-file review of a large diff, shaped so a CI job can post one comment per file
+type fileReview struct {
+	Files []struct {
+		Path     string `json:"path"`
+		Intent   string `json:"intent"`
+		Risk     string `json:"risk"`
+		Findings []struct {
+			Line        int    `json:"line"`
+			Severity    string `json:"severity"`
+			Description string `json:"description"`
+		} `json:"findings"`
+	} `json:"files"`
+	Overall struct {
+		Verdict string `json:"verdict"`
+		Summary string `json:"summary"`
+	} `json:"overall"`
+}
+
+// fileReviewSchema is the strict JSON schema for fileReview
+var fileReviewSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"files": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":   map[string]any{"type": "string"},
+					"intent": map[string]any{"type": "string", "description": "What the change to this file is for"},
+					"risk":   map[string]any{"type": "string", "enum": []string{"low", "medium", "high"}},
+					"findings": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"line": map[string]any{"type": "integer", "description": "Line in the new version of the file, 0 if none applies"},
+								"severity": map[string]any{
+									"type": "string",
+									"enum": []string{"critical", "high", "medium", "low"},
+								},
+								"description": map[string]any{"type": "string"},
+							},
+							"required":             []string{"line", "severity", "description"},
+							"additionalProperties": false,
+						},
+					},
+				},
+				"required":             []string{"path", "intent", "risk", "findings"},
+				"additionalProperties": false,
+			},
+		},
+		"overall": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"verdict": map[string]any{
+					"type": "string",
+					"enum": []string{"approve", "approve with nits", "request changes"},
+				},
+				"summary": map[string]any{"type": "string"},
+			},
+			"required":             []string{"verdict", "summary"},
+			"additionalProperties": false,
+		},
+	},
+	"required":             []string{"files", "overall"},
+	"additionalProperties": false,
+}
+
+// HandleReviewDiff runs a code review over a unified diff, optionally
+// attaching the full contents of the changed files for context
+func (c *DeepAnalysisClient) HandleReviewDiff(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	ctx, meter := withUsageMeter(ctx)
+	defer func() { c.reportUsage(result, meter) }()
+	started := time.Now()
+	diff := request.GetString("diff", "")
+	diffPath := request.GetString("diff_path", "")
+	includeFiles := request.GetBool("include_files", true)
+	perFile := request.GetBool("per_file", false)
+	maxFiles := request.GetInt("max_files", defaultReviewMaxFiles)
+	reviewContext := request.GetString("context", "")
+	conversationID := c.conversationKey(ctx, request.GetString("conversation_id", ""))
+	if err := c.waitForRate(ctx); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if (diff == "") == (diffPath == "") {
+		return mcp.NewToolResultError("Provide exactly one of diff or diff_path"), nil
+	}
+	if diffPath != "" {
+		content, err := c.fileOps.ReadFile(ctx, diffPath)
+		if err != nil {
+			logging.Errorf("Failed to read diff: %v", err)
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read diff: %v", err)), nil
+		}
+		diff = content
+	}
+
+	files := parseDiff(diff)
+	if len(files) == 0 {
+		return mcp.NewToolResultError("No changed files found: expected a unified diff (e.g. from git diff)"), nil
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultReviewMaxFiles
+	}
+	log.Printf("Reviewing diff: files=%d diff_len=%d include_files=%v per_file=%v", len(files), len(diff), includeFiles, perFile)
+
+	// Attach the current version of changed files, up to the attachment limit
+	var paths, omitted []string
+	if includeFiles {
+		for _, f := range files {
+			if f.status == "deleted" {
+				continue
+			}
+			if len(paths) >= c.maxAttached {
+				omitted = append(omitted, f.path)
+				continue
+			}
+			paths = append(paths, f.path)
+		}
+	}
+
+	var summary []string
+	for _, f := range files {
+		line := fmt.Sprintf("- %s (%s)", f.path, f.status)
+		if len(f.hunks) > 0 {
+			line += ": lines " + strings.Join(f.hunks, ", ")
+		}
+		summary = append(summary, line)
+	}
+
+	var task string
+	if perFile {
+		task = perFileReviewTask(summary, maxFiles)
+	} else {
+		task = fmt.Sprintf(`Review the changes in this diff as a careful senior reviewer would before merge.
+
+Changed files (line ranges are in the new version):
+%s
+
+The diff is under "Context". Look for bugs, regressions, missing error handling, concurrency and security problems, and gaps in tests or docs. Use your tools to check callers and related code rather than judging the diff in isolation.
+
+Report each finding on its own line as `+"`path:line`"+` — severity (critical, high, medium, low) — description, using line numbers from the new version of the file. Finish with an overall verdict: approve, approve with nits, or request changes. If there are no problems, say so.`, strings.Join(summary, "\n"))
+	}
+	if len(omitted) > 0 {
+		task += "\n\n" + truncate.Marker(fmt.Sprintf("attachment limit of %d files", c.maxAttached), fmt.Sprintf("%d changed files", len(omitted)), "Read them with your tools if they matter:") + "\n" + strings.Join(omitted, "\n")
+	}
+
+	diffSection := fenceBlock(strings.TrimRight(diff, "\n"), "diff")
+	if reviewContext != "" {
+		diffSection = reviewContext + "\n\n" + diffSection
+	}
+
+	result = c.analyze(ctx, analysis{
+		prompt:               buildPrompt(task, "", diffSection, "", "", "", joinStrings(c.readAttachments(ctx, paths), "\n")),
+		conversationID:       conversationID,
+		continueConversation: false,
+		budget:               c.reasoningBudget,
+		started:              started,
+	})
+
+	// Flag file references in the review that don't exist
+	if c.verifyRefs && !result.IsError {
+		c.verifyReferences(ctx, result)
+	}
+	if perFile && !result.IsError {
+		c.addFileReview(ctx, result)
+	}
+	return result, nil
+}
+
+// perFileReviewTask is the review prompt for large diffs, which asks for a
+// separate section per changed file followed by an overall assessment
+func perFileReviewTask(summary []string, maxFiles int) string {
+	listed := summary
+	var rest []string
+	if len(summary) > maxFiles {
+		listed, rest = summary[:maxFiles], summary[maxFiles:]
+	}
+	task := fmt.Sprintf(`Review the changes in this diff file by file, as a careful senior reviewer would before merge.
+
+Changed files to review individually (line ranges are in the new version):
+%s
+
+The diff is under "Context". For each file above, in order, write a section headed with its path that gives:
+1. Intent: what the change to this file is for, in one or two sentences
+2. Risk: low, medium or high, with a short reason
+3. Findings: each on its own line as `+"`path:line`"+` — severity (critical, high, medium, low) — description, using line numbers from the new version of the file, or "None"
+
+Look for bugs, regressions, missing error handling, concurrency and security problems, and gaps in tests or docs. Use your tools to check callers and related code rather than judging each file in isolation; a finding that spans files belongs to the file where the fix goes.
+
+Finish with an overall assessment across all files: the main risks, how the files fit together, and a verdict of approve, approve with nits, or request changes.`, strings.Join(listed, "\n"))
+	if len(rest) > 0 {
+		task += fmt.Sprintf("\n\nThese %d further changed files are over the limit of %d files reviewed individually; cover them only in the overall assessment:\n%s", len(rest), maxFiles, strings.Join(rest, "\n"))
+	}
+	return task
+}
+
+// addFileReview restates a per-file review as structured JSON, one entry per
+// file, so CI can post a comment per file
+func (c *DeepAnalysisClient) addFileReview(ctx context.Context, result *mcp.CallToolResult) {
+	raw, err := c.extractJSON(ctx, resultText(result), "file_review", "Extract the per-file code review below: for each file section, its path, intent, risk and findings (line in the new version, 0 if none is given), then the overall verdict and a summary of the overall assessment. Copy findings faithfully; do not invent any.", fileReviewSchema)
+	if err != nil {
+		logging.Warnf("Per-file review extraction failed: %v", err)
+		return
+	}
+	var review fileReview
+	if err := json.Unmarshal([]byte(raw), &review); err != nil {
+		logging.Warnf("Per-file review was not valid JSON: %v", err)
+		return
+	}
+
+	result.StructuredContent = review
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Per-file review:\n```json\n%s\n```", raw)))
+}
+
+// parseDiff extracts changed files and their new-file hunk ranges from a unified diff
+func parseDiff(diff string) []diffFile {
+	var files []diffFile
+	var current *diffFile
+	var oldPath string
+	oldLeft, newLeft := 0, 0 // lines remaining in the current hunk
+
+	for _, line := range strings.Split(diff, "\n") {
+		// Inside a hunk every line is content, even one that looks like a header
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			case strings.HasPrefix(line, `\`):
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files = append(files, diffFile{status: "modified"})
+			current = &files[len(files)-1]
+			// Fall back to the b/ path when there are no ---/+++ lines (e.g. binary or mode-only changes)
+			if i := strings.LastIndex(line, " b/"); i >= 0 {
+				current.path = line[i+3:]
+			}
+		case strings.HasPrefix(line, "--- "):
+			oldPath = diffPath(line[4:])
+		case strings.HasPrefix(line, "+++ "):
+			// Plain diffs without a diff --git line start the file here
+			if current == nil || len(current.hunks) > 0 {
+				files = append(files, diffFile{status: "modified"})
+				current = &files[len(files)-1]
+			}
+			newPath := diffPath(line[4:])
+			switch {
+			case newPath == "/dev/null":
+				current.status = "deleted"
+				current.path = oldPath
+			case oldPath == "/dev/null":
+				current.status = "added"
+				current.path = newPath
+			default:
+				if current.status == "modified" && oldPath != "" && oldPath != newPath {
+					current.status = "renamed"
+				}
+				current.path = newPath
+			}
+		case strings.HasPrefix(line, "new file mode") && current != nil:
+			current.status = "added"
+		case strings.HasPrefix(line, "deleted file mode") && current != nil:
+			current.status = "deleted"
+		case strings.HasPrefix(line, "rename to ") && current != nil:
+			current.status = "renamed"
+			current.path = strings.TrimPrefix(line, "rename to ")
+		case current != nil:
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			oldLeft = hunkCount(m[1])
+			newLeft = hunkCount(m[3])
+			start, _ := strconv.Atoi(m[2])
+			switch newLeft {
+			case 0:
+				current.hunks = append(current.hunks, fmt.Sprintf("removed after %d", start))
+			case 1:
+				current.hunks = append(current.hunks, strconv.Itoa(start))
+			default:
+				current.hunks = append(current.hunks, fmt.Sprintf("%d-%d", start, start+newLeft-1))
+			}
+		}
+	}
+
+	// Drop entries that never named a file
+	valid := files[:0]
+	for _, f := range files {
+		if f.path != "" {
+			valid = append(valid, f)
+		}
+	}
+	return valid
+}
+
+// hunkCount parses a hunk header line count, which defaults to 1 when omitted
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// diffPath strips the a/ or b/ prefix and any trailing timestamp from a ---/+++ path
+func diffPath(path string) string {
+	if i := strings.IndexByte(path, '\t'); i >= 0 {
+		path = path[:i]
+	}
+	if path == "/dev/null" {
+		return path
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
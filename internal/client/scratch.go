@@ -0,0 +1,151 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	maxScratchBytes  = 64 * 1024 // keys plus values held per conversation
+	maxScratchKeyLen = 128
+)
+
+// scratchTools are the tools backed by the conversation's scratchpad rather
+// than executeFunction
+var scratchTools = map[string]bool{
+	"scratch_write": true,
+	"scratch_read":  true,
+}
+
+// scratchpad is the model's working memory within a conversation: notes it
+// keeps between iterations and turns instead of re-deriving them
+type scratchpad struct {
+	entries map[string]string
+	size    int // bytes of keys plus values
+}
+
+// write stores value under key, replacing any previous value; an empty value
+// deletes the key. The total size is bounded by maxScratchBytes.
+func (p *scratchpad) write(key, value string) error {
+	if key == "" || len(key) > maxScratchKeyLen {
+		return fmt.Errorf("scratchpad keys must be 1-%d bytes", maxScratchKeyLen)
+	}
+	old, exists := p.entries[key]
+	size := p.size
+	if exists {
+		size -= len(key) + len(old)
+	}
+	if value == "" {
+		delete(p.entries, key)
+		p.size = size
+		return nil
+	}
+	if size+len(key)+len(value) > maxScratchBytes {
+		return fmt.Errorf("scratchpad full: %d of %d bytes used, and %q needs %d; shorten the note or delete stale keys by writing an empty value", p.size, maxScratchBytes, key, len(key)+len(value))
+	}
+	if p.entries == nil {
+		p.entries = make(map[string]string)
+	}
+	p.entries[key] = value
+	p.size = size + len(key) + len(value)
+	return nil
+}
+
+// read returns the note under key, or lists every key when key is empty
+func (p *scratchpad) read(key string) (string, error) {
+	if key != "" {
+		value, ok := p.entries[key]
+		if !ok {
+			return "", fmt.Errorf("no scratchpad entry %q; keys: %s", key, p.keyList())
+		}
+		return value, nil
+	}
+	if len(p.entries) == 0 {
+		return "The scratchpad is empty", nil
+	}
+	lines := []string{fmt.Sprintf("Scratchpad: %d entries, %d of %d bytes used", len(p.entries), p.size, maxScratchBytes)}
+	for _, k := range slices.Sorted(maps.Keys(p.entries)) {
+		lines = append(lines, fmt.Sprintf("- %s (%d bytes)", k, len(p.entries[k])))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// keyList names the scratchpad's keys for error messages
+func (p *scratchpad) keyList() string {
+	if len(p.entries) == 0 {
+		return "none"
+	}
+	return strings.Join(slices.Sorted(maps.Keys(p.entries)), ", ")
+}
+
+// clone copies a scratchpad so that writes to it leave the original unchanged
+func (p scratchpad) clone() scratchpad {
+	return scratchpad{entries: maps.Clone(p.entries), size: p.size}
+}
+
+// scratchSession routes a request's scratchpad tool calls to its conversation,
+// or for an ephemeral turn to a private copy that is discarded afterwards
+type scratchSession struct {
+	c              *DeepAnalysisClient
+	conversationID string      // "" for an ephemeral turn
+	local          *scratchpad // copy used by an ephemeral turn
+}
+
+// newScratchSession starts the scratchpad session of one analysis. storeID is
+// empty for an ephemeral turn, which reads conversationID's notes but can't change them.
+func (c *DeepAnalysisClient) newScratchSession(storeID, conversationID string) *scratchSession {
+	if storeID != "" {
+		return &scratchSession{c: c, conversationID: storeID}
+	}
+	local := c.conv.scratchCopy(conversationID)
+	return &scratchSession{c: c, local: &local}
+}
+
+// execute runs a scratch_write or scratch_read call
+func (s *scratchSession) execute(name, argsJSON string) (string, error) {
+	var args struct {
+		Key   *string `json:"key"`
+		Value string  `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	var key string
+	if args.Key != nil {
+		key = *args.Key
+	}
+
+	var result string
+	var err error
+	s.update(func(pad *scratchpad) {
+		if name == "scratch_read" {
+			result, err = pad.read(key)
+			return
+		}
+		if err = pad.write(key, args.Value); err != nil {
+			return
+		}
+		if args.Value == "" {
+			result = fmt.Sprintf("Deleted %q (%d of %d bytes used)", key, pad.size, maxScratchBytes)
+		} else {
+			result = fmt.Sprintf("Saved %q (%d of %d bytes used)", key, pad.size, maxScratchBytes)
+		}
+	})
+	return result, err
+}
+
+// update applies fn to the session's scratchpad, holding the conversation's
+// lock. Changes are saved with the turn by recordTurn.
+func (s *scratchSession) update(fn func(*scratchpad)) {
+	if s.local != nil {
+		fn(s.local)
+		return
+	}
+	s.c.conv.update(s.conversationID, func(sh *conversationShard) bool {
+		fn(&sh.conversation(s.conversationID).scratch)
+		return false
+	})
+}
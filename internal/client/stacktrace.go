@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	maxTraceFrames     = 15 // Limit frames whose source is attached
+	traceContextLines  = 6  // Source lines shown either side of a frame
+	maxStackTraceBytes = 256 * 1024
+)
+
+var (
+	// goFrameFile matches the file:line line of a Go stack frame, e.g. "\t/src/app/main.go:42 +0x1d"
+	goFrameFile = regexp.MustCompile(`^\s+(\S+\.go):(\d+)(?:\s|$)`)
+	// pythonFrame matches a Python traceback frame, e.g. `File "app/main.py", line 42, in handler`
+	pythonFrame = regexp.MustCompile(`^\s*File "([^"]+)", line (\d+)(?:, in (\S+))?`)
+	// jsFrame matches a JavaScript stack frame, e.g. "at handler (src/app.js:42:7)" or "at src/app.js:42:7"
+	jsFrame = regexp.MustCompile(`^\s*at (?:(?:async )?(\S+) \()?(?:file://)?([^()\s]+?):(\d+):\d+\)?\s*$`)
+)
+
+// stackFrame is a source location parsed from a stack trace
+type stackFrame struct {
+	function string
+	path     string
+	line     int
+}
+
+// stackTraceTask is the prompt for correlating a stack trace with source
+const stackTraceTask = `Analyze the stack trace under "Context" against the source code. The source around each frame that could be read locally is under "Attached Files", with the frame's line marked ">".
+
+Explain:
+1. The likely failure point: the frame and line where things actually go wrong, which may be above or below the frame that panicked or threw
+2. Why it fails there, walking through the relevant frames with the code as evidence
+3. What inputs or state lead to it
+4. How to fix it
+
+Read further code with your tools where the attached excerpts aren't enough. Note that Go and JavaScript list the innermost frame first, while Python lists it last.`
+
+// parseStackTrace extracts frames from a Go, Python or JavaScript stack trace
+func parseStackTrace(trace string) []stackFrame {
+	var frames []stackFrame
+	seen := make(map[string]bool)
+	add := func(function, path, lineText string) {
+		line, err := strconv.Atoi(lineText)
+		if err != nil || line == 0 {
+			return
+		}
+		key := path + ":" + lineText
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		frames = append(frames, stackFrame{function: function, path: path, line: line})
+	}
+
+	lines := strings.Split(trace, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if m := goFrameFile.FindStringSubmatch(line); m != nil {
+			// The function is on the preceding line, e.g. "main.handler(0x1, 0x2)"
+			function := ""
+			if i > 0 {
+				function = strings.TrimSpace(lines[i-1])
+				if idx := strings.LastIndex(function, "("); idx > 0 {
+					function = function[:idx]
+				}
+			}
+			add(function, m[1], m[2])
+		} else if m := pythonFrame.FindStringSubmatch(line); m != nil {
+			add(m[3], m[1], m[2])
+		} else if m := jsFrame.FindStringSubmatch(line); m != nil {
+			add(m[1], m[2], m[3])
+		}
+	}
+	return frames
+}
+
+// frameExcerpt returns the numbered source lines around a frame, marking the frame's line
+func frameExcerpt(content string, line int) (string, bool) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if line > len(lines) {
+		return "", false
+	}
+	start := max(line-traceContextLines, 1)
+	end := min(line+traceContextLines, len(lines))
+	width := len(strconv.Itoa(end))
+
+	var b strings.Builder
+	for n := start; n <= end; n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, n, lines[n-1])
+	}
+	return b.String(), true
+}
+
+// HandleAnalyzeStackTrace parses a stack trace, attaches the source around its
+// frames, and runs an analysis correlating the trace with the code
+func (c *DeepAnalysisClient) HandleAnalyzeStackTrace(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	ctx, meter := withUsageMeter(ctx)
+	defer func() { c.reportUsage(result, meter) }()
+	started := time.Now()
+	trace, err := request.RequireString("stack_trace")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(trace) > maxStackTraceBytes {
+		return mcp.NewToolResultError(fmt.Sprintf("Stack trace too large (%d bytes, max %d bytes): trim it to the failing goroutine or exception", len(trace), maxStackTraceBytes)), nil
+	}
+	extraContext := request.GetString("context", "")
+	conversationID := c.conversationKey(ctx, request.GetString("conversation_id", ""))
+	if err := c.waitForRate(ctx); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	frames := parseStackTrace(trace)
+	if len(frames) == 0 {
+		return mcp.NewToolResultError("No file:line frames found: expected a Go, Python or JavaScript stack trace"), nil
+	}
+	log.Printf("Analyzing stack trace: frames=%d", len(frames))
+
+	// Attach source for the first frames that resolve locally
+	var parts, missing []string
+	contents := make(map[string]string)
+	for _, frame := range frames {
+		if len(parts) >= maxTraceFrames {
+			break
+		}
+		content, ok := contents[frame.path]
+		if !ok {
+			content, err = c.fileOps.ReadFile(ctx, frame.path)
+			if err != nil {
+				logging.Warnf("Stack frame source unavailable: %s: %v", frame.path, err)
+				content = ""
+			}
+			contents[frame.path] = content
+		}
+		excerpt, ok := frameExcerpt(content, frame.line)
+		if content == "" || !ok {
+			missing = append(missing, fmt.Sprintf("%s:%d", frame.path, frame.line))
+			continue
+		}
+		label := fmt.Sprintf("%s:%d", frame.path, frame.line)
+		if frame.function != "" {
+			label = fmt.Sprintf("%s (%s)", label, frame.function)
+		}
+		parts = append(parts, fmt.Sprintf("Frame: %s\n%s\n", label, fenceBlock(excerpt, fenceLanguage(frame.path))))
+	}
+
+	traceContext := fenceBlock(trace, "")
+	if extraContext != "" {
+		traceContext = extraContext + "\n\n" + traceContext
+	}
+	if len(missing) > maxTraceFrames {
+		missing = append(missing[:maxTraceFrames], fmt.Sprintf("and %d more", len(missing)-maxTraceFrames))
+	}
+	if len(missing) > 0 {
+		traceContext += "\n\nFrames without local source (outside the allowed roots, from another machine, or from the standard library): " + strings.Join(missing, ", ")
+	}
+
+	result = c.analyze(ctx, analysis{
+		prompt:               buildPrompt(stackTraceTask, "", traceContext, "", "", "", joinStrings(parts, "\n")),
+		conversationID:       conversationID,
+		continueConversation: false,
+		budget:               c.reasoningBudget,
+		started:              started,
+	})
+	return result, nil
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+)
+
+// ConversationStore persists conversation state beyond the in-memory store,
+// so continue=true keeps working across server restarts. Conversations are
+// loaded from it at startup and written through to it at turn boundaries.
+type ConversationStore interface {
+	Get(conversationID string) (ConversationState, bool, error)
+	Set(conversationID string, state ConversationState) error
+	Delete(conversationID string) error
+	List() ([]string, error)
+}
+
+// ConversationState is the persisted form of a conversation
+type ConversationState struct {
+	ResponseID      string            `json:"response_id"`
+	Turns           int               `json:"turns"`
+	InputTokens     int64             `json:"input_tokens"`
+	OutputTokens    int64             `json:"output_tokens"`
+	ReasoningTokens int64             `json:"reasoning_tokens"`
+	ContextTokens   int64             `json:"context_tokens"`
+	PlanPaused      bool              `json:"plan_paused,omitempty"`
+	Budget          int64             `json:"budget,omitempty"`
+	Scratch         map[string]string `json:"scratch,omitempty"`
+	Created         time.Time         `json:"created"`
+	LastUsed        time.Time         `json:"last_used"`
+}
+
+// WithConversationStore loads the conversations saved in store and keeps it
+// up to date, saving each conversation at the end of every turn. Without one
+// (or with nil), conversations live only in memory.
+func WithConversationStore(store ConversationStore) Option {
+	return func(c *DeepAnalysisClient) {
+		if store == nil {
+			return
+		}
+		c.conv.backing = store
+		if n, err := c.conv.load(); err != nil {
+			logging.Warnf("Failed to load saved conversations: %v", err)
+		} else {
+			log.Printf("Loaded %d saved conversations", n)
+		}
+	}
+}
+
+// load fills the in-memory store from its backing store, returning the
+// number of conversations loaded
+func (s *conversationStore) load() (int, error) {
+	ids, err := s.backing.List()
+	if err != nil {
+		return 0, err
+	}
+	loaded := 0
+	for _, id := range ids {
+		state, ok, err := s.backing.Get(id)
+		if err != nil {
+			return loaded, err
+		}
+		if !ok {
+			continue
+		}
+		sh := s.shard(id)
+		sh.mu.Lock()
+		sh.conv[id] = conversationFromState(state)
+		sh.mu.Unlock()
+		loaded++
+	}
+	return loaded, nil
+}
+
+// persist writes a conversation through to the backing store, or removes it
+// there if it no longer exists. Callers must hold the shard's lock, which
+// keeps writes of one conversation in order.
+func (s *conversationStore) persist(sh *conversationShard, conversationID string) {
+	if s.backing == nil || conversationID == "" {
+		return
+	}
+	var err error
+	if conv, ok := sh.conv[conversationID]; ok {
+		err = s.backing.Set(conversationID, conv.state())
+	} else {
+		err = s.backing.Delete(conversationID)
+	}
+	if err != nil {
+		logging.Warnf("Failed to save conversation %s: %v", conversationID, err)
+	}
+}
+
+// state returns the persisted form of a conversation
+func (conv *conversation) state() ConversationState {
+	return ConversationState{
+		ResponseID:      conv.responseID,
+		Turns:           conv.turns,
+		InputTokens:     conv.usage.input,
+		OutputTokens:    conv.usage.output,
+		ReasoningTokens: conv.usage.reasoning,
+		ContextTokens:   conv.context,
+		PlanPaused:      conv.planPaused,
+		Budget:          conv.budget,
+		Scratch:         conv.scratch.clone().entries,
+		Created:         conv.created,
+		LastUsed:        conv.lastUsed,
+	}
+}
+
+// conversationFromState restores a conversation from its persisted form
+func conversationFromState(state ConversationState) *conversation {
+	conv := &conversation{
+		responseID: state.ResponseID,
+		turns:      state.Turns,
+		usage:      usage{input: state.InputTokens, output: state.OutputTokens, reasoning: state.ReasoningTokens},
+		context:    state.ContextTokens,
+		planPaused: state.PlanPaused,
+		budget:     state.Budget,
+		created:    state.Created,
+		lastUsed:   state.LastUsed,
+	}
+	for key, value := range state.Scratch {
+		// Saved notes were within the limits when written, so this can't fail
+		_ = conv.scratch.write(key, value)
+	}
+	return conv
+}
+
+// FileConversationStore keeps conversation state in a JSON file, rewritten
+// atomically after changes. Changes that arrive while the file is being
+// written are saved together by the next write.
+type FileConversationStore struct {
+	mu      sync.RWMutex
+	path    string
+	states  map[string]ConversationState
+	version uint64     // incremented by every change
+	saveMu  sync.Mutex // held while writing the file
+	saved   uint64     // version last written to the file
+}
+
+// NewFileConversationStore opens the conversation state saved at path. A
+// missing file is created on the first change.
+func NewFileConversationStore(path string) (*FileConversationStore, error) {
+	s := &FileConversationStore{path: path, states: make(map[string]ConversationState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.states); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get implements ConversationStore
+func (s *FileConversationStore) Get(conversationID string) (ConversationState, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.states[conversationID]
+	return state, ok, nil
+}
+
+// Set implements ConversationStore
+func (s *FileConversationStore) Set(conversationID string, state ConversationState) error {
+	s.mu.Lock()
+	s.states[conversationID] = state
+	s.version++
+	version := s.version
+	s.mu.Unlock()
+	return s.save(version)
+}
+
+// Delete implements ConversationStore
+func (s *FileConversationStore) Delete(conversationID string) error {
+	s.mu.Lock()
+	if _, ok := s.states[conversationID]; !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	delete(s.states, conversationID)
+	s.version++
+	version := s.version
+	s.mu.Unlock()
+	return s.save(version)
+}
+
+// List implements ConversationStore
+func (s *FileConversationStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.states))
+	for id := range s.states {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// save writes every conversation to a temporary file and renames it over the
+// state file, so a crash never leaves a partial file behind. The file is
+// written without holding mu, and not at all if a save that started after
+// version was reached has already written it.
+func (s *FileConversationStore) save(version uint64) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	if s.saved >= version {
+		return nil
+	}
+
+	s.mu.RLock()
+	data, err := json.MarshalIndent(s.states, "", "  ")
+	current := s.version
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	s.saved = current
+	return nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileConversationStoreConcurrentChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := NewFileConversationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &DeepAnalysisClient{conv: newConversationStore()}
+	WithConversationStore(store)(c)
+
+	const conversations, turns = 8, 20
+	var wg sync.WaitGroup
+	for i := range conversations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("conv-%d", i)
+			for turn := range turns {
+				c.setRespID(id, fmt.Sprintf("resp_%d", turn))
+				c.recordTurn(id, usage{input: 1}, 0)
+			}
+		}()
+	}
+	wg.Wait()
+	c.clearRespID("conv-0")
+
+	reopened, err := NewFileConversationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, _ := reopened.List()
+	if len(ids) != conversations-1 {
+		t.Fatalf("saved conversations = %q, want %d", ids, conversations-1)
+	}
+	for _, id := range ids {
+		state, _, _ := reopened.Get(id)
+		if state.ResponseID != fmt.Sprintf("resp_%d", turns-1) || state.Turns != turns || state.InputTokens != turns {
+			t.Errorf("%s saved as %+v, want the state after its last turn", id, state)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+)
+
+// structuredModel is the cheaper model used to extract structured summaries
+const structuredModel = "gpt-5-mini"
+
+// structuredSummary is the machine-readable summary extracted from a prose answer
+type structuredSummary struct {
+	Summary  string `json:"summary"`
+	Findings []struct {
+		Title    string `json:"title"`
+		Severity string `json:"severity"`
+		Details  string `json:"details"`
+	} `json:"findings"`
+	Recommendations []string `json:"recommendations"`
+}
+
+// structuredSummarySchema is the strict JSON schema for structuredSummary
+var structuredSummarySchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"summary": map[string]any{
+			"type":        "string",
+			"description": "One or two sentence summary of the analysis",
+		},
+		"findings": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"title": map[string]any{"type": "string"},
+					"severity": map[string]any{
+						"type": "string",
+						"enum": []string{"critical", "high", "medium", "low", "info"},
+					},
+					"details": map[string]any{"type": "string"},
+				},
+				"required":             []string{"title", "severity", "details"},
+				"additionalProperties": false,
+			},
+		},
+		"recommendations": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+	},
+	"required":             []string{"summary", "findings", "recommendations"},
+	"additionalProperties": false,
+}
+
+// confidenceSummary is a structured summary whose findings carry a confidence
+// level and the file references supporting them
+type confidenceSummary struct {
+	Summary         string              `json:"summary"`
+	Findings        []confidenceFinding `json:"findings"`
+	Recommendations []string            `json:"recommendations"`
+}
+
+// confidenceFinding is a finding in a confidenceSummary. UnverifiedEvidence is
+// filled in after extraction with evidence that doesn't resolve to a file line.
+type confidenceFinding struct {
+	Title              string   `json:"title"`
+	Severity           string   `json:"severity"`
+	Confidence         string   `json:"confidence"`
+	Details            string   `json:"details"`
+	Evidence           []string `json:"evidence"`
+	UnverifiedEvidence []string `json:"unverified_evidence,omitempty"`
+}
+
+// confidenceSummarySchema is the strict JSON schema for confidenceSummary
+var confidenceSummarySchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"summary": map[string]any{
+			"type":        "string",
+			"description": "One or two sentence summary of the analysis",
+		},
+		"findings": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"title": map[string]any{"type": "string"},
+					"severity": map[string]any{
+						"type": "string",
+						"enum": []string{"critical", "high", "medium", "low", "info"},
+					},
+					"confidence": map[string]any{
+						"type":        "string",
+						"enum":        []string{"low", "medium", "high"},
+						"description": "How certain the analysis is of this finding, judged by how directly it was verified",
+					},
+					"details": map[string]any{"type": "string"},
+					"evidence": map[string]any{
+						"type":        "array",
+						"description": "path:line or path:start-end references the analysis cites for this finding",
+						"items":       map[string]any{"type": "string"},
+					},
+				},
+				"required":             []string{"title", "severity", "confidence", "details", "evidence"},
+				"additionalProperties": false,
+			},
+		},
+		"recommendations": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+	},
+	"required":             []string{"summary", "findings", "recommendations"},
+	"additionalProperties": false,
+}
+
+// confidenceInstructions asks the structured model for confidence-annotated findings
+const confidenceInstructions = "Extract the findings, their severity, and the recommendations from the analysis below. For each finding, rate confidence as high when the analysis verified it directly in code it read, medium when it is inferred from strong indirect evidence, and low when it is speculative or unverified. List as evidence the path:line references the analysis gives for that finding, copied exactly; use an empty list when it gives none. Only include what the analysis states; do not add new conclusions."
+
+// addConfidenceSummary extracts confidence-annotated findings from the
+// result's prose, checks their evidence references against the filesystem,
+// and attaches them as structured content plus a JSON text block. Failures
+// are logged and leave the prose result untouched.
+func (c *DeepAnalysisClient) addConfidenceSummary(ctx context.Context, result *mcp.CallToolResult) {
+	prose := resultText(result)
+	if prose == "" {
+		return
+	}
+
+	log.Printf("Extracting confidence-annotated summary: model=%s prose_len=%d", structuredModel, len(prose))
+	raw, err := c.extractJSON(ctx, prose, "confidence_summary", confidenceInstructions, confidenceSummarySchema)
+	if err != nil {
+		logging.Warnf("Confidence summary extraction failed: %v", err)
+		return
+	}
+
+	var summary confidenceSummary
+	if err := json.Unmarshal([]byte(raw), &summary); err != nil {
+		logging.Warnf("Confidence summary was not valid JSON: %v", err)
+		return
+	}
+
+	// Flag evidence that isn't a resolvable file reference
+	lineCounts := make(map[string]int)
+	unverified := 0
+	for i := range summary.Findings {
+		finding := &summary.Findings[i]
+		for _, evidence := range finding.Evidence {
+			refs := findReferences(strings.TrimSpace(evidence))
+			if len(refs) == 0 {
+				finding.UnverifiedEvidence = append(finding.UnverifiedEvidence, evidence+": not a path:line reference")
+				continue
+			}
+			if problem := c.checkReference(ctx, refs[0], lineCounts); problem != "" {
+				finding.UnverifiedEvidence = append(finding.UnverifiedEvidence, evidence+": "+problem)
+			}
+		}
+		unverified += len(finding.UnverifiedEvidence)
+	}
+	log.Printf("Confidence summary: findings=%d unverified_evidence=%d", len(summary.Findings), unverified)
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		logging.Warnf("Failed to encode confidence summary: %v", err)
+		return
+	}
+	result.StructuredContent = summary
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Confidence-Annotated Findings:\n```json\n%s\n```", data)))
+}
+
+// addStructuredSummary extracts a structured summary from the result's prose and
+// attaches it as structured content plus a JSON text block. Failures are logged
+// and leave the prose result untouched.
+func (c *DeepAnalysisClient) addStructuredSummary(ctx context.Context, result *mcp.CallToolResult) {
+	prose := resultText(result)
+	if prose == "" {
+		return
+	}
+
+	log.Printf("Extracting structured summary: model=%s prose_len=%d", structuredModel, len(prose))
+	raw, err := c.extractJSON(ctx, prose, "structured_summary", "Extract the findings, their severity, and the recommendations from the analysis below. Only include what the analysis states; do not add new conclusions.", structuredSummarySchema)
+	if err != nil {
+		logging.Warnf("Structured summary extraction failed: %v", err)
+		return
+	}
+
+	var summary structuredSummary
+	if err := json.Unmarshal([]byte(raw), &summary); err != nil {
+		logging.Warnf("Structured summary was not valid JSON: %v", err)
+		return
+	}
+
+	result.StructuredContent = summary
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Structured Summary:\n```json\n%s\n```", raw)))
+}
+
+// extractJSON asks the structured model to restate prose as JSON matching a strict schema
+func (c *DeepAnalysisClient) extractJSON(ctx context.Context, prose, name, instructions string, schema map[string]any) (string, error) {
+	params := responses.ResponseNewParams{
+		Model:        structuredModel,
+		Instructions: openai.Opt(instructions),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfString: openai.Opt(prose),
+		},
+		Text: responses.ResponseTextConfigParam{
+			Format: responses.ResponseFormatTextConfigParamOfJSONSchema(name, schema),
+		},
+	}
+	params.Text.Format.OfJSONSchema.Strict = openai.Opt(true)
+
+	response, err := c.client.Responses.New(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	meterResponse(ctx, response)
+	return extractTextContent(response), nil
+}
+
+// resultText joins the text content of a tool result
+func resultText(result *mcp.CallToolResult) string {
+	var text string
+	for _, content := range result.Content {
+		if tc, ok := content.(mcp.TextContent); ok {
+			if text != "" {
+				text += "\n"
+			}
+			text += tc.Text
+		}
+	}
+	return text
+}
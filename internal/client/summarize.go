@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	maxSummaryFiles = 50          // Limit files attached to a directory summary
+	maxSummaryBytes = 1024 * 1024 // Limit total bytes attached to a directory summary
+)
+
+// defaultSummaryPattern matches common source and documentation files
+const defaultSummaryPattern = "**/*.{go,py,js,jsx,ts,tsx,rs,java,kt,rb,c,h,cc,cpp,hpp,cs,swift,php,md}"
+
+// skippedSummaryDirs are never included in a directory summary
+var skippedSummaryDirs = []string{".git", "node_modules", "vendor", "dist", "build"}
+
+// HandleSummarize reads the source files in a directory and runs a single
+// analysis pass producing a structural summary of the module
+func (c *DeepAnalysisClient) HandleSummarize(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	ctx, meter := withUsageMeter(ctx)
+	defer func() { c.reportUsage(result, meter) }()
+	started := time.Now()
+	dir, err := request.RequireString("path")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	pattern := request.GetString("pattern", defaultSummaryPattern)
+	conversationID := c.conversationKey(ctx, request.GetString("conversation_id", ""))
+	if err := c.waitForRate(ctx); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	log.Printf("Summarizing directory: path=%s pattern=%s", dir, pattern)
+
+	matches, err := c.fileOps.MatchFiles(ctx, filepath.Join(dir, pattern))
+	if err != nil {
+		logging.Errorf("Failed to list files: %v", err)
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to list files: %v", err)), nil
+	}
+	files := make([]string, 0, len(matches))
+	for _, path := range matches {
+		if !inSkippedDir(dir, path) {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("No files in %s matched %s", dir, pattern)), nil
+	}
+
+	// Attach files until the count or size guard is hit
+	var fileParts, omitted []string
+	total := 0
+	for _, path := range files {
+		if len(fileParts) >= maxSummaryFiles {
+			omitted = append(omitted, path)
+			continue
+		}
+		content, err := c.fileOps.ReadFile(ctx, path)
+		if err != nil {
+			logging.Warnf("Failed to read file %s: %v", path, err)
+			fileParts = append(fileParts, formatAttachmentError(path, err))
+			continue
+		}
+		if total+len(content) > maxSummaryBytes {
+			omitted = append(omitted, path)
+			continue
+		}
+		total += len(content)
+		fileParts = append(fileParts, formatAttachment(path, content))
+	}
+	log.Printf("Attached %d files (%d bytes), omitted %d", len(fileParts), total, len(omitted))
+
+	task := fmt.Sprintf(`Produce a structural summary of the module in %s. Cover:
+- Its overall purpose and responsibilities
+- The key types, functions, and interfaces, and what each is for
+- How the files and packages relate to each other, including entry points
+- Notable external dependencies and integration points
+- Anything surprising or worth knowing before changing this code`, dir)
+	if len(omitted) > 0 {
+		task += "\n\n" + truncate.Marker(fmt.Sprintf("attachment limit of %d files or %d bytes", maxSummaryFiles, maxSummaryBytes), fmt.Sprintf("%d files", len(omitted)), "Read them with your tools if they matter:") + "\n" + strings.Join(omitted, "\n")
+	}
+
+	result = c.analyze(ctx, analysis{
+		prompt:               buildPrompt(task, "", "", "", "", "", joinStrings(fileParts, "\n")),
+		conversationID:       conversationID,
+		continueConversation: false,
+		budget:               c.reasoningBudget,
+		started:              started,
+	})
+	return result, nil
+}
+
+// inSkippedDir reports whether path, below dir, is inside a directory excluded from summaries
+func inSkippedDir(dir, path string) bool {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		path = rel
+	}
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		for _, skip := range skippedSummaryDirs {
+			if part == skip {
+				return true
+			}
+		}
+	}
+	return false
+}
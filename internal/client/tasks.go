@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const maxDesignDocBytes = 256 * 1024 // design document content included in the prompt
+
+// taskPlan is a design document broken down into implementation tasks
+type taskPlan struct {
+	Summary string `json:"summary"`
+	Tasks   []struct {
+		ID          int      `json:"id"`
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		DependsOn   []int    `json:"depends_on"`
+		Effort      string   `json:"effort"`
+		Files       []string `json:"files"`
+	} `json:"tasks"`
+	OpenQuestions []string `json:"open_questions"`
+}
+
+// taskPlanSchema is the strict JSON schema for taskPlan
+var taskPlanSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"summary": map[string]any{
+			"type":        "string",
+			"description": "One or two sentences describing what the design delivers",
+		},
+		"tasks": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"id":          map[string]any{"type": "integer", "description": "Position in the order, starting at 1"},
+					"title":       map[string]any{"type": "string"},
+					"description": map[string]any{"type": "string", "description": "What to build or change, and how to know it's done"},
+					"depends_on": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "integer"},
+						"description": "IDs of earlier tasks that must be finished first",
+					},
+					"effort": map[string]any{
+						"type":        "string",
+						"enum":        []string{"XS", "S", "M", "L", "XL"},
+						"description": "XS: under 2 hours, S: about half a day, M: 1-2 days, L: 3-5 days, XL: over a week",
+					},
+					"files": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Existing files the task is expected to touch, if known",
+					},
+				},
+				"required":             []string{"id", "title", "description", "depends_on", "effort", "files"},
+				"additionalProperties": false,
+			},
+		},
+		"open_questions": map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string"},
+			"description": "Decisions the design leaves open that block or change tasks",
+		},
+	},
+	"required":             []string{"summary", "tasks", "open_questions"},
+	"additionalProperties": false,
+}
+
+// tasksTask is the planning prompt for breaking a design document into tasks
+const tasksTask = `Break the design document %s, attached below, into an ordered list of concrete implementation tasks.
+
+Read the existing code the design affects before planning, so tasks build on what is already there rather than on assumptions. For each task give:
+1. A short title and what to build or change, specific enough to start on, with how to tell it's done.
+2. The earlier tasks it depends on. Order tasks so every dependency comes first, and keep independent work independent so it can proceed in parallel.
+3. A rough effort estimate: XS (under 2 hours), S (about half a day), M (1-2 days), L (3-5 days) or XL (over a week; prefer splitting it).
+4. The existing files it is likely to touch, where you can tell.
+
+Include the testing, migration and rollout work the design implies, not just the main code. Finish with the open questions the design leaves unresolved that would block or change tasks.`
+
+// HandleExtractTasks breaks a design document down into ordered
+// implementation tasks with dependencies and effort estimates, returned as
+// prose and structured JSON
+func (c *DeepAnalysisClient) HandleExtractTasks(ctx context.Context, request mcp.CallToolRequest) (result *mcp.CallToolResult, err error) {
+	ctx, meter := withUsageMeter(ctx)
+	defer func() { c.reportUsage(result, meter) }()
+	started := time.Now()
+	docPath, err := request.RequireString("doc_path")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := checkStringLists(request, []string{"files"}); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	files := request.GetStringSlice("files", nil)
+	planContext := request.GetString("context", "")
+	conversationID := c.conversationKey(ctx, request.GetString("conversation_id", ""))
+	if err := c.waitForRate(ctx); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if len(files) > c.maxAttached {
+		return mcp.NewToolResultError(fmt.Sprintf("Too many attached files: %d (max %d). Attach the most relevant files and let the analysis discover the rest.", len(files), c.maxAttached)), nil
+	}
+
+	doc, err := c.fileOps.ReadFile(ctx, docPath)
+	if err != nil {
+		logging.Errorf("Failed to read design document: %v", err)
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read design document: %v", err)), nil
+	}
+	doc = truncate.Bytes(doc, maxDesignDocBytes, fmt.Sprintf("design document limit of %d bytes", maxDesignDocBytes), "Read the rest of the document with your tools.")
+
+	log.Printf("Extracting tasks: doc=%s doc_len=%d files=%d", docPath, len(doc), len(files))
+
+	attachments := append([]string{formatAttachment(docPath, doc)}, c.readAttachments(ctx, files)...)
+	result = c.analyze(ctx, analysis{
+		prompt:               buildPrompt(fmt.Sprintf(tasksTask, docPath), "", planContext, "", "", "", joinStrings(attachments, "\n")),
+		conversationID:       conversationID,
+		continueConversation: false,
+		budget:               c.reasoningBudget,
+		started:              started,
+	})
+	if result.IsError {
+		return result, nil
+	}
+
+	// Restate the plan as tasks the caller can feed into a tracker
+	raw, err := c.extractJSON(ctx, resultText(result), "extract_tasks", "Extract the implementation plan from the answer below: a short summary, every task in order with its id (numbered from 1 in the order given), title, description, the ids of the tasks it depends on, its effort estimate and the files it touches, and the open questions. Keep the answer's tasks and estimates; do not invent any.", taskPlanSchema)
+	if err != nil {
+		logging.Warnf("Task extraction failed: %v", err)
+		return result, nil
+	}
+	var plan taskPlan
+	if err := json.Unmarshal([]byte(raw), &plan); err != nil {
+		logging.Warnf("Task plan was not valid JSON: %v", err)
+		return result, nil
+	}
+	if problems := plan.orderProblems(); len(problems) > 0 {
+		logging.Warnf("Task plan has %d dependency problems", len(problems))
+		prependText(result, "**Warning:** "+joinStrings(problems, "\n**Warning:** ")+"\n\n")
+	}
+
+	result.StructuredContent = plan
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Tasks:\n```json\n%s\n```", raw)))
+	return result, nil
+}
+
+// orderProblems lists dependencies that don't point at an earlier task, so a
+// tracker importing the plan doesn't silently get an impossible order
+func (p taskPlan) orderProblems() []string {
+	var problems []string
+	seen := make(map[int]bool)
+	for _, task := range p.Tasks {
+		for _, dep := range task.DependsOn {
+			if !seen[dep] {
+				problems = append(problems, fmt.Sprintf("task %d (%s) depends on task %d, which doesn't come before it", task.ID, task.Title, dep))
+			}
+		}
+		seen[task.ID] = true
+	}
+	return problems
+}
@@ -0,0 +1,1291 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/openai/openai-go/responses"
+)
+
+// buildTools defines the tools available to the model
+func (c *DeepAnalysisClient) buildTools() []responses.ToolUnionParam {
+	grepProps := map[string]any{
+		"pattern": map[string]any{
+			"type":        "string",
+			"description": "Regular expression pattern to search for",
+			"minLength":   1,
+		},
+		"path": map[string]any{
+			"type":        "string",
+			"description": "File path or glob pattern (e.g., '*.go', 'src/**/*.js', '*.{go,mod,sum}'). Use ** for recursive matching, * and ? for wildcards, {a,b} for alternatives",
+			"minLength":   1,
+		},
+		"ignore_case": map[string]any{
+			"type":        []string{"boolean", "null"},
+			"description": fmt.Sprintf("Perform case-insensitive search. Null uses the server default (%v)", c.ignoreCaseDefault),
+		},
+		"recursive": map[string]any{
+			"type":        []string{"boolean", "null"},
+			"description": "Search all files inside directories the path matches (like grep -r), skipping hidden, vendor, node_modules, dist and build directories. Without it, matched directories are skipped. Null for false",
+		},
+		"context_lines": map[string]any{
+			"type":        []string{"integer", "null"},
+			"description": "Lines of context to show before and after each match (max 20), like grep -C. Null for none",
+		},
+		"before_context": map[string]any{
+			"type":        []string{"integer", "null"},
+			"description": "Lines of context before each match (max 20), like grep -B, overriding context_lines. Null to use context_lines",
+		},
+		"after_context": map[string]any{
+			"type":        []string{"integer", "null"},
+			"description": "Lines of context after each match (max 20), like grep -A, overriding context_lines. Null to use context_lines",
+		},
+	}
+	grepRequired := []string{"pattern", "path", "ignore_case", "recursive", "context_lines", "before_context", "after_context"}
+	if c.allowGit {
+		grepProps["with_blame"] = map[string]any{
+			"type":        []string{"boolean", "null"},
+			"description": "Annotate each match in a git-tracked file with the commit, author and date that last changed it. Null for false",
+		}
+		grepRequired = append(grepRequired, "with_blame")
+	}
+
+	// Diffing against an arbitrary revision reads history, so rev needs allowGit too
+	gitDiffProps := map[string]any{
+		"path": map[string]any{
+			"type":        "string",
+			"description": "Path to a file inside a git repository (supports ~ for home directory)",
+			"minLength":   1,
+		},
+	}
+	gitDiffRequired := []string{"path"}
+	if c.allowGit {
+		gitDiffProps["rev"] = map[string]any{
+			"type":        []string{"string", "null"},
+			"description": "Revision to diff against (e.g., 'HEAD~1', a branch or commit). Null for HEAD",
+		}
+		gitDiffRequired = append(gitDiffRequired, "rev")
+	}
+
+	tools := []responses.ToolUnionParam{
+		responses.ToolParamOfFunction(
+			"read_file",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Path to the file to read (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"start_line": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "First line to read (1-based). Null for the start of the file, or the whole file if end_line is also null",
+					},
+					"end_line": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "Last line to read. Null for the end of the file",
+					},
+				},
+				"required":             []string{"path", "start_line", "end_line"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"grep_files",
+			map[string]any{
+				"type":                 "object",
+				"properties":           grepProps,
+				"required":             grepRequired,
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"grep_in_file",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Path to a single file to search. Streamed, so files over the read_file size limit are fine",
+						"minLength":   1,
+					},
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Regular expression pattern to search for",
+						"minLength":   1,
+					},
+					"ignore_case": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": fmt.Sprintf("Perform case-insensitive search. Null uses the server default (%v)", c.ignoreCaseDefault),
+					},
+					"start_line": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "First line number to search (1-based). Null for the start of the file",
+					},
+					"end_line": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "Last line number to search. Null for the end of the file",
+					},
+					"context_lines": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "Lines of context to show around each match (max 20). Null for 2",
+					},
+				},
+				"required":             []string{"path", "pattern", "ignore_case", "start_line", "end_line", "context_lines"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"glob_files",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Glob pattern (e.g., '**/*.go', 'internal/**/test_*.go', '*.{js,ts}'). Use ** for recursive matching, * for files/dirs, ? for single char.",
+						"minLength":   1,
+					},
+				},
+				"required":             []string{"pattern"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"list_directory",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Directory to list (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"recursive": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": "List the whole tree, indented by depth, without entering hidden, vendor, node_modules, dist and build directories (up to 1000 entries). Null for false",
+					},
+				},
+				"required":             []string{"path", "recursive"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"find_todos",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Glob pattern for files to search (e.g., '**/*.go', 'src/**/*.{js,ts}')",
+						"minLength":   1,
+					},
+					"markers": map[string]any{
+						"type":        []string{"array", "null"},
+						"description": "Markers to search for. Null for TODO, FIXME, XXX and HACK",
+						"items":       map[string]any{"type": "string"},
+					},
+				},
+				"required":             []string{"pattern", "markers"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"find_conflicts",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Glob pattern for files to search for merge conflict markers (e.g., '**/*', 'src/**/*.go')",
+						"minLength":   1,
+					},
+				},
+				"required":             []string{"pattern"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"find_owners",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Glob pattern for files to look up owners of (e.g., 'internal/server/**', 'main.go')",
+						"minLength":   1,
+					},
+					"root": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Repository root containing the CODEOWNERS file (supports ~ for home directory). Null for the project root",
+					},
+				},
+				"required":             []string{"pattern", "root"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"find_cycles",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Directory inside a Go module to scan recursively for import cycles (supports ~ for home directory). Null for the project root",
+					},
+				},
+				"required":             []string{"path"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"go_metrics",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Go file, or package directory (non-recursive), to measure",
+						"minLength":   1,
+					},
+					"top_n": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "Number of most complex functions to list (max 100). Null for 20",
+					},
+				},
+				"required":             []string{"path", "top_n"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"git_file_diff",
+			map[string]any{
+				"type":                 "object",
+				"properties":           gitDiffProps,
+				"required":             gitDiffRequired,
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"locate_symbol",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Go symbol to locate: a function, type, var or const name, or Type.Method",
+						"minLength":   1,
+					},
+					"path": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Directory to search recursively (supports ~ for home directory). Null for the project root",
+					},
+					"include_references": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": "Also list references to the symbol. Null for false",
+					},
+				},
+				"required":             []string{"name", "path", "include_references"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"find_implementations",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{
+						"type":        "string",
+						"description": "Go interface name, or pkg.Interface to choose between interfaces of the same name",
+						"minLength":   1,
+					},
+					"path": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Directory to search recursively (supports ~ for home directory). Null for the project root",
+					},
+				},
+				"required":             []string{"name", "path"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"api_surface",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Go package directory (supports ~ for home directory)",
+						"minLength":   1,
+					},
+				},
+				"required":             []string{"path"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"unused_symbols",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Go package directory whose exported symbols are checked (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"scope": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Directory searched recursively for dependents of the package (supports ~ for home directory). Null for the project root",
+					},
+				},
+				"required":             []string{"path", "scope"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"validate_schema",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "JSON or YAML data file to validate (supports ~ for home directory). .yaml/.yml files may contain several documents",
+						"minLength":   1,
+					},
+					"schema_path": map[string]any{
+						"type":        "string",
+						"description": "JSON Schema file, in JSON or YAML (supports ~ for home directory). Local $ref files are followed",
+						"minLength":   1,
+					},
+				},
+				"required":             []string{"path", "schema_path"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"json_diff",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"expected": map[string]any{
+						"type":        "string",
+						"description": "Expected JSON document, inline or as a path to a JSON file (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"actual": map[string]any{
+						"type":        "string",
+						"description": "Actual JSON document, inline or as a path to a JSON file (supports ~ for home directory)",
+						"minLength":   1,
+					},
+				},
+				"required":             []string{"expected", "actual"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"data_flow",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Go source file (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"function": map[string]any{
+						"type":        "string",
+						"description": "Function name, or Type.Method for a method",
+						"minLength":   1,
+					},
+					"variable": map[string]any{
+						"type":        "string",
+						"description": "Variable, parameter or receiver name to trace",
+						"minLength":   1,
+					},
+				},
+				"required":             []string{"path", "function", "variable"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"call_graph",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Go package directory (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"function": map[string]any{
+						"type":        "string",
+						"description": "Root function name, or Type.Method for a method",
+						"minLength":   1,
+					},
+					"depth": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "Levels of calls to expand (max 10). Null for 3",
+					},
+				},
+				"required":             []string{"path", "function", "depth"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"trace_interaction",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Go package directory (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"function": map[string]any{
+						"type":        "string",
+						"description": "Entry function name, or Type.Method for a method",
+						"minLength":   1,
+					},
+					"format": map[string]any{
+						"type":        []string{"string", "null"},
+						"enum":        []any{"mermaid", "plantuml", nil},
+						"description": "Diagram syntax. Null for mermaid",
+					},
+					"depth": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "Levels of calls to expand (max 10). Null for 3",
+					},
+					"include_external": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": "Draw calls into other packages, such as the standard library. Null for false",
+					},
+				},
+				"required":             []string{"path", "function", "format", "depth", "include_external"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"grep_docs",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Regular expression to search for within doc comments",
+						"minLength":   1,
+					},
+					"path": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "A .go file, or a directory whose .go files are searched recursively (supports ~ for home directory). Null for the project root",
+					},
+					"ignore_case": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": fmt.Sprintf("Perform case-insensitive search. Null uses the server default (%v)", c.ignoreCaseDefault),
+					},
+				},
+				"required":             []string{"pattern", "path", "ignore_case"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"diff_dirs",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"old_path": map[string]any{
+						"type":        "string",
+						"description": "Directory holding the old version (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"new_path": map[string]any{
+						"type":        "string",
+						"description": "Directory holding the new version (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"include_diffs": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": "Include a capped unified diff for each modified text file. Null for false",
+					},
+				},
+				"required":             []string{"old_path", "new_path", "include_diffs"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"resolve_config",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"sources": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Config layers, LOWEST precedence first (e.g., ['config/defaults.yaml', 'config/production.yaml', '.env', 'args: --port=9090']). Each is a JSON, YAML, .env, properties or INI file path (supports ~ for home directory), or 'args:' followed by command-line flags",
+						"minItems":    1,
+					},
+					"env_prefix": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Prefix of the variables in .env sources that map to config keys (e.g., 'APP_'); others are ignored. Null to treat every variable as a key",
+					},
+					"keys": map[string]any{
+						"type":        []string{"array", "null"},
+						"items":       map[string]any{"type": "string"},
+						"description": "Keys to report, including anything nested under them (e.g., ['db', 'server.port']). Null for every key",
+					},
+				},
+				"required":             []string{"sources", "env_prefix", "keys"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"scratch_write",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"key": map[string]any{
+						"type":        "string",
+						"description": fmt.Sprintf("Name of the note, up to %d bytes (e.g., 'auth-flow', 'suspects')", maxScratchKeyLen),
+						"minLength":   1,
+					},
+					"value": map[string]any{
+						"type":        "string",
+						"description": "Note to keep, replacing any previous value under the key. Empty deletes the key",
+					},
+				},
+				"required":             []string{"key", "value"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+		responses.ToolParamOfFunction(
+			"scratch_read",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"key": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Name of the note to read. Null lists every key with its size",
+					},
+				},
+				"required":             []string{"key"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		),
+	}
+
+	if c.allowExec {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"run_command",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"command": map[string]any{
+						"type":        "string",
+						"description": "Name of an allowlisted executable (e.g., 'go', 'git', 'ls'). Paths are not accepted",
+						"minLength":   1,
+					},
+					"args": map[string]any{
+						"type":        "array",
+						"description": "Arguments passed directly to the executable. No shell is used and shell metacharacters are rejected",
+						"items":       map[string]any{"type": "string"},
+					},
+				},
+				"required":             []string{"command", "args"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	if c.allowVulnCheck {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"check_vulns",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Go module root containing go.mod (supports ~ for home directory) to scan with govulncheck for known-vulnerable dependencies. Null for the project root",
+					},
+				},
+				"required":             []string{"path"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	if c.allowCoverage {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"test_coverage",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Go package directory (supports ~ for home directory) whose tests are run with coverage. Null for the project root",
+					},
+					"profile": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Existing coverage profile (from go test -coverprofile) to report instead of running the tests. Null to run them",
+					},
+				},
+				"required":             []string{"path", "profile"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	if c.allowDocExamples {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"check_doc_examples",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "Glob pattern for markdown files (supports ~ and ** e.g. 'README.md' or 'docs/**/*.md') whose fenced Go code blocks are compiled. Snippets are completed with a package clause, stdlib imports or an enclosing function as needed; blocks marked ```go ignore or ```go nocompile are skipped",
+					},
+				},
+				"required":             []string{"pattern"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	if c.allowBuildProfile {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"build_profile",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Go module or package directory (supports ~ for home directory) whose packages are built with go build ./... and ranked by compile time. Null for the project root",
+					},
+					"incremental": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": "Time only the packages the build cache can't supply, instead of a cold build (go build -a) that recompiles everything. Null for a cold build",
+					},
+				},
+				"required":             []string{"path", "incremental"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	if c.allowGit {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"api_diff",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Go package directory inside a git repository (supports ~ for home directory)",
+						"minLength":   1,
+					},
+					"old_rev": map[string]any{
+						"type":        "string",
+						"description": "Base revision (e.g., 'v1.2.0', 'main' or a commit)",
+						"minLength":   1,
+					},
+					"new_rev": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Revision to compare against old_rev. Null for the working tree",
+					},
+				},
+				"required":             []string{"path", "old_rev", "new_rev"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	if c.allowGit {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"file_history",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "File inside a git repository (supports ~ for home directory) whose commit history to list, following renames",
+						"minLength":   1,
+					},
+					"max_commits": map[string]any{
+						"type":        []string{"integer", "null"},
+						"description": "Most recent commits to list (max 100). Null for 20",
+					},
+					"include_diffs": map[string]any{
+						"type":        []string{"boolean", "null"},
+						"description": "Include each commit's diff of the file, capped per commit and in total. Null for false",
+					},
+				},
+				"required":             []string{"path", "max_commits", "include_diffs"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	if c.allowEnv {
+		tools = append(tools, responses.ToolParamOfFunction(
+			"list_env",
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"prefix": map[string]any{
+						"type":        []string{"string", "null"},
+						"description": "Only list variables whose names start with this prefix (e.g. 'AWS_'). Null for all",
+					},
+				},
+				"required":             []string{"prefix"},
+				"additionalProperties": false,
+			},
+			true, // strict
+		))
+	}
+
+	return tools
+}
+
+// executeFunction executes a function call requested by the model
+func (c *DeepAnalysisClient) executeFunction(ctx context.Context, name, argsJSON string) (string, error) {
+	if len(argsJSON) > c.maxToolArgsSize {
+		return "", fmt.Errorf("arguments too large (%d bytes, max %d bytes): narrow the request and try again", len(argsJSON), c.maxToolArgsSize)
+	}
+
+	// Bound tool executions across all in-flight requests
+	release, err := c.acquireToolSlot(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	switch name {
+	case "read_file":
+		var args struct {
+			Path      string `json:"path"`
+			StartLine *int   `json:"start_line"`
+			EndLine   *int   `json:"end_line"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		if args.StartLine == nil && args.EndLine == nil {
+			return c.fileOps.ReadFile(ctx, args.Path)
+		}
+		return c.fileOps.ReadFileRange(ctx, args.Path, intOrZero(args.StartLine), intOrZero(args.EndLine))
+
+	case "grep_files":
+		var args struct {
+			Pattern    string `json:"pattern"`
+			Path       string `json:"path"`
+			IgnoreCase *bool  `json:"ignore_case"`
+			WithBlame  *bool  `json:"with_blame"`
+			Recursive  *bool  `json:"recursive"`
+			Context    *int   `json:"context_lines"`
+			Before     *int   `json:"before_context"`
+			After      *int   `json:"after_context"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		ignoreCase := c.ignoreCaseDefault
+		if args.IgnoreCase != nil {
+			ignoreCase = *args.IgnoreCase
+		}
+		withBlame := args.WithBlame != nil && *args.WithBlame
+		if withBlame && !c.allowGit {
+			return "", fmt.Errorf("with_blame is disabled on this server")
+		}
+		recursive := args.Recursive != nil && *args.Recursive
+		before, after := intOrZero(args.Context), intOrZero(args.Context)
+		if args.Before != nil {
+			before = *args.Before
+		}
+		if args.After != nil {
+			after = *args.After
+		}
+		return c.fileOps.GrepFiles(ctx, args.Pattern, args.Path, ignoreCase, withBlame, recursive, before, after)
+
+	case "grep_in_file":
+		var args struct {
+			Path         string `json:"path"`
+			Pattern      string `json:"pattern"`
+			IgnoreCase   *bool  `json:"ignore_case"`
+			StartLine    *int   `json:"start_line"`
+			EndLine      *int   `json:"end_line"`
+			ContextLines *int   `json:"context_lines"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		ignoreCase := c.ignoreCaseDefault
+		if args.IgnoreCase != nil {
+			ignoreCase = *args.IgnoreCase
+		}
+		contextLines := defaultContextLines
+		if args.ContextLines != nil {
+			contextLines = *args.ContextLines
+		}
+		return c.fileOps.GrepInFile(ctx, args.Path, args.Pattern, ignoreCase, intOrZero(args.StartLine), intOrZero(args.EndLine), contextLines)
+
+	case "glob_files":
+		var args struct {
+			Pattern string `json:"pattern"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.GlobFiles(ctx, args.Pattern)
+
+	case "list_directory":
+		var args struct {
+			Path      string `json:"path"`
+			Recursive *bool  `json:"recursive"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.ListDirectory(ctx, args.Path, args.Recursive != nil && *args.Recursive)
+
+	case "find_todos":
+		var args struct {
+			Pattern string   `json:"pattern"`
+			Markers []string `json:"markers"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.FindTodos(ctx, args.Pattern, args.Markers)
+
+	case "find_conflicts":
+		var args struct {
+			Pattern string `json:"pattern"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.FindConflicts(ctx, args.Pattern)
+
+	case "find_owners":
+		var args struct {
+			Pattern string  `json:"pattern"`
+			Root    *string `json:"root"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var root string
+		if args.Root != nil {
+			root = *args.Root
+		}
+		return c.fileOps.FindOwners(ctx, args.Pattern, root)
+
+	case "find_cycles":
+		var args struct {
+			Path *string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var path string
+		if args.Path != nil {
+			path = *args.Path
+		}
+		return c.fileOps.FindCycles(ctx, path)
+
+	case "go_metrics":
+		var args struct {
+			Path string `json:"path"`
+			TopN *int   `json:"top_n"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.GoMetrics(ctx, args.Path, intOrZero(args.TopN))
+
+	case "git_file_diff":
+		var args struct {
+			Path string  `json:"path"`
+			Rev  *string `json:"rev"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var rev string
+		if args.Rev != nil {
+			rev = *args.Rev
+		}
+		if rev != "" && !c.allowGit {
+			return "", fmt.Errorf("rev is disabled on this server")
+		}
+		return c.fileOps.GitFileDiff(ctx, args.Path, rev)
+
+	case "locate_symbol":
+		var args struct {
+			Name              string  `json:"name"`
+			Path              *string `json:"path"`
+			IncludeReferences *bool   `json:"include_references"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var path string
+		if args.Path != nil {
+			path = *args.Path
+		}
+		return c.fileOps.LocateSymbol(ctx, args.Name, path, args.IncludeReferences != nil && *args.IncludeReferences)
+
+	case "find_implementations":
+		var args struct {
+			Name string  `json:"name"`
+			Path *string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var path string
+		if args.Path != nil {
+			path = *args.Path
+		}
+		return c.fileOps.FindImplementations(ctx, args.Name, path)
+
+	case "api_surface":
+		var args struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.APISurface(ctx, args.Path)
+
+	case "unused_symbols":
+		var args struct {
+			Path  string  `json:"path"`
+			Scope *string `json:"scope"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var scope string
+		if args.Scope != nil {
+			scope = *args.Scope
+		}
+		return c.fileOps.UnusedSymbols(ctx, args.Path, scope)
+
+	case "validate_schema":
+		var args struct {
+			Path       string `json:"path"`
+			SchemaPath string `json:"schema_path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.ValidateSchema(ctx, args.Path, args.SchemaPath)
+
+	case "json_diff":
+		var args struct {
+			Expected string `json:"expected"`
+			Actual   string `json:"actual"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.JSONDiff(ctx, args.Expected, args.Actual)
+
+	case "data_flow":
+		var args struct {
+			Path     string `json:"path"`
+			Function string `json:"function"`
+			Variable string `json:"variable"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.DataFlow(ctx, args.Path, args.Function, args.Variable)
+
+	case "call_graph":
+		var args struct {
+			Path     string `json:"path"`
+			Function string `json:"function"`
+			Depth    *int   `json:"depth"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.CallGraph(ctx, args.Path, args.Function, intOrZero(args.Depth))
+
+	case "trace_interaction":
+		var args struct {
+			Path            string  `json:"path"`
+			Function        string  `json:"function"`
+			Format          *string `json:"format"`
+			Depth           *int    `json:"depth"`
+			IncludeExternal *bool   `json:"include_external"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var format string
+		if args.Format != nil {
+			format = *args.Format
+		}
+		return c.fileOps.TraceInteraction(ctx, args.Path, args.Function, format, intOrZero(args.Depth), args.IncludeExternal != nil && *args.IncludeExternal)
+
+	case "grep_docs":
+		var args struct {
+			Pattern    string  `json:"pattern"`
+			Path       *string `json:"path"`
+			IgnoreCase *bool   `json:"ignore_case"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		ignoreCase := c.ignoreCaseDefault
+		if args.IgnoreCase != nil {
+			ignoreCase = *args.IgnoreCase
+		}
+		var path string
+		if args.Path != nil {
+			path = *args.Path
+		}
+		return c.fileOps.GrepDocs(ctx, args.Pattern, path, ignoreCase)
+
+	case "diff_dirs":
+		var args struct {
+			OldPath      string `json:"old_path"`
+			NewPath      string `json:"new_path"`
+			IncludeDiffs *bool  `json:"include_diffs"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.DiffDirs(ctx, args.OldPath, args.NewPath, args.IncludeDiffs != nil && *args.IncludeDiffs)
+
+	case "resolve_config":
+		var args struct {
+			Sources   []string `json:"sources"`
+			EnvPrefix *string  `json:"env_prefix"`
+			Keys      []string `json:"keys"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var envPrefix string
+		if args.EnvPrefix != nil {
+			envPrefix = *args.EnvPrefix
+		}
+		return c.fileOps.ResolveConfig(ctx, args.Sources, envPrefix, args.Keys)
+
+	case "run_command":
+		if !c.allowExec {
+			return "", fmt.Errorf("command execution is disabled")
+		}
+		var args struct {
+			Command string   `json:"command"`
+			Args    []string `json:"args"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.runOrHold(ctx, "run_command: "+commandDescription(args.Command, args.Args), func(ctx context.Context) (string, error) {
+			return c.fileOps.RunCommand(ctx, args.Command, args.Args)
+		})
+
+	case "check_vulns":
+		if !c.allowVulnCheck {
+			return "", fmt.Errorf("vulnerability checks are disabled")
+		}
+		var args struct {
+			Path *string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var path string
+		if args.Path != nil {
+			path = *args.Path
+		}
+		return c.runOrHold(ctx, name+" "+argsJSON, func(ctx context.Context) (string, error) {
+			return c.fileOps.CheckVulns(ctx, path)
+		})
+
+	case "test_coverage":
+		if !c.allowCoverage {
+			return "", fmt.Errorf("test coverage is disabled")
+		}
+		var args struct {
+			Path    *string `json:"path"`
+			Profile *string `json:"profile"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var path, profile string
+		if args.Path != nil {
+			path = *args.Path
+		}
+		if args.Profile != nil {
+			profile = *args.Profile
+		}
+		return c.runOrHold(ctx, name+" "+argsJSON, func(ctx context.Context) (string, error) {
+			return c.fileOps.TestCoverage(ctx, path, profile)
+		})
+
+	case "check_doc_examples":
+		if !c.allowDocExamples {
+			return "", fmt.Errorf("doc example checks are disabled")
+		}
+		var args struct {
+			Pattern string `json:"pattern"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.runOrHold(ctx, name+" "+argsJSON, func(ctx context.Context) (string, error) {
+			return c.fileOps.CheckDocExamples(ctx, args.Pattern)
+		})
+
+	case "build_profile":
+		if !c.allowBuildProfile {
+			return "", fmt.Errorf("build profiling is disabled")
+		}
+		var args struct {
+			Path        *string `json:"path"`
+			Incremental *bool   `json:"incremental"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var path string
+		if args.Path != nil {
+			path = *args.Path
+		}
+		incremental := args.Incremental != nil && *args.Incremental
+		return c.runOrHold(ctx, name+" "+argsJSON, func(ctx context.Context) (string, error) {
+			return c.fileOps.BuildProfile(ctx, path, incremental)
+		})
+
+	case "api_diff":
+		if !c.allowGit {
+			return "", fmt.Errorf("git history lookups are disabled")
+		}
+		var args struct {
+			Path   string  `json:"path"`
+			OldRev string  `json:"old_rev"`
+			NewRev *string `json:"new_rev"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var newRev string
+		if args.NewRev != nil {
+			newRev = *args.NewRev
+		}
+		return c.fileOps.APIDiff(ctx, args.Path, args.OldRev, newRev)
+
+	case "file_history":
+		if !c.allowGit {
+			return "", fmt.Errorf("git history lookups are disabled")
+		}
+		var args struct {
+			Path         string `json:"path"`
+			MaxCommits   *int   `json:"max_commits"`
+			IncludeDiffs *bool  `json:"include_diffs"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return c.fileOps.FileHistory(ctx, args.Path, intOrZero(args.MaxCommits), args.IncludeDiffs != nil && *args.IncludeDiffs)
+
+	case "list_env":
+		if !c.allowEnv {
+			return "", fmt.Errorf("environment listing is disabled")
+		}
+		var args struct {
+			Prefix *string `json:"prefix"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		var prefix string
+		if args.Prefix != nil {
+			prefix = *args.Prefix
+		}
+		return c.listEnv(prefix), nil
+
+	default:
+		if tool := c.externalTool(name); tool != nil {
+			description := fmt.Sprintf("%s %s: %s", name, argsJSON, commandDescription(tool.Command[0], tool.Command[1:]))
+			return c.runOrHold(ctx, description, func(ctx context.Context) (string, error) {
+				return c.fileOps.RunTool(ctx, tool.Command, []byte(argsJSON), tool.timeout)
+			})
+		}
+		return "", fmt.Errorf("unknown function: %s", name)
+	}
+}
+
+// acquireToolSlot waits for a slot under the global tool execution limit and
+// returns a function that releases it. Without a limit it returns immediately.
+func (c *DeepAnalysisClient) acquireToolSlot(ctx context.Context, name string) (func(), error) {
+	if c.toolSlots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-c.toolSlots }
+
+	select {
+	case c.toolSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	log.Printf("Tool execution queued on global limit: name=%s limit=%d", name, cap(c.toolSlots))
+	start := time.Now()
+	select {
+	case c.toolSlots <- struct{}{}:
+		log.Printf("Tool execution dequeued: name=%s waited=%s", name, time.Since(start).Round(time.Millisecond))
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// intOrZero dereferences an optional integer argument
+func intOrZero(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
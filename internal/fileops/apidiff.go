@@ -0,0 +1,356 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// apiDecl is one exported declaration compared by APIDiff
+type apiDecl struct {
+	kind      string // func, method, type, field, interface method, const or var
+	name      string
+	signature string
+}
+
+// APIDiff compares the exported API of the Go package in dir between two git
+// revisions, or a revision and the working tree when newRev is empty. Removed
+// and changed signatures, and methods added to interfaces, are reported as
+// breaking; other additions as compatible. Test files are excluded.
+func (h *Handler) APIDiff(ctx context.Context, dir, oldRev, newRev string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if !h.allowGit {
+		return "", fmt.Errorf("api_diff requires the server to be started with -allow-git")
+	}
+
+	resolved, err := h.resolvePath(dir)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat path: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory: api_diff takes a package directory", dir)
+	}
+	for _, rev := range []string{oldRev, newRev} {
+		// Reject anything git would parse as an option
+		if strings.HasPrefix(rev, "-") {
+			return "", fmt.Errorf("invalid revision: %s", rev)
+		}
+	}
+
+	oldPkg, oldAPI, err := h.revisionAPI(ctx, absDir, oldRev)
+	if err != nil {
+		return "", err
+	}
+	newLabel := newRev
+	var newPkg string
+	var newAPI map[string]apiDecl
+	if newRev == "" {
+		newLabel = "the working tree"
+		newPkg, newAPI, err = h.workingTreeAPI(ctx, absDir)
+	} else {
+		newPkg, newAPI, err = h.revisionAPI(ctx, absDir, newRev)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	keys := make(map[string]bool, len(oldAPI)+len(newAPI))
+	for _, api := range []map[string]apiDecl{oldAPI, newAPI} {
+		for key := range api {
+			keys[key] = true
+		}
+	}
+
+	var breaking, additions []string
+	for _, key := range sortedKeys(keys) {
+		old, inOld := oldAPI[key]
+		cur, inNew := newAPI[key]
+		switch {
+		case !inNew:
+			breaking = append(breaking, fmt.Sprintf("- removed %s %s: %s", old.kind, old.name, old.signature))
+		case !inOld && cur.kind == "interface method" && hasDecl(oldAPI, "type", interfaceOf(cur.name)):
+			// Only an interface that already existed can have implementations to break
+			breaking = append(breaking, fmt.Sprintf("- added %s %s: %s (breaks implementations outside the package)", cur.kind, cur.name, cur.signature))
+		case !inOld:
+			additions = append(additions, fmt.Sprintf("+ added %s %s: %s", cur.kind, cur.name, cur.signature))
+		case old.signature != cur.signature:
+			breaking = append(breaking, fmt.Sprintf("- changed %s %s: %s -> %s", cur.kind, cur.name, old.signature, cur.signature))
+		}
+	}
+
+	pkgName := newPkg
+	if pkgName == "" {
+		pkgName = oldPkg
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Exported API of package %s (%s) from %s to %s:\n", pkgName, resolved, oldRev, newLabel)
+	if len(breaking)+len(additions) == 0 {
+		b.WriteString("\nNo exported API changes\n")
+		return b.String(), nil
+	}
+	if len(breaking) > 0 {
+		fmt.Fprintf(&b, "\nBreaking changes (%d):\n%s\n", len(breaking), strings.Join(breaking, "\n"))
+	}
+	if len(additions) > 0 {
+		fmt.Fprintf(&b, "\nCompatible additions (%d):\n%s\n", len(additions), strings.Join(additions, "\n"))
+	}
+	b.WriteString("\nSignatures are compared syntactically with parameter names ignored; changes to behavior or constant values are not detected.\n")
+	return b.String(), nil
+}
+
+// interfaceOf returns the interface name of an "interface method" declaration
+func interfaceOf(method string) string {
+	iface, _, _ := strings.Cut(method, ".")
+	return iface
+}
+
+// hasDecl reports whether api has a declaration of the given kind and name
+func hasDecl(api map[string]apiDecl, kind, name string) bool {
+	_, ok := api[kind+" "+name]
+	return ok
+}
+
+// revisionAPI parses the non-test Go files of absDir as of a git revision
+func (h *Handler) revisionAPI(ctx context.Context, absDir, rev string) (string, map[string]apiDecl, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	// Paths given to ls-tree and rev:./path are relative to the directory git runs in
+	listing, _, err := runGit(ctx, absDir, "ls-tree", "--name-only", rev, "--", ".")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list %s at %s: %w", absDir, rev, err)
+	}
+
+	var names []string
+	for _, name := range strings.Split(strings.TrimSpace(listing), "\n") {
+		if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	if len(names) > maxGoFiles {
+		return "", nil, fmt.Errorf("too many Go files (%d, max %d): narrow the path", len(names), maxGoFiles)
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		source, truncated, err := runGit(ctx, absDir, "show", rev+":./"+name)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read %s at %s: %w", name, rev, err)
+		}
+		if truncated {
+			return "", nil, fmt.Errorf("%s at %s exceeds %d bytes", name, rev, maxGitOutput)
+		}
+		f, err := parser.ParseFile(fset, name, source, parser.SkipObjectResolution)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to parse %s at %s: %w", name, rev, err)
+		}
+		files = append(files, f)
+	}
+	pkg, api := exportedAPI(files)
+	return pkg, api, nil
+}
+
+// workingTreeAPI parses the non-test Go files of absDir as they are on disk
+func (h *Handler) workingTreeAPI(ctx context.Context, absDir string) (string, map[string]apiDecl, error) {
+	_, parsed, err := h.parseGoPath(ctx, absDir, false, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil, err
+	}
+	files := make([]*ast.File, len(parsed))
+	for i, f := range parsed {
+		files[i] = f.ast
+	}
+	pkg, api := exportedAPI(files)
+	return pkg, api, nil
+}
+
+// exportedAPI collects the exported declarations of a package's files, keyed
+// by kind and name, along with the package name
+func exportedAPI(files []*ast.File) (string, map[string]apiDecl) {
+	api := make(map[string]apiDecl)
+	add := func(kind, name, signature string) {
+		api[kind+" "+name] = apiDecl{kind: kind, name: name, signature: signature}
+	}
+
+	pkg := ""
+	for _, f := range files {
+		if pkg == "" {
+			pkg = f.Name.Name
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() {
+					continue
+				}
+				if d.Recv == nil || len(d.Recv.List) == 0 {
+					add("func", d.Name.Name, "func "+d.Name.Name+funcSignature(d.Type))
+					continue
+				}
+				recv := d.Recv.List[0].Type
+				if !ast.IsExported(receiverType(recv)) {
+					continue
+				}
+				add("method", funcName(d), "func ("+types.ExprString(recv)+") "+d.Name.Name+funcSignature(d.Type))
+
+			case *ast.GenDecl:
+				var implicitType ast.Expr // const specs without a type or value repeat the previous one
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Name.IsExported() {
+							addTypeAPI(s, add)
+						}
+					case *ast.ValueSpec:
+						typ := s.Type
+						if d.Tok == token.CONST {
+							if typ == nil && len(s.Values) == 0 {
+								typ = implicitType
+							} else {
+								implicitType = typ
+							}
+						}
+						kind := d.Tok.String()
+						for _, name := range s.Names {
+							if !name.IsExported() {
+								continue
+							}
+							signature := kind + " " + name.Name
+							if typ != nil {
+								signature += " " + types.ExprString(typ)
+							}
+							add(kind, name.Name, signature)
+						}
+					}
+				}
+			}
+		}
+	}
+	return pkg, api
+}
+
+// addTypeAPI records a type declaration and its exported struct fields or interface methods
+func addTypeAPI(s *ast.TypeSpec, add func(kind, name, signature string)) {
+	name := s.Name.Name
+	header := "type " + name
+	if s.TypeParams != nil {
+		header += "[" + fieldTypes(s.TypeParams, true) + "]"
+	}
+	if s.Assign.IsValid() {
+		add("type", name, header+" = "+types.ExprString(s.Type))
+		return
+	}
+
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		add("type", name, header+" struct")
+		for _, field := range t.Fields.List {
+			typ := types.ExprString(field.Type)
+			if len(field.Names) == 0 {
+				if embedded := embeddedName(field.Type); ast.IsExported(embedded) {
+					add("field", name+"."+embedded, "embedded "+typ)
+				}
+				continue
+			}
+			for _, fieldName := range field.Names {
+				if fieldName.IsExported() {
+					add("field", name+"."+fieldName.Name, fieldName.Name+" "+typ)
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		add("type", name, header+" interface")
+		for _, method := range t.Methods.List {
+			if len(method.Names) == 0 {
+				add("interface method", name+"."+types.ExprString(method.Type), "embedded "+types.ExprString(method.Type))
+				continue
+			}
+			ft, ok := method.Type.(*ast.FuncType)
+			for _, methodName := range method.Names {
+				if ok {
+					add("interface method", name+"."+methodName.Name, methodName.Name+funcSignature(ft))
+				}
+			}
+		}
+	default:
+		add("type", name, header+" "+types.ExprString(s.Type))
+	}
+}
+
+// embeddedName returns the field name of an embedded type, such as Reader for *io.Reader
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	default:
+		return receiverType(expr)
+	}
+}
+
+// funcSignature renders a function type's parameters and results without
+// parameter names, which callers can't depend on
+func funcSignature(ft *ast.FuncType) string {
+	var b strings.Builder
+	if ft.TypeParams != nil {
+		b.WriteString("[" + fieldTypes(ft.TypeParams, true) + "]")
+	}
+	b.WriteString("(" + fieldTypes(ft.Params, false) + ")")
+	if ft.Results != nil && len(ft.Results.List) > 0 {
+		results := fieldTypes(ft.Results, false)
+		if len(ft.Results.List) == 1 && len(ft.Results.List[0].Names) <= 1 {
+			b.WriteString(" " + results)
+		} else {
+			b.WriteString(" (" + results + ")")
+		}
+	}
+	return b.String()
+}
+
+// fieldTypes renders a field list as comma-separated types, one per name,
+// keeping the names only when withNames is set (for type parameters)
+func fieldTypes(fields *ast.FieldList, withNames bool) string {
+	if fields == nil {
+		return ""
+	}
+	var parts []string
+	for _, field := range fields.List {
+		typ := types.ExprString(field.Type)
+		if len(field.Names) == 0 {
+			parts = append(parts, typ)
+			continue
+		}
+		for _, name := range field.Names {
+			if withNames {
+				parts = append(parts, name.Name+" "+typ)
+			} else {
+				parts = append(parts, typ)
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,120 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// APISurface lists the exported constants, variables, types, functions and
+// methods of the Go package in dir, with their signatures and doc comments.
+// Test files and unexported symbols are excluded.
+func (h *Handler) APISurface(ctx context.Context, dir string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	resolved, err := h.resolvePath(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat path: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory: api_surface takes a package directory", dir)
+	}
+
+	fset, files, err := h.parseGoPath(ctx, resolved, false, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	astFiles := make([]*ast.File, len(files))
+	for i, f := range files {
+		astFiles[i] = f.ast
+	}
+
+	// go/doc drops unexported declarations and struct fields by default
+	pkg, err := doc.NewFromFiles(fset, astFiles, resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to read package: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s (%s, %d files)\n", pkg.Name, resolved, len(files))
+	if synopsis := pkg.Synopsis(pkg.Doc); synopsis != "" {
+		fmt.Fprintf(&b, "\n%s\n", synopsis)
+	}
+
+	writeValues := func(title string, values []*doc.Value) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		for _, v := range values {
+			writeDecl(&b, fset, v.Decl, v.Doc)
+		}
+	}
+	writeValues("Constants", pkg.Consts)
+	writeValues("Variables", pkg.Vars)
+
+	if len(pkg.Types) > 0 {
+		b.WriteString("\nTypes:\n")
+		for _, t := range pkg.Types {
+			writeDecl(&b, fset, t.Decl, t.Doc)
+			for _, v := range append(t.Consts, t.Vars...) {
+				writeDecl(&b, fset, v.Decl, v.Doc)
+			}
+			for _, fn := range append(t.Funcs, t.Methods...) {
+				writeDecl(&b, fset, fn.Decl, fn.Doc)
+			}
+		}
+	}
+
+	if len(pkg.Funcs) > 0 {
+		b.WriteString("\nFunctions:\n")
+		for _, fn := range pkg.Funcs {
+			writeDecl(&b, fset, fn.Decl, fn.Doc)
+		}
+	}
+
+	if len(pkg.Consts)+len(pkg.Vars)+len(pkg.Types)+len(pkg.Funcs) == 0 {
+		b.WriteString("\nNo exported declarations\n")
+	}
+
+	return b.String(), nil
+}
+
+// writeDecl prints a declaration's signature (without a function body) and its doc comment
+func writeDecl(b *strings.Builder, fset *token.FileSet, decl ast.Decl, docText string) {
+	var node any = decl
+	if fn, ok := decl.(*ast.FuncDecl); ok {
+		sig := *fn
+		sig.Body = nil
+		sig.Doc = nil
+		node = &sig
+	}
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, node); err != nil {
+		fmt.Fprintf(b, "\n// failed to print declaration: %v\n", err)
+		return
+	}
+	pos := fset.Position(decl.Pos())
+	fmt.Fprintf(b, "\n// %s:%d\n%s\n", pos.Filename, pos.Line, buf.String())
+	if docText = strings.TrimSpace(docText); docText != "" {
+		for _, line := range strings.Split(docText, "\n") {
+			fmt.Fprintf(b, "    %s\n", line)
+		}
+	}
+}
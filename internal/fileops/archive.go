@@ -0,0 +1,150 @@
+package fileops
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxArchiveEntries = 200000 // Limit entries extracted from a project archive
+
+// ExtractArchive extracts a .tar.gz, .tgz or .tar project snapshot into dest.
+// Entries that would land outside dest (absolute paths, .. components, links
+// escaping dest, writes through links) are rejected, as are archives whose
+// contents exceed maxBytes.
+func ExtractArchive(archive, dest string, maxBytes int64) error {
+	// Compare real paths, so a dest reached through a symlink still works
+	dest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return fmt.Errorf("failed to resolve extraction directory: %w", err)
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(archive, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read gzip archive: %w", err)
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	var total int64
+	for entries := 0; ; entries++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if entries >= maxArchiveEntries {
+			return fmt.Errorf("archive has more than %d entries", maxArchiveEntries)
+		}
+
+		name := filepath.FromSlash(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "" || name == "." {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive entry %q escapes the extraction directory", hdr.Name)
+		}
+		target := filepath.Join(dest, name)
+		// Links extracted earlier must not redirect this entry out of dest
+		if err := checkExtractTarget(dest, target); err != nil {
+			return fmt.Errorf("archive entry %q: %w", hdr.Name, err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", name, err)
+			}
+
+		case tar.TypeReg:
+			if total+hdr.Size > maxBytes {
+				return fmt.Errorf("archive contents exceed the %d byte extraction limit", maxBytes)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", name, err)
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm()|0o600)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", name, err)
+			}
+			// Copy at most the declared size so a lying header can't exceed the limit
+			n, err := io.CopyN(out, tr, hdr.Size)
+			_ = out.Close()
+			total += n
+			if err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+
+		case tar.TypeSymlink:
+			// Only relative links that stay inside the snapshot. Cleaning
+			// leaves .. only at the start, so resolving it from the link's
+			// real directory is exact, and every later component is a
+			// directory or link already inside dest.
+			link := filepath.Clean(filepath.FromSlash(hdr.Linkname))
+			if filepath.IsAbs(link) {
+				return fmt.Errorf("archive symlink %q -> %q escapes the extraction directory", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", name, err)
+			}
+			parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+			if err != nil {
+				return fmt.Errorf("failed to resolve directory of %s: %w", name, err)
+			}
+			if !withinDir(dest, filepath.Join(parent, link)) {
+				return fmt.Errorf("archive symlink %q -> %q escapes the extraction directory", hdr.Name, hdr.Linkname)
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", name, err)
+			}
+
+		default:
+			// Hard links, devices and FIFOs have no place in a source snapshot
+		}
+	}
+}
+
+// checkExtractTarget refuses an archive entry whose nearest existing parent
+// resolves outside dest, or that would overwrite a symlink
+func checkExtractTarget(dest, target string) error {
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to write through existing symlink")
+	}
+	for dir := filepath.Dir(target); ; dir = filepath.Dir(dir) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			if !withinDir(dest, real) {
+				return fmt.Errorf("parent directory resolves outside the extraction directory")
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || dir == dest || dir == filepath.Dir(dir) {
+			return fmt.Errorf("failed to resolve parent directory: %w", err)
+		}
+	}
+}
+
+// withinDir reports whether path is dir or lies below it, comparing the
+// paths lexically
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
@@ -0,0 +1,223 @@
+package fileops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	buildProfileTimeout  = 10 * time.Minute // a cold build recompiles the standard library too
+	maxProfiledPackages  = 30               // Limit packages listed by BuildProfile
+	maxBuildFailureLines = 60               // Limit build output lines shown for a failed build
+)
+
+// buildAction is the part of an action in go build's -debug-actiongraph
+// output used to time packages
+type buildAction struct {
+	Mode      string
+	Package   string
+	Cmd       []string
+	TimeStart time.Time
+	TimeDone  time.Time
+}
+
+// packageTime totals the actions run for one package
+type packageTime struct {
+	pkg     string
+	elapsed time.Duration
+	std     bool
+	cgo     bool
+}
+
+// BuildProfile builds every package under dir with `go build
+// -debug-actiongraph` and ranks the packages by the time spent compiling
+// them. A cold build (-a) recompiles everything, standard library included,
+// for comparable timings; an incremental build times only what the build
+// cache can't supply. go must be on the command allowlist.
+func (h *Handler) BuildProfile(ctx context.Context, dir string, incremental bool) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !h.allowedCommands["go"] {
+		return "", fmt.Errorf("build_profile requires go in -allowed-commands")
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	dir, err := h.resolvePath(h.defaultDir(dir))
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory: point build_profile at a Go module or package directory", dir)
+	}
+
+	tmp, err := os.MkdirTemp("", "build-profile-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	graph := filepath.Join(tmp, "actiongraph.json")
+
+	ctx, cancel := context.WithTimeout(ctx, buildProfileTimeout)
+	defer cancel()
+
+	// Binaries go to a scratch directory so the build leaves the tree untouched
+	args := []string{"build", "-debug-actiongraph=" + graph, "-o", filepath.Join(tmp, "bin") + string(filepath.Separator)}
+	if !incremental {
+		args = append(args, "-a")
+	}
+	cmd := exec.CommandContext(ctx, "go", append(args, "./...")...)
+	cmd.Dir = dir
+	output := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return "", fmt.Errorf("go build timed out after %s: profile a smaller package directory, or use an incremental build", buildProfileTimeout)
+		case errors.As(err, &exitErr):
+			return "", fmt.Errorf("go build failed:\n%s", lastLines(strings.TrimSpace(output.buf.String()), maxBuildFailureLines))
+		default:
+			return "", fmt.Errorf("failed to run go build: %w", err)
+		}
+	}
+
+	data, err := os.ReadFile(graph)
+	if err != nil {
+		return "", fmt.Errorf("failed to read action graph: %w", err)
+	}
+	var actions []buildAction
+	if err := json.Unmarshal(data, &actions); err != nil {
+		return "", fmt.Errorf("failed to parse action graph: %w", err)
+	}
+	std, err := stdPackages(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	return formatBuildProfile(dir, incremental, actions, std), nil
+}
+
+// stdPackages lists the standard library's import paths with `go list std`.
+// Paths can't tell them apart: a module may be named without a dot, like myapp.
+func stdPackages(ctx context.Context, dir string) (map[string]bool, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "std")
+	cmd.Dir = dir
+	output := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = output
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list standard library packages: %w", err)
+	}
+	std := make(map[string]bool)
+	for _, pkg := range strings.Fields(output.buf.String()) {
+		std[pkg] = true
+	}
+	return std, nil
+}
+
+// formatBuildProfile ranks the compiled packages of an action graph by time
+func formatBuildProfile(dir string, incremental bool, actions []buildAction, std map[string]bool) string {
+	byPkg := make(map[string]*packageTime)
+	var start, done time.Time
+	var link time.Duration
+	cached, links := 0, 0
+	for _, a := range actions {
+		if a.TimeStart.IsZero() || a.TimeDone.IsZero() {
+			continue
+		}
+		if start.IsZero() || a.TimeStart.Before(start) {
+			start = a.TimeStart
+		}
+		if a.TimeDone.After(done) {
+			done = a.TimeDone
+		}
+		elapsed := a.TimeDone.Sub(a.TimeStart)
+
+		switch {
+		case a.Mode == "link":
+			link += elapsed
+			links++
+		case len(a.Cmd) == 0:
+			// Supplied by the build cache, or a step that runs no command
+			if a.Mode == "build" {
+				cached++
+			}
+		case a.Mode == "build" || strings.HasPrefix(a.Mode, "cgo "):
+			p := byPkg[a.Package]
+			if p == nil {
+				p = &packageTime{pkg: a.Package, std: std[a.Package]}
+				byPkg[a.Package] = p
+			}
+			p.elapsed += elapsed
+			p.cgo = p.cgo || a.Mode != "build"
+		}
+	}
+
+	var pkgs []*packageTime
+	var stdTime time.Duration
+	stdCount := 0
+	for _, p := range byPkg {
+		if p.std {
+			stdTime += p.elapsed
+			stdCount++
+			continue
+		}
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].elapsed != pkgs[j].elapsed {
+			return pkgs[i].elapsed > pkgs[j].elapsed
+		}
+		return pkgs[i].pkg < pkgs[j].pkg
+	})
+
+	var b strings.Builder
+	kind := "Cold build (go build -a)"
+	if incremental {
+		kind = "Incremental build"
+	}
+	fmt.Fprintf(&b, "%s of %s: %s wall time, %d packages compiled", kind, dir, done.Sub(start).Round(time.Millisecond), len(byPkg))
+	if cached > 0 {
+		fmt.Fprintf(&b, ", %d from the build cache", cached)
+	}
+	b.WriteString("\nTimes are per package, from the start to the end of its compile (plus cgo steps); packages compile in parallel, so they add up to more than the wall time.\n")
+
+	if len(pkgs) == 0 {
+		b.WriteString("\nNo non-standard-library packages were compiled")
+		if incremental {
+			b.WriteString(": everything came from the build cache. Profile a cold build for timings")
+		}
+		b.WriteString("\n")
+	} else {
+		fmt.Fprintf(&b, "\nSlowest packages outside the standard library (%d compiled):\n", len(pkgs))
+		for i, p := range pkgs {
+			if i == maxProfiledPackages {
+				b.WriteString(truncate.Marker(fmt.Sprintf("limit of %d packages", maxProfiledPackages), fmt.Sprintf("%d faster packages", len(pkgs)-maxProfiledPackages), "") + "\n")
+				break
+			}
+			note := ""
+			if p.cgo {
+				note = " (cgo)"
+			}
+			fmt.Fprintf(&b, "%2d. %8s  %s%s\n", i+1, p.elapsed.Round(time.Millisecond), p.pkg, note)
+		}
+	}
+	if stdCount > 0 {
+		fmt.Fprintf(&b, "\nStandard library: %d packages, %s in total\n", stdCount, stdTime.Round(time.Millisecond))
+	}
+	if links > 0 {
+		fmt.Fprintf(&b, "Linking: %d binaries, %s in total\n", links, link.Round(time.Millisecond))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,303 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	defaultCallGraphDepth = 3
+	maxCallGraphDepth     = 10
+	maxCallGraphNodes     = 500 // Limit lines printed by CallGraph
+)
+
+// goBuiltins are predeclared functions that never appear as call graph edges
+var goBuiltins = map[string]bool{
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true,
+	"new": true, "panic": true, "print": true, "println": true, "real": true, "recover": true,
+	// Conversions to predeclared types
+	"any": true, "bool": true, "byte": true, "complex64": true, "complex128": true, "error": true,
+	"float32": true, "float64": true, "int": true, "int8": true, "int16": true, "int32": true,
+	"int64": true, "rune": true, "string": true, "uint": true, "uint8": true, "uint16": true,
+	"uint32": true, "uint64": true, "uintptr": true,
+}
+
+// callFunc is a function declared in the package being graphed
+type callFunc struct {
+	decl *ast.FuncDecl
+	file *goFile
+}
+
+// callEdge is a single call made by a function
+type callEdge struct {
+	target string // resolved function name, or the call expression when unresolved
+	kind   string // "" for package functions, otherwise external, dynamic, unresolved or ambiguous
+	pos    token.Position
+}
+
+// CallGraph prints a best-effort static call graph of the Go package in dir,
+// rooted at root (a function name or Type.Method) and expanded to depth levels.
+// Calls are resolved by name only, without type information.
+func (h *Handler) CallGraph(ctx context.Context, dir, root string, depth int) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if depth <= 0 {
+		depth = defaultCallGraphDepth
+	}
+	depth = min(depth, maxCallGraphDepth)
+
+	fset, idx, root, err := h.indexCalls(ctx, dir, root)
+	if err != nil {
+		return "", err
+	}
+	funcs, methods, types := idx.funcs, idx.methods, idx.types
+
+	var lines []string
+	expanded := make(map[string]bool)
+	truncated := false
+
+	var walk func(name string, level int, onPath map[string]bool)
+	walk = func(name string, level int, onPath map[string]bool) {
+		if truncated || ctx.Err() != nil {
+			return
+		}
+		for _, edge := range callEdges(fset, funcs[name], funcs, methods, types) {
+			if len(lines) >= maxCallGraphNodes {
+				truncated = true
+				return
+			}
+			indent := strings.Repeat("  ", level)
+			loc := fmt.Sprintf("%s:%d", edge.pos.Filename, edge.pos.Line)
+			switch {
+			case edge.kind != "":
+				lines = append(lines, fmt.Sprintf("%s- %s [%s] (%s)", indent, edge.target, edge.kind, loc))
+			case onPath[edge.target]:
+				lines = append(lines, fmt.Sprintf("%s- %s [recursive] (%s)", indent, edge.target, loc))
+			case expanded[edge.target]:
+				lines = append(lines, fmt.Sprintf("%s- %s [see above] (%s)", indent, edge.target, loc))
+			case level >= depth:
+				lines = append(lines, fmt.Sprintf("%s- %s ... (%s)", indent, edge.target, loc))
+			default:
+				lines = append(lines, fmt.Sprintf("%s- %s (%s)", indent, edge.target, loc))
+				expanded[edge.target] = true
+				onPath[edge.target] = true
+				walk(edge.target, level+1, onPath)
+				delete(onPath, edge.target)
+			}
+		}
+	}
+
+	rootFn := funcs[root]
+	rootPos := fset.Position(rootFn.decl.Pos())
+	expanded[root] = true
+	walk(root, 1, map[string]bool{root: true})
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	results := []string{
+		fmt.Sprintf("Call graph of %s (depth %d, best-effort: calls are matched by name without type information)", root, depth),
+		fmt.Sprintf("%s (%s:%d)", root, rootPos.Filename, rootPos.Line),
+	}
+	if len(lines) == 0 {
+		results = append(results, "  (no calls)")
+	}
+	results = append(results, lines...)
+	if truncated {
+		results = append(results, "\n"+truncate.Marker(fmt.Sprintf("stopped after %d calls", maxCallGraphNodes), "the rest of the graph", "Reduce the depth."))
+	}
+	results = append(results, "\nLegend: [external] other package, [dynamic] call through a func value or expression, [unresolved] method not declared in this package (often an interface), [ambiguous] several methods share the name, ... not expanded past the depth limit")
+
+	return strings.Join(results, "\n"), nil
+}
+
+// callIndex holds the declarations of a package that calls are resolved against
+type callIndex struct {
+	pkg     string              // package name
+	funcs   map[string]callFunc // by funcName
+	methods map[string][]string // method name -> qualified names
+	types   map[string]bool
+}
+
+// indexCalls parses the Go package in dir and resolves root (a function name,
+// Type.Method, or an unambiguous method name) against it
+func (h *Handler) indexCalls(ctx context.Context, dir, root string) (*token.FileSet, callIndex, string, error) {
+	fset, files, err := h.parseGoPath(ctx, dir, false, 0)
+	if err != nil {
+		return nil, callIndex{}, "", err
+	}
+
+	funcs := make(map[string]callFunc)
+	methods := make(map[string][]string) // method name -> qualified names
+	types := make(map[string]bool)
+	for i := range files {
+		for _, decl := range files[i].ast.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+				for _, spec := range gen.Specs {
+					types[spec.(*ast.TypeSpec).Name.Name] = true
+				}
+				continue
+			}
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			name := funcName(fn)
+			funcs[name] = callFunc{decl: fn, file: &files[i]}
+			if fn.Recv != nil {
+				methods[fn.Name.Name] = append(methods[fn.Name.Name], name)
+			}
+		}
+	}
+
+	// Accept an unqualified method name when it is unambiguous
+	if _, ok := funcs[root]; !ok {
+		candidates := methods[root]
+		switch len(candidates) {
+		case 0:
+			return nil, callIndex{}, "", fmt.Errorf("function %s not found in %s", root, dir)
+		case 1:
+			root = candidates[0]
+		default:
+			sort.Strings(candidates)
+			return nil, callIndex{}, "", fmt.Errorf("%s is ambiguous, qualify it as one of: %s", root, strings.Join(candidates, ", "))
+		}
+	}
+
+	return fset, callIndex{pkg: files[0].ast.Name.Name, funcs: funcs, methods: methods, types: types}, root, nil
+}
+
+// callEdges lists the calls made by fn in source order, one per distinct target
+func callEdges(fset *token.FileSet, fn callFunc, funcs map[string]callFunc, methods map[string][]string, types map[string]bool) []callEdge {
+	imports := make(map[string]bool)
+	for _, spec := range fn.file.ast.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = true
+	}
+
+	var recvName, recvType string
+	if fn.decl.Recv != nil && len(fn.decl.Recv.List) > 0 {
+		recvType = receiverType(fn.decl.Recv.List[0].Type)
+		if names := fn.decl.Recv.List[0].Names; len(names) > 0 {
+			recvName = names[0].Name
+		}
+	}
+
+	var edges []callEdge
+	seen := make(map[string]bool)
+	add := func(edge callEdge) {
+		if !seen[edge.target] {
+			seen[edge.target] = true
+			edges = append(edges, edge)
+		}
+	}
+
+	ast.Inspect(fn.decl.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		pos := fset.Position(call.Pos())
+
+		switch f := call.Fun.(type) {
+		case *ast.Ident:
+			switch {
+			case goBuiltins[f.Name], types[f.Name]:
+				// Builtins and conversions
+			case funcs[f.Name].decl != nil:
+				add(callEdge{target: f.Name, pos: pos})
+			default:
+				// A local func value
+				add(callEdge{target: f.Name, kind: "dynamic", pos: pos})
+			}
+
+		case *ast.SelectorExpr:
+			method := f.Sel.Name
+			if x, ok := f.X.(*ast.Ident); ok {
+				if imports[x.Name] {
+					add(callEdge{target: x.Name + "." + method, kind: "external", pos: pos})
+					return true
+				}
+				if x.Name == recvName && funcs[recvType+"."+method].decl != nil {
+					add(callEdge{target: recvType + "." + method, pos: pos})
+					return true
+				}
+				// Type.Method method expressions
+				if funcs[x.Name+"."+method].decl != nil {
+					add(callEdge{target: x.Name + "." + method, pos: pos})
+					return true
+				}
+			}
+			switch candidates := methods[method]; len(candidates) {
+			case 0:
+				add(callEdge{target: exprString(f), kind: "unresolved", pos: pos})
+			case 1:
+				add(callEdge{target: candidates[0], pos: pos})
+			default:
+				sorted := append([]string(nil), candidates...)
+				sort.Strings(sorted)
+				add(callEdge{target: exprString(f), kind: "ambiguous: " + strings.Join(sorted, ", "), pos: pos})
+			}
+
+		case *ast.ParenExpr, *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.InterfaceType, *ast.StarExpr:
+			// Conversions such as []byte(s) or (*T)(p)
+
+		case *ast.FuncLit:
+			// Immediately invoked; its calls are walked as part of this function
+
+		default:
+			add(callEdge{target: exprString(call.Fun), kind: "dynamic", pos: pos})
+		}
+		return true
+	})
+	return edges
+}
+
+// importName guesses the package name of an import path: the last element,
+// skipping major version suffixes and trimming go- and -go affixes
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(importPath))
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "-go"), ".go")
+	return strings.ReplaceAll(name, "-", "")
+}
+
+// exprString renders a short form of a call target for display
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.CallExpr:
+		return exprString(e.Fun) + "()"
+	case *ast.IndexExpr:
+		return exprString(e.X) + "[...]"
+	case *ast.FuncLit:
+		return "func literal"
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
@@ -0,0 +1,209 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	commandTimeout   = 30 * time.Second
+	maxCommandOutput = 256 * 1024 // 256KB per stream
+)
+
+// shellMetacharacters are rejected in command arguments even though no shell is involved
+const shellMetacharacters = ";&|<>`$(){}[]*?!~\\\"'\n\r"
+
+// WithAllowedCommands sets the executables RunCommand may invoke
+func WithAllowedCommands(commands ...string) Option {
+	return func(h *Handler) {
+		if h.allowedCommands == nil {
+			h.allowedCommands = make(map[string]bool)
+		}
+		for _, command := range commands {
+			if command = strings.TrimSpace(command); command != "" {
+				h.allowedCommands[command] = true
+			}
+		}
+	}
+}
+
+// RunCommand runs an allowlisted executable with arguments, without a shell,
+// in the first allowed root. Arguments naming paths outside the allowed roots
+// are refused (see checkCommandPaths).
+func (h *Handler) RunCommand(ctx context.Context, command string, args []string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if len(h.allowedCommands) == 0 {
+		return "", fmt.Errorf("command execution is disabled")
+	}
+	if strings.ContainsRune(command, os.PathSeparator) || strings.ContainsRune(command, '/') {
+		return "", fmt.Errorf("command must be a bare executable name, not a path: %s", command)
+	}
+	if !h.allowedCommands[command] {
+		return "", fmt.Errorf("command %q is not in the allowlist", command)
+	}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, shellMetacharacters) {
+			return "", fmt.Errorf("argument %q contains disallowed shell metacharacters", arg)
+		}
+	}
+	if err := h.checkCommandPaths(args); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	if len(h.roots) > 0 {
+		cmd.Dir = h.roots[0]
+	}
+
+	stdout := &cappedBuffer{limit: maxCommandOutput}
+	stderr := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return "", fmt.Errorf("command timed out after %s", commandTimeout)
+		case errors.As(err, &exitErr):
+			exitCode = exitErr.ExitCode()
+		default:
+			return "", fmt.Errorf("failed to run command: %w", err)
+		}
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "$ %s\nExit code: %d\n", strings.Join(append([]string{command}, args...), " "), exitCode)
+	writeStream(&result, "Stdout", stdout)
+	writeStream(&result, "Stderr", stderr)
+
+	return result.String(), nil
+}
+
+// checkCommandPaths refuses a command whose arguments name a path outside the
+// allowed roots. Arguments are taken as paths when they are absolute, file://
+// URIs or contain a .. element, either whole or as the value of a
+// --flag=value, and always when they follow -C (as in git -C or make -C).
+// Relative paths resolve against the first allowed root, where commands run.
+func (h *Handler) checkCommandPaths(args []string) error {
+	if len(h.roots) == 0 {
+		return nil
+	}
+	for i, arg := range args {
+		value := arg
+		afterC := i > 0 && args[i-1] == "-C"
+		if strings.HasPrefix(arg, "-") && !afterC {
+			_, v, ok := strings.Cut(arg, "=")
+			if !ok {
+				continue
+			}
+			value = v
+		}
+		if !afterC && !looksLikePath(value) {
+			continue
+		}
+
+		path, err := localPath(value)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(h.roots[0], path)
+		}
+		if !h.withinRoots(path) {
+			return h.outsideRootsError("command argument", path)
+		}
+	}
+	return nil
+}
+
+// looksLikePath reports whether a command argument may reach outside the
+// directory the command runs in
+func looksLikePath(arg string) bool {
+	if filepath.IsAbs(arg) || strings.HasPrefix(arg, "file://") {
+		return true
+	}
+	return slices.Contains(strings.Split(filepath.ToSlash(arg), "/"), "..")
+}
+
+// RunTool runs an operator-configured tool command with input on stdin, in
+// the first allowed root. Unlike RunCommand it is not subject to the
+// allowlist, since the command comes from the server's tools manifest.
+func (h *Handler) RunTool(ctx context.Context, argv []string, input []byte, timeout time.Duration) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(argv) == 0 {
+		return "", fmt.Errorf("tool has no command")
+	}
+	if timeout <= 0 {
+		timeout = commandTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	if len(h.roots) > 0 {
+		cmd.Dir = h.roots[0]
+	}
+	cmd.Stdin = bytes.NewReader(input)
+
+	stdout := &cappedBuffer{limit: maxCommandOutput}
+	stderr := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return "", fmt.Errorf("tool timed out after %s", timeout)
+		case errors.As(err, &exitErr):
+			var result strings.Builder
+			fmt.Fprintf(&result, "Tool failed with exit code %d\n", exitErr.ExitCode())
+			writeStream(&result, "Stdout", stdout)
+			writeStream(&result, "Stderr", stderr)
+			return "", errors.New(strings.TrimSpace(result.String()))
+		default:
+			return "", fmt.Errorf("failed to run tool: %w", err)
+		}
+	}
+
+	output := stdout.buf.String()
+	if stdout.truncated {
+		output += "\n" + truncate.Marker(fmt.Sprintf("output limit of %d bytes", maxCommandOutput), fmt.Sprintf("%d bytes", stdout.dropped), "")
+	}
+	return output, nil
+}
+
+// writeStream appends a labelled, possibly truncated output stream to the result
+func writeStream(result *strings.Builder, label string, stream *cappedBuffer) {
+	if stream.buf.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(result, "\n%s:\n%s", label, stream.buf.String())
+	if stream.truncated {
+		fmt.Fprintf(result, "\n%s", truncate.Marker(fmt.Sprintf("%s limit of %d bytes", strings.ToLower(label), maxCommandOutput), fmt.Sprintf("%d bytes", stream.dropped), ""))
+	}
+	result.WriteString("\n")
+}
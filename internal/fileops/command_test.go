@@ -0,0 +1,47 @@
+package fileops
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCommandPaths(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	h := New(WithAllowedRoots(root))
+
+	tests := []struct {
+		name    string
+		args    []string
+		allowed bool
+	}{
+		{name: "relative path", args: []string{"sub/file.txt"}, allowed: true},
+		{name: "absolute path inside", args: []string{filepath.Join(root, "sub")}, allowed: true},
+		{name: "dot dot staying inside", args: []string{"sub/../file.txt"}, allowed: true},
+		{name: "git revision range", args: []string{"log", "HEAD~1..HEAD"}, allowed: true},
+		{name: "flags", args: []string{"-la", "--count=5"}, allowed: true},
+		{name: "-C inside", args: []string{"-C", "sub", "status"}, allowed: true},
+		{name: "absolute path outside", args: []string{"/etc"}},
+		{name: "dot dot escaping", args: []string{"../../secret"}},
+		{name: "-C outside", args: []string{"-C", "/", "log"}},
+		{name: "-C relative outside", args: []string{"-C", "..", "log"}},
+		{name: "flag value outside", args: []string{"--git-dir=/tmp"}},
+		{name: "file URI outside", args: []string{"file:///etc/passwd"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.checkCommandPaths(tt.args)
+			if tt.allowed && err != nil {
+				t.Errorf("refused: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("err = %v, want a permission error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	maxConfigSources  = 20  // Limit config layers resolved per call
+	maxConfigKeys     = 300 // Limit keys listed
+	maxConfigValueLen = 200 // Limit characters shown per value
+)
+
+// configSetting is one key as set by one config source
+type configSetting struct {
+	source int // index into the sources, lowest precedence first
+	key    string
+	value  string // JSON encoding of the value
+	line   int    // 0 when unknown
+}
+
+// configSource is one layer of configuration
+type configSource struct {
+	label    string // path, or "command line"
+	format   string
+	settings []configSetting
+	ignored  int // env variables without the prefix
+}
+
+// ResolveConfig merges layered configuration sources, given lowest precedence
+// first, and reports each key's effective value, the source that set it and
+// the values it overrides. Sources are JSON, YAML, .env, properties or INI
+// files, or "args:" followed by command-line flags. Keys match across sources
+// ignoring case and the separators ".", "_" and "-", so APP_DB_HOST in a .env
+// file with envPrefix APP_ overrides db.host in YAML. keys limits the report
+// to those keys and anything nested under them.
+func (h *Handler) ResolveConfig(ctx context.Context, sources []string, envPrefix string, keys []string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(sources) == 0 {
+		return "", fmt.Errorf("no config sources given: list them lowest precedence first")
+	}
+	if len(sources) > maxConfigSources {
+		return "", fmt.Errorf("too many config sources: %d (max %d)", len(sources), maxConfigSources)
+	}
+
+	layers := make([]configSource, 0, len(sources))
+	for i, source := range sources {
+		layer, err := h.loadConfigSource(ctx, source, envPrefix)
+		if err != nil {
+			return "", fmt.Errorf("source %d (%s): %w", i+1, source, err)
+		}
+		for j := range layer.settings {
+			layer.settings[j].source = i
+		}
+		layers = append(layers, layer)
+	}
+
+	// Group each key's settings, lowest precedence first
+	byKey := make(map[string][]configSetting)
+	for _, layer := range layers {
+		for _, s := range layer.settings {
+			if !configKeyWanted(s.key, keys) {
+				continue
+			}
+			k := configMatchKey(s.key)
+			byKey[k] = append(byKey[k], s)
+		}
+	}
+	return formatConfig(layers, byKey, envPrefix), nil
+}
+
+// loadConfigSource reads one config layer, choosing the format from the
+// file name
+func (h *Handler) loadConfigSource(ctx context.Context, source, envPrefix string) (configSource, error) {
+	if args, ok := strings.CutPrefix(source, "args:"); ok {
+		return configSource{label: "command line", format: "flags", settings: parseFlagArgs(args)}, nil
+	}
+
+	content, err := h.ReadFile(ctx, source)
+	if err != nil {
+		return configSource{}, err
+	}
+	layer := configSource{label: source}
+	base := strings.ToLower(filepath.Base(source))
+	switch ext := filepath.Ext(base); {
+	case base == ".env" || strings.HasPrefix(base, ".env.") || ext == ".env":
+		layer.format = "env"
+		layer.settings, layer.ignored = parseEnvFile(content, envPrefix)
+	case ext == ".json":
+		layer.format = "json"
+		var doc any
+		dec := json.NewDecoder(strings.NewReader(content))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return configSource{}, fmt.Errorf("failed to parse as JSON: %w", err)
+		}
+		flattenConfig("", doc, &layer.settings)
+	case ext == ".yaml" || ext == ".yml":
+		layer.format = "yaml"
+		if layer.settings, err = parseYAMLConfig(content); err != nil {
+			return configSource{}, err
+		}
+	case ext == ".properties" || ext == ".ini" || ext == ".cfg" || ext == ".conf":
+		layer.format = "properties"
+		layer.settings = parseProperties(content)
+	default:
+		return configSource{}, fmt.Errorf("unsupported config format %q: use JSON, YAML, .env, properties or INI files, or args:", ext)
+	}
+	return layer, nil
+}
+
+// flattenConfig records the leaves of a decoded JSON document under dotted
+// keys. Arrays are leaves, since layers replace them rather than merging.
+func flattenConfig(prefix string, value any, out *[]configSetting) {
+	if m, ok := value.(map[string]any); ok && len(m) > 0 {
+		for k, v := range m {
+			flattenConfig(joinConfigKey(prefix, k), v, out)
+		}
+		return
+	}
+	if prefix == "" {
+		return
+	}
+	raw, _ := json.Marshal(value)
+	*out = append(*out, configSetting{key: prefix, value: string(raw)})
+}
+
+// parseYAMLConfig flattens the mappings of a YAML file, keeping the line of
+// each value. Later documents override earlier ones.
+func parseYAMLConfig(content string) ([]configSetting, error) {
+	var settings []configSetting
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse as YAML: %w", err)
+		}
+		if len(doc.Content) > 0 {
+			if err := flattenYAML("", doc.Content[0], &settings); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return settings, nil
+}
+
+// flattenYAML records the leaves of a YAML node under dotted keys
+func flattenYAML(prefix string, node *yaml.Node, out *[]configSetting) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				// Merge keys apply the aliased mapping's entries at this level
+				if err := flattenYAML(prefix, value, out); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := flattenYAML(joinConfigKey(prefix, key.Value), value, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if prefix == "" {
+		return nil
+	}
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		raw = []byte(fmt.Sprintf("%q", node.Value))
+	}
+	*out = append(*out, configSetting{key: prefix, value: string(raw), line: node.Line})
+	return nil
+}
+
+// parseEnvFile reads KEY=VALUE lines of a .env file. With a prefix, only
+// variables starting with it are config keys, and the prefix is removed; the
+// rest are counted as ignored.
+func parseEnvFile(content, prefix string) ([]configSetting, int) {
+	var settings []configSetting
+	ignored := 0
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if prefix != "" {
+			if len(name) < len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+				ignored++
+				continue
+			}
+			name = name[len(prefix):]
+		}
+		key := strings.ReplaceAll(strings.ToLower(strings.Trim(name, "_")), "_", ".")
+		if key == "" {
+			continue
+		}
+		settings = append(settings, configSetting{key: key, value: jsonString(unquoteEnvValue(value)), line: lineNum})
+	}
+	return settings, ignored
+}
+
+// unquoteEnvValue strips matching quotes, or a trailing comment from an unquoted value
+func unquoteEnvValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// parseProperties reads key=value or key: value lines, prefixing keys with
+// the enclosing [section] of an INI file
+func parseProperties(content string) []configSetting {
+	var settings []configSetting
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			continue
+		}
+		key := joinConfigKey(section, strings.TrimSpace(line[:i]))
+		settings = append(settings, configSetting{key: key, value: jsonString(strings.TrimSpace(line[i+1:])), line: lineNum})
+	}
+	return settings
+}
+
+// parseFlagArgs reads --key=value, --key value and bare --flag arguments
+func parseFlagArgs(args string) []configSetting {
+	var settings []configSetting
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		if !strings.HasPrefix(fields[i], "-") {
+			continue
+		}
+		name := strings.TrimLeft(fields[i], "-")
+		if name == "" {
+			continue
+		}
+		value := "true"
+		if k, v, ok := strings.Cut(name, "="); ok {
+			name, value = k, v
+		} else if i+1 < len(fields) && !strings.HasPrefix(fields[i+1], "-") {
+			value = fields[i+1]
+			i++
+		}
+		settings = append(settings, configSetting{key: name, value: jsonString(value)})
+	}
+	return settings
+}
+
+// configMatchKey is the form keys are matched in across sources: lowercase,
+// without separators, the relaxed binding common to Viper, koanf and Spring
+func configMatchKey(key string) string {
+	return strings.NewReplacer(".", "", "_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+// configKeyWanted reports whether key is one of wanted or nested under one
+func configKeyWanted(key string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	lower := strings.ToLower(key)
+	for _, w := range wanted {
+		w = strings.ToLower(w)
+		if lower == w || strings.HasPrefix(lower, w+".") || configMatchKey(key) == configMatchKey(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinConfigKey appends a nested key to a dotted prefix
+func joinConfigKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// jsonString encodes a string value the way structured values are shown
+func jsonString(s string) string {
+	raw, _ := json.Marshal(s)
+	return string(raw)
+}
+
+// formatConfig lists each key's effective value and the values it overrides
+func formatConfig(layers []configSource, byKey map[string][]configSetting, envPrefix string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Config sources, lowest precedence first:\n")
+	for i, layer := range layers {
+		fmt.Fprintf(&b, "  %d. %s (%s, %d keys", i+1, layer.label, layer.format, len(layer.settings))
+		if layer.ignored > 0 {
+			fmt.Fprintf(&b, ", %d variables without prefix %s ignored", layer.ignored, envPrefix)
+		}
+		b.WriteString(")\n")
+	}
+	if len(byKey) == 0 {
+		b.WriteString("\nNo matching keys\n")
+		return b.String()
+	}
+
+	type resolved struct {
+		key      string
+		settings []configSetting
+	}
+	all := make([]resolved, 0, len(byKey))
+	overridden := 0
+	for _, settings := range byKey {
+		// Name the key as its lowest layer spells it, usually the defaults
+		all = append(all, resolved{key: settings[0].key, settings: settings})
+		if len(settings) > 1 {
+			overridden++
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].key < all[j].key })
+
+	fmt.Fprintf(&b, "\n%d keys, %d set by more than one source:\n", len(all), overridden)
+	for i, r := range all {
+		if i == maxConfigKeys {
+			fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("limit of %d keys", maxConfigKeys), fmt.Sprintf("%d more keys", len(all)-maxConfigKeys), "Pass keys to narrow the report."))
+			break
+		}
+		winner := r.settings[len(r.settings)-1]
+		fmt.Fprintf(&b, "\n%s = %s\n  from %s\n", r.key, configValueText(winner.value), configLocation(layers, winner))
+		for j := len(r.settings) - 2; j >= 0; j-- {
+			s := r.settings[j]
+			fmt.Fprintf(&b, "  overrides %s = %s\n", configLocation(layers, s), configValueText(s.value))
+		}
+	}
+	return b.String()
+}
+
+// configLocation names the source and line a setting came from
+func configLocation(layers []configSource, s configSetting) string {
+	location := fmt.Sprintf("%d. %s", s.source+1, layers[s.source].label)
+	if s.line > 0 {
+		location += fmt.Sprintf(":%d", s.line)
+	}
+	return location
+}
+
+// configValueText shortens long values
+func configValueText(value string) string {
+	return truncate.Bytes(value, maxConfigValueLen, fmt.Sprintf("value limit of %d bytes", maxConfigValueLen), "")
+}
@@ -0,0 +1,96 @@
+package fileops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"defaults.yaml": "db:\n  host: localhost\n  port: 5432\nlog_level: info\n",
+		"prod.json":     `{"db": {"host": "db.internal"}, "feature": {"beta": false}}`,
+		".env":          "APP_DB_HOST=db.override\nAPP_LOG_LEVEL='debug'\nPATH=/usr/bin\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sources := []string{
+		filepath.Join(dir, "defaults.yaml"),
+		filepath.Join(dir, "prod.json"),
+		filepath.Join(dir, ".env"),
+		"args:--feature-beta --db.port=6543",
+	}
+
+	tests := []struct {
+		name string
+		keys []string
+		want []string // lines expected in the output, in order
+	}{
+		{
+			name: "highest layer wins across formats",
+			keys: []string{"db.host"},
+			want: []string{
+				`db.host = "db.override"`,
+				"  from 3. " + sources[2] + ":1",
+				"  overrides 2. " + sources[1] + ` = "db.internal"`,
+				"  overrides 1. " + sources[0] + `:2 = "localhost"`,
+			},
+		},
+		{
+			name: "flags override files",
+			keys: []string{"db.port"},
+			want: []string{
+				`db.port = "6543"`,
+				"  from 4. command line",
+				"  overrides 1. " + sources[0] + ":3 = 5432",
+			},
+		},
+		{
+			name: "separators and case are ignored",
+			keys: []string{"feature.beta"},
+			want: []string{
+				`feature.beta = "true"`,
+				"  from 4. command line",
+				"  overrides 2. " + sources[1] + " = false",
+			},
+		},
+		{
+			name: "quoted env value",
+			keys: []string{"log_level"},
+			want: []string{
+				`log_level = "debug"`,
+				"  from 3. " + sources[2] + ":2",
+				"  overrides 1. " + sources[0] + `:4 = "info"`,
+			},
+		},
+		{
+			name: "env variables without the prefix are ignored",
+			keys: []string{"path"},
+			want: []string{"1 variables without prefix APP_ ignored", "No matching keys"},
+		},
+	}
+
+	h := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.ResolveConfig(context.Background(), sources, "APP_", tt.keys)
+			if err != nil {
+				t.Fatalf("ResolveConfig: %v", err)
+			}
+			rest := got
+			for _, want := range tt.want {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("output missing %q after the previous lines:\n%s", want, got)
+				}
+				rest = rest[i+len(want):]
+			}
+		})
+	}
+}
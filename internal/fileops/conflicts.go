@@ -0,0 +1,196 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxConflicts = 200 // Limit conflicts returned by FindConflicts
+
+// conflict is an unresolved merge conflict hunk
+type conflict struct {
+	path       string
+	start, end int    // lines of the <<<<<<< and >>>>>>> markers, end 0 if unterminated
+	base       int    // line of the ||||||| marker in diff3 style, 0 if absent
+	separator  int    // line of the ======= marker, 0 if missing
+	ours       string // label after <<<<<<<
+	theirs     string // label after >>>>>>>
+}
+
+// FindConflicts searches files matching pattern for unresolved merge conflict
+// markers and reports each conflict hunk with its line ranges
+func (h *Handler) FindConflicts(ctx context.Context, pattern string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	pattern, err := h.resolvePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	matches, note, err := h.globPaths(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid path pattern: %w", err)
+	}
+
+	if len(matches) == 0 {
+		return h.noMatch(ctx, pattern) + globNote(note), nil
+	}
+
+	var conflicts []conflict
+	var skipped []skippedFile
+	files := 0
+	truncated := false
+
+	for _, path := range matches {
+		if truncated {
+			break
+		}
+
+		// Check context periodically
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		if !h.withinRoots(path) {
+			skipped = append(skipped, skippedFile{path, "outside allowed roots"})
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+			continue
+		}
+		if info.IsDir() || h.checkExtension(path) != nil {
+			continue
+		}
+
+		found, err := fileConflicts(path)
+		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+		}
+		if len(found) > 0 {
+			files++
+		}
+		for _, c := range found {
+			if len(conflicts) >= maxConflicts {
+				truncated = true
+				break
+			}
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return "No merge conflict markers found" + skippedNote(skipped) + globNote(note), nil
+	}
+
+	results := []string{fmt.Sprintf("Found %d unresolved conflicts in %d files", len(conflicts), files)}
+	lastPath := ""
+	for _, c := range conflicts {
+		if c.path != lastPath {
+			results = append(results, fmt.Sprintf("\n%s:", c.path))
+			lastPath = c.path
+		}
+		results = append(results, "  "+c.describe())
+	}
+	if truncated {
+		results = append(results, "\n"+truncate.Marker(fmt.Sprintf("stopped after %d conflicts", maxConflicts), "any further conflicts", "Narrow the pattern."))
+	}
+
+	return strings.Join(results, "\n") + skippedNote(skipped) + globNote(note), nil
+}
+
+// describe summarizes a conflict hunk's line ranges
+func (c conflict) describe() string {
+	if c.end == 0 {
+		return fmt.Sprintf("lines %d-EOF: unterminated conflict (no >>>>>>> marker)", c.start)
+	}
+	side := func(name string, from, to int) string {
+		if name == "" {
+			name = "?"
+		}
+		if to < from {
+			return fmt.Sprintf("%s empty", name)
+		}
+		if to == from {
+			return fmt.Sprintf("%s line %d", name, from)
+		}
+		return fmt.Sprintf("%s lines %d-%d", name, from, to)
+	}
+	if c.separator == 0 {
+		return fmt.Sprintf("lines %d-%d: malformed conflict (no ======= marker)", c.start, c.end)
+	}
+	oursEnd := c.separator - 1
+	parts := []string{}
+	if c.base > 0 {
+		oursEnd = c.base - 1
+		parts = append(parts, side("ours ("+c.ours+")", c.start+1, oursEnd), side("base", c.base+1, c.separator-1))
+	} else {
+		parts = append(parts, side("ours ("+c.ours+")", c.start+1, oursEnd))
+	}
+	parts = append(parts, side("theirs ("+c.theirs+")", c.separator+1, c.end-1))
+	return fmt.Sprintf("lines %d-%d: %s", c.start, c.end, strings.Join(parts, ", "))
+}
+
+// fileConflicts scans a file for conflict hunks. Separator lines outside a
+// hunk (such as Markdown rules) are ignored.
+func fileConflicts(path string) ([]conflict, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Increase buffer size to handle long lines (1MB max token)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var conflicts []conflict
+	var current *conflict
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case conflictMarker(line, "<<<<<<<"):
+			if current != nil {
+				conflicts = append(conflicts, *current) // unterminated; a new one starts
+			}
+			current = &conflict{path: path, start: lineNum, ours: markerLabel(line)}
+		case current == nil:
+		case conflictMarker(line, "|||||||") && current.separator == 0:
+			current.base = lineNum
+		case line == "=======" && current.separator == 0:
+			current.separator = lineNum
+		case conflictMarker(line, ">>>>>>>"):
+			current.end = lineNum
+			current.theirs = markerLabel(line)
+			conflicts = append(conflicts, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		conflicts = append(conflicts, *current)
+	}
+	return conflicts, scanner.Err()
+}
+
+// conflictMarker reports whether line is the given marker, alone or followed by a label
+func conflictMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+// markerLabel returns the branch or commit label after a conflict marker
+func markerLabel(line string) string {
+	return strings.TrimSpace(line[7:])
+}
@@ -0,0 +1,318 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	coverageTimeout      = 5 * time.Minute // go test builds and runs the package's tests
+	maxCoverageFunctions = 50              // Limit partially covered functions listed
+	maxFailureLines      = 60              // Limit test output lines shown for a failed run
+)
+
+// fileCoverage counts statements of one file in a coverage profile
+type fileCoverage struct {
+	file                string
+	covered, statements int
+}
+
+// funcCoverage is one line of `go tool cover -func` output
+type funcCoverage struct {
+	location string // file:line
+	name     string
+	percent  float64
+}
+
+// TestCoverage reports statement coverage of the Go package in dir per file
+// and per function, listing uncovered functions first. It runs `go test
+// -coverprofile` unless an existing profile is given. go must be on the
+// command allowlist.
+func (h *Handler) TestCoverage(ctx context.Context, dir, profile string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !h.allowedCommands["go"] {
+		return "", fmt.Errorf("test_coverage requires go in -allowed-commands")
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	dir, err := h.resolvePath(h.defaultDir(dir))
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory: point test_coverage at a Go package directory", dir)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, coverageTimeout)
+	defer cancel()
+
+	var failure string
+	if profile != "" {
+		if profile, err = h.resolvePath(profile); err != nil {
+			return "", err
+		}
+		if err := h.checkExtension(profile); err != nil {
+			return "", err
+		}
+	} else {
+		tmp, err := os.CreateTemp("", "coverage-*.out")
+		if err != nil {
+			return "", fmt.Errorf("failed to create coverage profile: %w", err)
+		}
+		_ = tmp.Close()
+		defer os.Remove(tmp.Name())
+		profile = tmp.Name()
+
+		if failure, err = runCoverageTests(ctx, dir, profile); err != nil {
+			return "", err
+		}
+	}
+
+	files, mode, err := parseCoverProfile(profile)
+	if err != nil {
+		if failure != "" {
+			return "", fmt.Errorf("tests failed without a coverage profile:\n%s", failure)
+		}
+		return "", err
+	}
+	if len(files) == 0 {
+		if failure != "" {
+			return "", fmt.Errorf("tests failed without recording coverage:\n%s", failure)
+		}
+		return fmt.Sprintf("No coverage recorded for %s: the package has no statements or no tests", dir), nil
+	}
+
+	funcs, err := coverFuncs(ctx, dir, profile)
+	if err != nil {
+		return "", err
+	}
+
+	return formatCoverage(dir, mode, files, funcs, failure), nil
+}
+
+// runCoverageTests runs the package's tests writing a coverage profile. A test
+// failure isn't an error: its output is returned so coverage can still be reported.
+func runCoverageTests(ctx context.Context, dir, profile string) (string, error) {
+	cmd := exec.CommandContext(ctx, "go", "test", "-count=1", "-covermode=set", "-coverprofile="+profile, ".")
+	cmd.Dir = dir
+	output := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return "", fmt.Errorf("go test timed out after %s", coverageTimeout)
+		case errors.As(err, &exitErr):
+			return lastLines(strings.TrimSpace(output.buf.String()), maxFailureLines), nil
+		default:
+			return "", fmt.Errorf("failed to run go test: %w", err)
+		}
+	}
+	return "", nil
+}
+
+// parseCoverProfile totals covered and total statements per file. Blocks
+// repeated across merged profiles are counted once, covered if any run hit them.
+func parseCoverProfile(path string) ([]fileCoverage, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open coverage profile: %w", err)
+	}
+	defer file.Close()
+
+	type block struct {
+		statements int
+		hit        bool
+	}
+	blocks := make(map[string]*block)
+	byFile := make(map[string]*fileCoverage)
+	mode := ""
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if m, ok := strings.CutPrefix(line, "mode:"); ok {
+			mode = strings.TrimSpace(m)
+			continue
+		}
+
+		// file.go:startLine.startCol,endLine.endCol numStmt count
+		fields := strings.Fields(line)
+		colon := strings.LastIndex(line, ":")
+		if len(fields) != 3 || colon < 0 {
+			// The line isn't quoted: the file may not be a profile at all
+			return nil, "", fmt.Errorf("invalid coverage profile line %d: expected file:range statements count", lineNum)
+		}
+		statements, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, "", fmt.Errorf("invalid coverage profile line %d: expected file:range statements count", lineNum)
+		}
+
+		key := fields[0]
+		b := blocks[key]
+		if b == nil {
+			b = &block{statements: statements}
+			blocks[key] = b
+			name := line[:colon]
+			if byFile[name] == nil {
+				byFile[name] = &fileCoverage{file: name}
+			}
+			byFile[name].statements += statements
+		}
+		if count > 0 && !b.hit {
+			b.hit = true
+			byFile[line[:colon]].covered += statements
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to read coverage profile: %w", err)
+	}
+	if mode == "" && len(byFile) == 0 {
+		return nil, "", fmt.Errorf("%s is not a Go coverage profile", path)
+	}
+
+	files := make([]fileCoverage, 0, len(byFile))
+	for _, f := range byFile {
+		files = append(files, *f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if a, b := files[i].percent(), files[j].percent(); a != b {
+			return a < b
+		}
+		return files[i].file < files[j].file
+	})
+	return files, mode, nil
+}
+
+// percent returns the file's statement coverage
+func (f fileCoverage) percent() float64 {
+	if f.statements == 0 {
+		return 100
+	}
+	return 100 * float64(f.covered) / float64(f.statements)
+}
+
+// coverFuncs runs `go tool cover -func` for per-function coverage
+func coverFuncs(ctx context.Context, dir, profile string) ([]funcCoverage, error) {
+	cmd := exec.CommandContext(ctx, "go", "tool", "cover", "-func="+profile)
+	cmd.Dir = dir
+	stdout := &cappedBuffer{limit: maxCommandOutput}
+	stderr := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return nil, fmt.Errorf("go tool cover timed out after %s", coverageTimeout)
+		case errors.As(err, &exitErr):
+			return nil, fmt.Errorf("go tool cover failed (exit code %d): %s", exitErr.ExitCode(), strings.TrimSpace(stderr.buf.String()))
+		default:
+			return nil, fmt.Errorf("failed to run go tool cover: %w", err)
+		}
+	}
+
+	var funcs []funcCoverage
+	for _, line := range strings.Split(stdout.buf.String(), "\n") {
+		// path/file.go:12:	Name	85.7%
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] == "total:" {
+			continue
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		if err != nil {
+			continue
+		}
+		funcs = append(funcs, funcCoverage{location: strings.TrimSuffix(fields[0], ":"), name: fields[1], percent: percent})
+	}
+	return funcs, nil
+}
+
+// formatCoverage renders the coverage report, least covered first
+func formatCoverage(dir, mode string, files []fileCoverage, funcs []funcCoverage, failure string) string {
+	covered, statements := 0, 0
+	for _, f := range files {
+		covered += f.covered
+		statements += f.statements
+	}
+	total := fileCoverage{covered: covered, statements: statements}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Coverage of %s: %.1f%% of statements (%d/%d", dir, total.percent(), covered, statements)
+	if mode != "" {
+		fmt.Fprintf(&b, ", mode %s", mode)
+	}
+	b.WriteString(")\n")
+	if failure != "" {
+		b.WriteString("\nWARNING: Tests failed, so coverage reflects only the tests that ran.\n")
+	}
+
+	b.WriteString("\nFiles:\n")
+	for _, f := range files {
+		fmt.Fprintf(&b, "  %s: %.1f%% (%d/%d statements)\n", f.file, f.percent(), f.covered, f.statements)
+	}
+
+	var uncovered, partial []funcCoverage
+	for _, fn := range funcs {
+		switch {
+		case fn.percent == 0:
+			uncovered = append(uncovered, fn)
+		case fn.percent < 100:
+			partial = append(partial, fn)
+		}
+	}
+	if len(uncovered) > 0 {
+		fmt.Fprintf(&b, "\nUncovered functions (%d):\n", len(uncovered))
+		for _, fn := range uncovered {
+			fmt.Fprintf(&b, "  %s %s\n", fn.location, fn.name)
+		}
+	}
+	if len(partial) > 0 {
+		sort.SliceStable(partial, func(i, j int) bool { return partial[i].percent < partial[j].percent })
+		fmt.Fprintf(&b, "\nPartially covered functions (%d, least covered first):\n", len(partial))
+		for i, fn := range partial {
+			if i == maxCoverageFunctions {
+				fmt.Fprintf(&b, "  %s\n", truncate.Marker(fmt.Sprintf("limit of %d functions", maxCoverageFunctions), fmt.Sprintf("%d more functions", len(partial)-maxCoverageFunctions), "Measure a narrower package."))
+				break
+			}
+			fmt.Fprintf(&b, "  %s %s: %.1f%%\n", fn.location, fn.name, fn.percent)
+		}
+	}
+	fmt.Fprintf(&b, "\n%d of %d functions fully covered\n", len(funcs)-len(uncovered)-len(partial), len(funcs))
+
+	if failure != "" {
+		fmt.Fprintf(&b, "\nTest output:\n%s\n", failure)
+	}
+	return b.String()
+}
+
+// lastLines returns the final n lines of text
+func lastLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return truncate.Marker(fmt.Sprintf("keeping the last %d lines", n), fmt.Sprintf("%d earlier lines", len(lines)-n), "") + "\n" + strings.Join(lines[len(lines)-n:], "\n")
+}
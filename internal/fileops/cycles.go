@@ -0,0 +1,248 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxImportCycles = 100 // Limit cycles listed by FindCycles
+
+// FindCycles builds the import graph of every package under root within its
+// module and reports each import cycle, listing the import that closes every
+// step. Test files are skipped, so cycles only reachable from tests aren't found.
+func (h *Handler) FindCycles(ctx context.Context, root string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	root, err := h.resolvePath(h.defaultDir(root))
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	rootImport := h.importPath(root)
+	if rootImport == "" {
+		return "", fmt.Errorf("no go.mod found for %s within the allowed roots: find_cycles needs a module to resolve import paths", root)
+	}
+
+	fset, files, err := h.parseGoTree(ctx, root, false, parser.ImportsOnly)
+	if err != nil {
+		return "", err
+	}
+
+	// Map each package directory to its import path
+	pkgFiles := make(map[string][]goFile)
+	for _, f := range files {
+		rel, err := filepath.Rel(root, filepath.Dir(f.path))
+		if err != nil {
+			continue
+		}
+		pkg := rootImport
+		if rel != "." {
+			pkg += "/" + filepath.ToSlash(rel)
+		}
+		pkgFiles[pkg] = append(pkgFiles[pkg], f)
+	}
+
+	// Keep only imports of packages under root, with the first place each is imported
+	graph := make(map[string][]string)
+	edges := make(map[[2]string]token.Position)
+	for pkg, fs := range pkgFiles {
+		for _, f := range fs {
+			for _, spec := range f.ast.Imports {
+				imported, err := strconv.Unquote(spec.Path.Value)
+				if err != nil || imported == pkg || pkgFiles[imported] == nil {
+					continue
+				}
+				key := [2]string{pkg, imported}
+				if _, ok := edges[key]; ok {
+					continue
+				}
+				edges[key] = fset.Position(spec.Pos())
+				graph[pkg] = append(graph[pkg], imported)
+			}
+		}
+	}
+	for pkg := range graph {
+		sort.Strings(graph[pkg])
+	}
+
+	cycles, truncated := importCycles(ctx, graph)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if len(cycles) == 0 {
+		return fmt.Sprintf("No import cycles among %d packages under %s (%d internal imports)", len(pkgFiles), rootImport, len(edges)), nil
+	}
+
+	inCycle := make(map[string]bool)
+	for _, cycle := range cycles {
+		for _, pkg := range cycle {
+			inCycle[pkg] = true
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d import cycles involving %d of %d packages under %s\n", len(cycles), len(inCycle), len(pkgFiles), rootImport)
+	for i, cycle := range cycles {
+		fmt.Fprintf(&b, "\nCycle %d: %s -> %s\n", i+1, strings.Join(cycle, " -> "), cycle[0])
+		for j, from := range cycle {
+			to := cycle[(j+1)%len(cycle)]
+			pos := edges[[2]string{from, to}]
+			fmt.Fprintf(&b, "  %s imports %s (%s:%d)\n", from, to, pos.Filename, pos.Line)
+		}
+	}
+	if truncated {
+		fmt.Fprintf(&b, "\n%s", truncate.Marker(fmt.Sprintf("stopped after %d cycles", maxImportCycles), "any further cycles", "Narrow the path."))
+	}
+	return b.String(), nil
+}
+
+// importCycles enumerates the elementary cycles of an import graph with
+// Johnson's algorithm. Each cycle is found once, starting from its lexically
+// smallest package, by searching only through larger packages within the same
+// strongly connected component. Packages that can't reach the start are
+// blocked until a cycle through them is possible, so the work done is linear
+// in the size of the graph per cycle found rather than exponential.
+func importCycles(ctx context.Context, graph map[string][]string) ([][]string, bool) {
+	component := stronglyConnected(graph)
+
+	var starts []string
+	for pkg := range graph {
+		starts = append(starts, pkg)
+	}
+	sort.Strings(starts)
+
+	var cycles [][]string
+	truncated := false
+	stopped := false
+	for _, start := range starts {
+		var path []string
+		blocked := make(map[string]bool)
+		blockers := make(map[string]map[string]bool) // pkg -> packages to unblock with it
+
+		var unblock func(pkg string)
+		unblock = func(pkg string) {
+			blocked[pkg] = false
+			for other := range blockers[pkg] {
+				delete(blockers[pkg], other)
+				if blocked[other] {
+					unblock(other)
+				}
+			}
+		}
+
+		var circuit func(pkg string) bool
+		circuit = func(pkg string) bool {
+			found := false
+			path = append(path, pkg)
+			blocked[pkg] = true
+			for _, next := range graph[pkg] {
+				if stopped || ctx.Err() != nil {
+					stopped = true
+					break
+				}
+				if component[next] != component[start] || next < start {
+					continue
+				}
+				if next == start {
+					if len(cycles) >= maxImportCycles {
+						truncated, stopped = true, true
+						break
+					}
+					cycles = append(cycles, append([]string(nil), path...))
+					found = true
+				} else if !blocked[next] && circuit(next) {
+					found = true
+				}
+			}
+			if found {
+				unblock(pkg)
+			} else {
+				for _, next := range graph[pkg] {
+					if blockers[next] == nil {
+						blockers[next] = make(map[string]bool)
+					}
+					blockers[next][pkg] = true
+				}
+			}
+			path = path[:len(path)-1]
+			return found
+		}
+		circuit(start)
+		if stopped {
+			break
+		}
+	}
+
+	// Shortest cycles first: they are usually the easiest to break
+	sort.SliceStable(cycles, func(i, j int) bool { return len(cycles[i]) < len(cycles[j]) })
+	return cycles, truncated
+}
+
+// stronglyConnected numbers the strongly connected components of a graph
+// using Tarjan's algorithm
+func stronglyConnected(graph map[string][]string) map[string]int {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	component := make(map[string]int)
+	var stack []string
+	next, count := 0, 0
+
+	var connect func(pkg string)
+	connect = func(pkg string) {
+		index[pkg] = next
+		low[pkg] = next
+		next++
+		stack = append(stack, pkg)
+		onStack[pkg] = true
+
+		for _, to := range graph[pkg] {
+			if _, seen := index[to]; !seen {
+				connect(to)
+				low[pkg] = min(low[pkg], low[to])
+			} else if onStack[to] {
+				low[pkg] = min(low[pkg], index[to])
+			}
+		}
+
+		if low[pkg] == index[pkg] {
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component[top] = count
+				if top == pkg {
+					break
+				}
+			}
+			count++
+		}
+	}
+
+	var pkgs []string
+	for pkg := range graph {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		if _, seen := index[pkg]; !seen {
+			connect(pkg)
+		}
+	}
+	return component
+}
@@ -0,0 +1,77 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportCycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph map[string][]string
+		want  [][]string
+	}{
+		{
+			name:  "no cycles",
+			graph: map[string][]string{"a": {"b"}, "b": {"c"}},
+			want:  nil,
+		},
+		{
+			name:  "two packages",
+			graph: map[string][]string{"a": {"b"}, "b": {"a"}},
+			want:  [][]string{{"a", "b"}},
+		},
+		{
+			name:  "shared edge",
+			graph: map[string][]string{"a": {"b"}, "b": {"a", "c"}, "c": {"a"}},
+			want:  [][]string{{"a", "b"}, {"a", "b", "c"}},
+		},
+		{
+			name:  "separate components",
+			graph: map[string][]string{"a": {"b"}, "b": {"a", "c"}, "c": {"d"}, "d": {"c"}},
+			want:  [][]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:  "dead end inside a component",
+			graph: map[string][]string{"a": {"b", "x"}, "b": {"c"}, "c": {"a"}, "x": {"y"}, "y": {"x"}},
+			want:  [][]string{{"x", "y"}, {"a", "b", "c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := importCycles(context.Background(), tt.graph)
+			if truncated {
+				t.Error("truncated, want every cycle")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cycles = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportCyclesDenseGraph(t *testing.T) {
+	// A complete graph of 30 packages has more elementary cycles than could
+	// ever be enumerated; the search must stop at the limit promptly
+	graph := make(map[string][]string)
+	for i := range 30 {
+		from := fmt.Sprintf("p%02d", i)
+		for j := range 30 {
+			if i != j {
+				graph[from] = append(graph[from], fmt.Sprintf("p%02d", j))
+			}
+		}
+	}
+
+	started := time.Now()
+	cycles, truncated := importCycles(context.Background(), graph)
+	if !truncated || len(cycles) != maxImportCycles {
+		t.Errorf("found %d cycles (truncated=%v), want %d and truncated", len(cycles), truncated, maxImportCycles)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("took %s", elapsed)
+	}
+}
@@ -0,0 +1,384 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxDataFlowEvents = 300 // Limit occurrences listed by DataFlow
+
+// flowEvent is one occurrence of the traced variable
+type flowEvent struct {
+	line    int
+	kind    string // parameter, define, declare, assign, update, mutate, address, call or use
+	detail  string
+	closure bool
+	decl    token.Pos // declaration the occurrence resolves to, when known
+}
+
+// DataFlow lists the declarations, assignments, mutations and uses of a
+// variable within one function of a Go file, in source order. It works on the
+// syntax tree alone, so aliasing through pointers and calls is only flagged,
+// not followed.
+func (h *Handler) DataFlow(ctx context.Context, path, function, variable string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	resolved, err := h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(resolved, ".go") {
+		return "", fmt.Errorf("not a Go file: %s", path)
+	}
+	fset, files, err := h.parseGoPath(ctx, resolved, true, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("%s is outside the allowed roots", path)
+	}
+	source, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	lines := strings.Split(string(source), "\n")
+
+	fn, err := findFunc(files[0].ast, function)
+	if err != nil {
+		return "", fmt.Errorf("%w in %s", err, path)
+	}
+
+	var events []flowEvent
+	var stack []ast.Node
+	ast.Inspect(fn, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == variable && ident != fn.Name {
+			if event, ok := classifyFlow(ident, stack); ok {
+				event.line = fset.Position(ident.Pos()).Line
+				events = append(events, event)
+			}
+		}
+		stack = append(stack, n)
+		return true
+	})
+
+	start, end := fset.Position(fn.Pos()).Line, fset.Position(fn.End()).Line
+	if len(events) == 0 {
+		return fmt.Sprintf("%s does not appear in %s (%s:%d-%d)", variable, funcName(fn), resolved, start, end), nil
+	}
+
+	// Number each distinct declaration so shadowed variables can be told apart
+	declLines := make(map[token.Pos]int)
+	for _, e := range events {
+		if e.decl.IsValid() {
+			declLines[e.decl] = fset.Position(e.decl).Line
+		}
+	}
+	var decls []token.Pos
+	for pos := range declLines {
+		decls = append(decls, pos)
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i] < decls[j] })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Data flow of %s in %s (%s:%d-%d), best-effort from syntax without type information:\n", variable, funcName(fn), resolved, start, end)
+	if len(decls) > 1 {
+		var lines []string
+		for i, pos := range decls {
+			lines = append(lines, fmt.Sprintf("#%d declared at line %d", i+1, declLines[pos]))
+		}
+		fmt.Fprintf(&b, "%s is declared %d times (shadowing): %s\n", variable, len(decls), strings.Join(lines, ", "))
+	}
+	b.WriteString("\n")
+
+	for i, e := range events {
+		if i >= maxDataFlowEvents {
+			fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("showing %d of %d occurrences", maxDataFlowEvents, len(events)), fmt.Sprintf("%d occurrences", len(events)-maxDataFlowEvents), ""))
+			break
+		}
+		label := e.kind
+		if len(decls) > 1 {
+			if idx := sort.Search(len(decls), func(i int) bool { return decls[i] >= e.decl }); idx < len(decls) && decls[idx] == e.decl {
+				label += fmt.Sprintf(" #%d", idx+1)
+			}
+		}
+		detail := e.detail
+		if e.closure {
+			detail += " (inside a closure)"
+		}
+		code := ""
+		if e.line-1 < len(lines) {
+			code = strings.TrimSpace(lines[e.line-1])
+		}
+		fmt.Fprintf(&b, "%5d  %-10s %s\n       | %s\n", e.line, label, detail, code)
+	}
+	b.WriteString("\nKinds: mutate changes part of the value (field, element or pointee); address and call flag where it may change through a pointer or method.\n")
+	return b.String(), nil
+}
+
+// findFunc finds a function by name, or a method by Type.Method or by an unambiguous method name
+func findFunc(f *ast.File, name string) (*ast.FuncDecl, error) {
+	var methods []*ast.FuncDecl
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if funcName(fn) == name {
+			return fn, nil
+		}
+		if fn.Recv != nil && fn.Name.Name == name {
+			methods = append(methods, fn)
+		}
+	}
+	switch len(methods) {
+	case 0:
+		return nil, fmt.Errorf("function %s not found", name)
+	case 1:
+		return methods[0], nil
+	default:
+		names := make([]string, len(methods))
+		for i, fn := range methods {
+			names[i] = funcName(fn)
+		}
+		return nil, fmt.Errorf("%s is ambiguous, qualify it as one of: %s", name, strings.Join(names, ", "))
+	}
+}
+
+// classifyFlow describes an occurrence of the variable from its enclosing
+// nodes. It reports false for identifiers that only share the name, such as
+// field selectors and struct literal keys.
+func classifyFlow(ident *ast.Ident, stack []ast.Node) (flowEvent, bool) {
+	event := flowEvent{}
+	if ident.Obj != nil {
+		if pos := objectPos(ident.Obj); pos.IsValid() {
+			event.decl = pos
+		}
+	}
+	for _, n := range stack {
+		if _, ok := n.(*ast.FuncLit); ok {
+			event.closure = true
+		}
+	}
+
+	// Climb selector, index, dereference and paren expressions rooted at the identifier
+	var top ast.Expr = ident
+	i := len(stack) - 1
+	for ; i >= 0; i-- {
+		switch p := stack[i].(type) {
+		case *ast.SelectorExpr:
+			if p.Sel == top {
+				return event, false // x.name is a field or method, not the variable
+			}
+			if p.X != top {
+				break
+			}
+			top = p
+			continue
+		case *ast.IndexExpr:
+			if p.X == top {
+				top = p
+				continue
+			}
+		case *ast.StarExpr:
+			top = p
+			continue
+		case *ast.ParenExpr:
+			top = p
+			continue
+		}
+		break
+	}
+	var parent ast.Node
+	if i >= 0 {
+		parent = stack[i]
+	}
+	direct := top == ast.Expr(ident)
+	expr := flowExpr(top)
+
+	switch p := parent.(type) {
+	case *ast.Field:
+		event.kind, event.detail = "parameter", "declared as a parameter or result"
+		for j := i - 1; j >= 0; j-- {
+			if fl, ok := stack[j].(*ast.FieldList); ok {
+				if j > 0 {
+					if fd, ok := stack[j-1].(*ast.FuncDecl); ok && fd.Recv == fl {
+						event.detail = "declared as the receiver"
+					} else if ft, ok := stack[j-1].(*ast.FuncType); ok && ft.Results == fl {
+						event.detail = "declared as a named result"
+					} else {
+						event.detail = "declared as a parameter"
+					}
+				}
+				break
+			}
+		}
+		if !direct {
+			return event, false
+		}
+		event.decl = ident.Pos()
+	case *ast.AssignStmt:
+		if !containsExpr(p.Lhs, top) {
+			event.kind, event.detail = "use", "read in assignment to "+exprList(p.Lhs)
+			break
+		}
+		switch {
+		case !direct:
+			event.kind, event.detail = "mutate", expr+" "+p.Tok.String()+" "+exprList(p.Rhs)
+		case p.Tok == token.DEFINE:
+			event.kind, event.detail = "define", ":= "+exprList(p.Rhs)
+		case p.Tok == token.ASSIGN:
+			event.kind, event.detail = "assign", "= "+exprList(p.Rhs)
+		default:
+			event.kind, event.detail = "update", p.Tok.String()+" "+exprList(p.Rhs)
+		}
+	case *ast.IncDecStmt:
+		event.kind, event.detail = "update", expr+p.Tok.String()
+		if !direct {
+			event.kind = "mutate"
+		}
+	case *ast.ValueSpec:
+		if direct && containsIdent(p.Names, ident) {
+			event.kind, event.detail = "declare", "var declaration"
+			if len(p.Values) > 0 {
+				event.detail += " = " + exprList(p.Values)
+			}
+			event.decl = ident.Pos()
+		} else {
+			event.kind, event.detail = "use", "read in var declaration"
+		}
+	case *ast.RangeStmt:
+		switch {
+		case top == p.Key || top == p.Value:
+			event.kind, event.detail = "assign", "set by range over "+flowExpr(p.X)
+			if p.Tok == token.DEFINE {
+				event.kind = "define"
+			}
+		default:
+			event.kind, event.detail = "use", "ranged over"
+		}
+	case *ast.UnaryExpr:
+		if p.Op == token.AND {
+			event.kind, event.detail = "address", "&"+expr+" taken; may be changed through the pointer"
+		} else {
+			event.kind, event.detail = "use", "operand of "+p.Op.String()
+		}
+	case *ast.CallExpr:
+		switch {
+		case p.Fun == top && !direct:
+			event.kind, event.detail = "call", "method call "+expr+"(); may change the value"
+		case p.Fun == top:
+			event.kind, event.detail = "call", "called as a function"
+		default:
+			event.kind, event.detail = "use", "passed to "+flowExpr(p.Fun)+"()"
+		}
+	case *ast.ReturnStmt:
+		event.kind, event.detail = "use", "returned"
+	case *ast.IfStmt, *ast.ForStmt, *ast.SwitchStmt:
+		event.kind, event.detail = "use", "condition or switch tag"
+	case *ast.BinaryExpr:
+		event.kind, event.detail = "use", "compared or combined with "+p.Op.String()
+	case *ast.SendStmt:
+		if p.Chan == top {
+			event.kind, event.detail = "use", "sent on"
+		} else {
+			event.kind, event.detail = "use", "sent on channel "+flowExpr(p.Chan)
+		}
+	case *ast.KeyValueExpr:
+		if p.Key == top {
+			return event, false // struct literal field name
+		}
+		event.kind, event.detail = "use", "stored in a composite literal"
+	case *ast.CompositeLit:
+		event.kind, event.detail = "use", "stored in a composite literal"
+	default:
+		event.kind, event.detail = "use", "read"
+	}
+	if !direct && event.kind == "use" {
+		event.detail = expr + " " + event.detail
+	}
+	return event, true
+}
+
+// objectPos returns where a resolved object is declared
+func objectPos(obj *ast.Object) token.Pos {
+	if node, ok := obj.Decl.(ast.Node); ok {
+		switch d := node.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range d.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Name == obj.Name {
+					return id.Pos()
+				}
+			}
+		case *ast.ValueSpec:
+			for _, id := range d.Names {
+				if id.Name == obj.Name {
+					return id.Pos()
+				}
+			}
+		case *ast.Field:
+			for _, id := range d.Names {
+				if id.Name == obj.Name {
+					return id.Pos()
+				}
+			}
+		}
+		return node.Pos()
+	}
+	return token.NoPos
+}
+
+// containsExpr reports whether exprs holds target
+func containsExpr(exprs []ast.Expr, target ast.Expr) bool {
+	for _, e := range exprs {
+		if e == target {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIdent reports whether idents holds target
+func containsIdent(idents []*ast.Ident, target *ast.Ident) bool {
+	for _, id := range idents {
+		if id == target {
+			return true
+		}
+	}
+	return false
+}
+
+// maxFlowExprLen limits the length of expressions quoted in DataFlow output
+const maxFlowExprLen = 60
+
+// flowExpr renders an expression as source, shortened for display
+func flowExpr(expr ast.Expr) string {
+	s := types.ExprString(expr)
+	if len(s) > maxFlowExprLen {
+		s = s[:maxFlowExprLen-3] + "..."
+	}
+	return s
+}
+
+// exprList renders expressions as comma-separated source, shortened for display
+func exprList(exprs []ast.Expr) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = flowExpr(e)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,382 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	maxDiffDirFiles   = 20000     // Limit files walked per directory tree
+	maxDiffFileLines  = 5000      // Larger files are reported as modified without an inline diff
+	maxFileDiffLines  = 200       // Limit inline diff lines per modified file
+	maxDiffDirsOutput = 64 * 1024 // Limit total inline diff output
+	diffContextLines  = 3
+	maxLCSCells       = 4 << 20 // Beyond this, changed regions are shown as a whole removal and addition
+)
+
+// dirEntry is a regular file found while walking a tree for DiffDirs
+type dirEntry struct {
+	path string // absolute path
+	size int64
+}
+
+// DiffDirs compares two directory trees and reports files added, removed and
+// modified (by content hash) in newDir relative to oldDir. With includeDiffs,
+// modified text files get a capped unified diff. Hidden, vendor, node_modules,
+// dist and build directories are skipped, as in recursive grep_files.
+func (h *Handler) DiffDirs(ctx context.Context, oldDir, newDir string, includeDiffs bool) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	oldDir, err := h.resolvePath(oldDir)
+	if err != nil {
+		return "", err
+	}
+	newDir, err = h.resolvePath(newDir)
+	if err != nil {
+		return "", err
+	}
+
+	oldFiles, err := h.walkTree(ctx, oldDir)
+	if err != nil {
+		return "", err
+	}
+	newFiles, err := h.walkTree(ctx, newDir)
+	if err != nil {
+		return "", err
+	}
+
+	var added, removed, modified []string
+	for rel := range newFiles {
+		if _, ok := oldFiles[rel]; !ok {
+			added = append(added, rel)
+		}
+	}
+	for rel, oldFile := range oldFiles {
+		newFile, ok := newFiles[rel]
+		if !ok {
+			removed = append(removed, rel)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		same, err := sameContent(oldFile, newFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to compare %s: %w", rel, err)
+		}
+		if !same {
+			modified = append(modified, rel)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Comparing %s (old) to %s (new): %d added, %d removed, %d modified, %d unchanged\n",
+		oldDir, newDir, len(added), len(removed), len(modified), len(oldFiles)-len(removed)-len(modified))
+	if len(added)+len(removed)+len(modified) == 0 {
+		b.WriteString("\nThe trees are identical")
+		return b.String(), nil
+	}
+	writeFileList(&b, "Added", added)
+	writeFileList(&b, "Removed", removed)
+	writeFileList(&b, "Modified", modified)
+
+	if includeDiffs && len(modified) > 0 {
+		b.WriteString("\nDiffs:\n")
+		budget := maxDiffDirsOutput
+		for i, rel := range modified {
+			if budget <= 0 {
+				fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("diff output limit of %d bytes", maxDiffDirsOutput), fmt.Sprintf("diffs of %d more files", len(modified)-i), "Compare narrower directories for the rest."))
+				break
+			}
+			diff := fileDiff(oldFiles[rel], newFiles[rel], rel)
+			if len(diff) > budget {
+				diff = truncate.Bytes(diff, budget, fmt.Sprintf("diff output limit of %d bytes", maxDiffDirsOutput), "Compare narrower directories for the rest.") + "\n"
+			}
+			budget -= len(diff)
+			b.WriteString("\n" + diff)
+		}
+	}
+	return b.String(), nil
+}
+
+// walkTree collects the regular files below root, keyed by slash-separated
+// relative path. Like recursive grep_files, it skips hidden files, ignored and
+// hidden directories, and files read_file may not open.
+func (h *Handler) walkTree(ctx context.Context, root string) (map[string]dirEntry, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", root)
+	}
+
+	files := make(map[string]dirEntry)
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (ignoredGrepDirs[name] || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(name, ".") || !h.withinRoots(path) || h.checkExtension(path) != nil {
+			return nil
+		}
+		if len(files) >= maxDiffDirFiles {
+			return fmt.Errorf("more than %d files under %s: narrow the directories", maxDiffDirFiles, root)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		files[filepath.ToSlash(rel)] = dirEntry{path: path, size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// sameContent reports whether two files have identical contents, comparing
+// sizes before streaming SHA-256 hashes
+func sameContent(a, b dirEntry) (bool, error) {
+	if a.size != b.size {
+		return false, nil
+	}
+	hashA, err := hashFile(a.path)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := hashFile(b.path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hashA, hashB), nil
+}
+
+// hashFile returns the SHA-256 hash of a file's contents
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// writeFileList appends a labelled list of relative paths
+func writeFileList(b *strings.Builder, label string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s (%d):\n", label, len(paths))
+	for _, path := range paths {
+		fmt.Fprintf(b, "  %s\n", path)
+	}
+}
+
+// fileDiff returns a unified diff between two versions of a file, or a note
+// when either is binary or too large to diff inline
+func fileDiff(oldFile, newFile dirEntry, rel string) string {
+	header := fmt.Sprintf("--- a/%s\n+++ b/%s\n", rel, rel)
+	if oldFile.size > maxFileSize || newFile.size > maxFileSize {
+		return header + truncate.Marker(fmt.Sprintf("file size limit of %d bytes", maxFileSize), "the diff", "Compare the files with grep_in_file or read_file line ranges.") + "\n"
+	}
+	oldData, err := os.ReadFile(oldFile.path)
+	if err != nil {
+		return header + fmt.Sprintf("(unreadable: %v)\n", err)
+	}
+	newData, err := os.ReadFile(newFile.path)
+	if err != nil {
+		return header + fmt.Sprintf("(unreadable: %v)\n", err)
+	}
+	if bytes.IndexByte(oldData, 0) >= 0 || bytes.IndexByte(newData, 0) >= 0 {
+		return header + "(binary files differ)\n"
+	}
+
+	oldLines, newLines := splitLines(string(oldData)), splitLines(string(newData))
+	if len(oldLines) > maxDiffFileLines || len(newLines) > maxDiffFileLines {
+		return header + fmt.Sprintf("(too many lines to diff: %d -> %d)\n", len(oldLines), len(newLines))
+	}
+
+	hunks := unifiedHunks(oldLines, newLines)
+	lines := strings.Split(strings.TrimSuffix(hunks, "\n"), "\n")
+	if len(lines) > maxFileDiffLines {
+		return header + strings.Join(lines[:maxFileDiffLines], "\n") + "\n" + truncate.Marker(fmt.Sprintf("limit of %d diff lines per file", maxFileDiffLines), fmt.Sprintf("%d diff lines", len(lines)-maxFileDiffLines), "") + "\n"
+	}
+	return header + hunks
+}
+
+// splitLines splits text into lines without their trailing newlines
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedHunks renders the line diff of a and b as unified diff hunks,
+// using a longest common subsequence after trimming common prefix and suffix
+func unifiedHunks(a, b []string) string {
+	var ops []diffOp
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops = append(ops, lcsOps(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := len(a) - suffix; i < len(a); i++ {
+		ops = append(ops, diffOp{' ', a[i]})
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and the extent of its hunk
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		from := max(first-diffContextLines, start)
+		end := first
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContextLines {
+				break
+			}
+			end = next
+		}
+		to := min(end+diffContextLines, len(ops))
+
+		// Line numbers of the hunk start in each version
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, op := range ops[from:to] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// lcsOps returns an edit script turning a into b via a longest common subsequence
+func lcsOps(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxLCSCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lengths[i][j] is the LCS length of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
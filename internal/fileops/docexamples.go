@@ -0,0 +1,467 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	docExampleTimeout   = time.Minute // per snippet, including the first build of its dependencies
+	maxDocExamples      = 30          // Limit code blocks compiled per call
+	maxDocExampleErrors = 10          // Limit compiler errors listed per example
+)
+
+// docExampleModule is the module path of the scratch module examples are compiled in
+const docExampleModule = "docexamples.invalid"
+
+// stdlibImports are the standard library packages added to snippets that
+// reference them without an import block, keyed by package name
+var stdlibImports = map[string]string{
+	"bufio": "bufio", "bytes": "bytes", "context": "context", "errors": "errors",
+	"filepath": "path/filepath", "fmt": "fmt", "http": "net/http", "io": "io",
+	"json": "encoding/json", "log": "log", "math": "math", "os": "os",
+	"regexp": "regexp", "sort": "sort", "strconv": "strconv", "strings": "strings",
+	"sync": "sync", "time": "time", "url": "net/url", "exec": "os/exec",
+}
+
+var (
+	// compileErrorRe matches a compiler error in a snippet file: ex.go:line:col: message
+	compileErrorRe = regexp.MustCompile(`ex\.go:(\d+)(?::\d+)?: (.*)`)
+	mainFuncRe     = regexp.MustCompile(`(?m)^func main\(\)`)
+	importDeclRe   = regexp.MustCompile(`(?m)^import\b`)
+)
+
+// docExample is one fenced Go code block found in a markdown file
+type docExample struct {
+	path    string
+	line    int // line of the first code line in the markdown file
+	code    string
+	skipped bool // marked ignore or nocompile in the info string
+}
+
+// exampleResult is the outcome of compiling one example
+type exampleResult struct {
+	example docExample
+	wrapped string   // how the snippet was completed before compiling, "" if it compiled as written
+	errors  []string // markdown-relative compiler errors, nil when it compiled
+}
+
+// CheckDocExamples extracts the fenced Go code blocks from markdown files
+// matching pattern and compiles each one, completing snippets with a package
+// clause, common imports or an enclosing function as needed. Examples that
+// import the documented module are built against the local copy. go must be
+// on the command allowlist.
+func (h *Handler) CheckDocExamples(ctx context.Context, pattern string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !h.allowedCommands["go"] {
+		return "", fmt.Errorf("check_doc_examples requires go in -allowed-commands")
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	pattern, err := h.resolvePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	matches, note, err := h.globPaths(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid path pattern: %w", err)
+	}
+	if len(matches) == 0 {
+		return h.noMatch(ctx, pattern) + globNote(note), nil
+	}
+
+	var examples []docExample
+	var skipped []skippedFile
+	for _, path := range matches {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		if err := h.checkExtension(path); err != nil {
+			skipped = append(skipped, skippedFile{path, err.Error()})
+			continue
+		}
+		found, err := extractGoBlocks(path)
+		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+			continue
+		}
+		examples = append(examples, found...)
+	}
+	if len(examples) == 0 {
+		return fmt.Sprintf("No fenced Go code blocks found in files matching %s%s", pattern, skippedNote(skipped)+globNote(note)), nil
+	}
+
+	omitted := 0
+	var toCompile []docExample
+	for _, ex := range examples {
+		if ex.skipped {
+			continue
+		}
+		if len(toCompile) == maxDocExamples {
+			omitted++
+			continue
+		}
+		toCompile = append(toCompile, ex)
+	}
+
+	results, err := h.compileExamples(ctx, toCompile)
+	if err != nil {
+		return "", err
+	}
+	return formatDocExamples(examples, results, omitted) + skippedNote(skipped) + globNote(note), nil
+}
+
+// extractGoBlocks returns the ```go and ```golang fenced blocks of a markdown file
+func extractGoBlocks(path string) ([]docExample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	var examples []docExample
+	var current *docExample
+	var fence, indent string
+	var body []string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		trimmed := strings.TrimLeft(line, " ")
+
+		if fence != "" {
+			// A closing fence is at least as long as the opening one, with nothing after it
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+				if current != nil {
+					current.code = strings.Join(body, "\n")
+					examples = append(examples, *current)
+				}
+				fence, current, body = "", nil, nil
+				continue
+			}
+			if current != nil {
+				body = append(body, strings.TrimPrefix(line, indent))
+			}
+			continue
+		}
+
+		if len(line)-len(trimmed) > 3 || !(strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			continue
+		}
+		marker := trimmed[:1]
+		n := len(trimmed) - len(strings.TrimLeft(trimmed, marker))
+		fence, indent = strings.Repeat(marker, n), line[:len(line)-len(trimmed)]
+		info := strings.Fields(strings.ToLower(strings.Trim(trimmed[n:], " \t{}")))
+		if len(info) > 0 && (info[0] == "go" || info[0] == "golang") {
+			current = &docExample{path: path, line: lineNum + 1}
+			for _, word := range info[1:] {
+				if word == "ignore" || word == "nocompile" {
+					current.skipped = true
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	// An unclosed fence runs to the end of the document
+	if current != nil {
+		current.code = strings.Join(body, "\n")
+		examples = append(examples, *current)
+	}
+	return examples, nil
+}
+
+// compileExamples builds each example in its own package of a scratch module.
+// The module only requires the documented module when an example imports it,
+// so stdlib-only examples compile without its dependencies.
+func (h *Handler) compileExamples(ctx context.Context, examples []docExample) ([]exampleResult, error) {
+	tmp, err := os.MkdirTemp("", "doc-examples-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	results := make([]exampleResult, 0, len(examples))
+	modRoots := make(map[string]bool)
+	for i, ex := range examples {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		source, wrapped, header := completeSnippet(ex.code)
+
+		gomod := "module " + docExampleModule + "\n\ngo 1.21\n"
+		if root, module := h.moduleRoot(filepath.Dir(ex.path)); module != "" && importsModule(source, module) {
+			gomod = fmt.Sprintf("module %s\n\n%s\n\nrequire %s v0.0.0\n\nreplace %s => %s\n", docExampleModule, goDirective(filepath.Join(root, "go.mod")), module, module, root)
+			if !modRoots[root] {
+				modRoots[root] = true
+				if sum, err := os.ReadFile(filepath.Join(root, "go.sum")); err == nil {
+					if err := appendFile(filepath.Join(tmp, "go.sum"), sum); err != nil {
+						return nil, fmt.Errorf("failed to write go.sum: %w", err)
+					}
+				}
+			}
+		}
+		if err := os.WriteFile(filepath.Join(tmp, "go.mod"), []byte(gomod), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write go.mod: %w", err)
+		}
+
+		pkg := "s" + strconv.Itoa(i)
+		if err := os.MkdirAll(filepath.Join(tmp, pkg), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create build directory: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, pkg, "ex.go"), []byte(source), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write example: %w", err)
+		}
+
+		output, err := buildExample(ctx, tmp, pkg)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, exampleResult{example: ex, wrapped: wrapped, errors: exampleErrors(ex, output, header, wrapped != "")})
+	}
+	return results, nil
+}
+
+// buildExample compiles one example package, returning the compiler output on
+// failure. Dependencies are only taken from the module cache.
+func buildExample(ctx context.Context, dir, pkg string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, docExampleTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", os.DevNull, "./"+pkg)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	output := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return fmt.Sprintf("ex.go:1: build timed out after %s", docExampleTimeout), nil
+		case errors.As(err, &exitErr):
+			if out := strings.TrimSpace(output.buf.String()); out != "" {
+				return out, nil
+			}
+			return fmt.Sprintf("ex.go:1: go build failed (exit code %d)", exitErr.ExitCode()), nil
+		default:
+			return "", fmt.Errorf("failed to run go build: %w", err)
+		}
+	}
+	return "", nil
+}
+
+// completeSnippet turns a code block into a compilable file. A block with a
+// package clause is used as written; top-level declarations get a package
+// clause, and anything else is treated as statements in a function body.
+// Stdlib packages referenced without an import block are imported. It returns
+// the source, a description of what was added, and how many lines were added
+// before the snippet.
+func completeSnippet(code string) (source, wrapped string, header int) {
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "ex.go", code, parser.PackageClauseOnly); err == nil {
+		return code, "", 0
+	}
+
+	imports := snippetImports(code)
+	pkg := "package example\n"
+	if _, err := parser.ParseFile(fset, "ex.go", pkg+imports+code, parser.AllErrors); err == nil {
+		if mainFuncRe.MatchString(code) {
+			pkg = "package main\n"
+		}
+		header = strings.Count(pkg+imports, "\n")
+		return pkg + imports + code, describeWrap("a package clause", imports), header
+	}
+
+	prefix := pkg + imports + "func _() {\n"
+	return prefix + code + "\n}\n", describeWrap("a function body", imports), strings.Count(prefix, "\n")
+}
+
+// snippetImports returns an import block for the stdlib packages a snippet
+// without its own imports refers to
+func snippetImports(code string) string {
+	if importDeclRe.MatchString(code) {
+		return ""
+	}
+	var paths []string
+	for name, path := range stdlibImports {
+		if regexp.MustCompile(`\b` + name + `\.[A-Z]`).MatchString(code) {
+			paths = append(paths, strconv.Quote(path))
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+	sort.Strings(paths)
+	return "import (\n" + strings.Join(paths, "\n") + "\n)\n"
+}
+
+// describeWrap says how a snippet was completed
+func describeWrap(what, imports string) string {
+	if imports == "" {
+		return "wrapped in " + what
+	}
+	return "wrapped in " + what + " with stdlib imports added"
+}
+
+// exampleErrors maps compiler errors back to lines of the markdown file.
+// Unused variables and imports are expected in completed fragments and ignored.
+func exampleErrors(ex docExample, output string, header int, wrapped bool) []string {
+	if output == "" {
+		return nil
+	}
+	var errs []string
+	for _, line := range strings.Split(output, "\n") {
+		m := compileErrorRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		msg := m[2]
+		if wrapped && (strings.Contains(msg, "declared and not used") || strings.Contains(msg, "imported and not used")) {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		errs = append(errs, fmt.Sprintf("%s:%d: %s", ex.path, ex.line+max(n-header-1, 0), msg))
+	}
+	if len(errs) == 0 && !compileErrorRe.MatchString(output) {
+		// Not a compiler error, such as a module that can't be resolved offline
+		errs = append(errs, fmt.Sprintf("%s:%d: %s", ex.path, ex.line, lastLines(output, maxDocExampleErrors)))
+	}
+	return errs
+}
+
+// formatDocExamples reports failing examples first, then the ones that compiled
+func formatDocExamples(examples []docExample, results []exampleResult, omitted int) string {
+	var failed, passed []exampleResult
+	for _, r := range results {
+		if len(r.errors) > 0 {
+			failed = append(failed, r)
+		} else {
+			passed = append(passed, r)
+		}
+	}
+	skipped := 0
+	for _, ex := range examples {
+		if ex.skipped {
+			skipped++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Checked %d Go code blocks: %d failed, %d compiled", len(results), len(failed), len(passed))
+	if skipped > 0 {
+		fmt.Fprintf(&b, ", %d marked ignore or nocompile", skipped)
+	}
+	b.WriteString("\n")
+
+	if len(failed) > 0 {
+		fmt.Fprintf(&b, "\nFailed (%d):\n", len(failed))
+		for _, r := range failed {
+			fmt.Fprintf(&b, "  %s:%d", r.example.path, r.example.line)
+			if r.wrapped != "" {
+				fmt.Fprintf(&b, " (%s)", r.wrapped)
+			}
+			b.WriteString("\n")
+			for i, msg := range r.errors {
+				if i == maxDocExampleErrors {
+					fmt.Fprintf(&b, "    %s\n", truncate.Marker(fmt.Sprintf("limit of %d errors per example", maxDocExampleErrors), fmt.Sprintf("%d more errors", len(r.errors)-maxDocExampleErrors), ""))
+					break
+				}
+				fmt.Fprintf(&b, "    %s\n", msg)
+			}
+		}
+	}
+	if len(passed) > 0 {
+		fmt.Fprintf(&b, "\nCompiled (%d):\n", len(passed))
+		for _, r := range passed {
+			fmt.Fprintf(&b, "  %s:%d", r.example.path, r.example.line)
+			if r.wrapped != "" {
+				fmt.Fprintf(&b, " (%s)", r.wrapped)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("limit of %d code blocks", maxDocExamples), fmt.Sprintf("%d more code blocks", omitted), "Check fewer markdown files at a time."))
+	}
+	return b.String()
+}
+
+// moduleRoot returns the directory and path of the module containing dir,
+// searching up to the allowed roots, or "" when there is none
+func (h *Handler) moduleRoot(dir string) (string, string) {
+	for d := dir; h.withinRoots(d); d = filepath.Dir(d) {
+		if module := modulePath(filepath.Join(d, "go.mod")); module != "" {
+			return d, module
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return "", ""
+}
+
+// importsModule reports whether source imports module or one of its packages
+func importsModule(source, module string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "ex.go", source, parser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if path == module || strings.HasPrefix(path, module+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// goDirective returns the go line of a go.mod file, defaulting to go 1.21
+func goDirective(gomod string) string {
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return "go 1.21"
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "go ") {
+			return line
+		}
+	}
+	return "go 1.21"
+}
+
+// appendFile appends data to the file at path, creating it if needed
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,153 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxDocMatches = 100 // Limit doc comments returned by GrepDocs
+
+// docComment is a doc comment and the declaration it documents
+type docComment struct {
+	pos    token.Position
+	symbol string
+	text   string
+}
+
+// GrepDocs searches only the doc comments of Go declarations in a .go file,
+// or in every .go file below a directory, and returns each matching comment
+// with the symbol it documents
+func (h *Handler) GrepDocs(ctx context.Context, pattern, path string, ignoreCase bool) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := h.checkGrepPattern(pattern); err != nil {
+		return "", err
+	}
+
+	flags := ""
+	if ignoreCase {
+		flags = "(?i)"
+	}
+	re, err := regexp.Compile(flags + pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex pattern: %w", err)
+	}
+
+	resolved, err := h.resolvePath(h.defaultDir(path))
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat path: %w", err)
+	}
+
+	var fset *token.FileSet
+	var files []goFile
+	if info.IsDir() {
+		fset, files, err = h.parseGoTree(ctx, path, false, parser.ParseComments)
+	} else {
+		fset, files, err = h.parseGoPath(ctx, path, true, parser.ParseComments)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var matches []docComment
+	total := 0
+	for _, f := range files {
+		for _, doc := range fileDocComments(fset, f.ast) {
+			if !re.MatchString(doc.text) {
+				continue
+			}
+			total++
+			if len(matches) < maxDocMatches {
+				matches = append(matches, doc)
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return "No doc comments matched", nil
+	}
+
+	var b strings.Builder
+	for _, m := range matches {
+		fmt.Fprintf(&b, "%s:%d %s\n", m.pos.Filename, m.pos.Line, m.symbol)
+		for _, line := range strings.Split(strings.TrimRight(m.text, "\n"), "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+		b.WriteString("\n")
+	}
+	if total > len(matches) {
+		fmt.Fprintf(&b, "%s\n", truncate.Marker(fmt.Sprintf("showing %d of %d matching doc comments", len(matches), total), fmt.Sprintf("%d doc comments", total-len(matches)), "Narrow the pattern or path."))
+	}
+	return b.String(), nil
+}
+
+// fileDocComments returns the package, declaration, spec and struct field doc comments in a file
+func fileDocComments(fset *token.FileSet, f *ast.File) []docComment {
+	var docs []docComment
+	add := func(group *ast.CommentGroup, symbol string) {
+		if group == nil {
+			return
+		}
+		docs = append(docs, docComment{pos: fset.Position(group.Pos()), symbol: symbol, text: group.Text()})
+	}
+
+	add(f.Doc, "package "+f.Name.Name)
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind := "func "
+			if d.Recv != nil {
+				kind = "method "
+			}
+			add(d.Doc, kind+funcName(d))
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					doc := sp.Doc
+					if doc == nil && len(d.Specs) == 1 {
+						doc = d.Doc
+					}
+					add(doc, "type "+sp.Name.Name)
+					if st, ok := sp.Type.(*ast.StructType); ok {
+						for _, field := range st.Fields.List {
+							for _, name := range field.Names {
+								add(field.Doc, "field "+sp.Name.Name+"."+name.Name)
+							}
+						}
+					}
+				case *ast.ValueSpec:
+					doc := sp.Doc
+					if doc == nil && len(d.Specs) == 1 {
+						doc = d.Doc
+					}
+					names := make([]string, len(sp.Names))
+					for i, name := range sp.Names {
+						names[i] = name.Name
+					}
+					add(doc, d.Tok.String()+" "+strings.Join(names, ", "))
+				}
+			}
+			// A doc comment on a grouped declaration documents the whole group
+			if len(d.Specs) > 1 {
+				add(d.Doc, d.Tok.String()+" (...)")
+			}
+		}
+	}
+	return docs
+}
@@ -3,25 +3,314 @@ package fileops
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
 )
 
 // Handler provides file operation capabilities
-type Handler struct{}
+type Handler struct {
+	roots           []string // allowed root directories, empty means unrestricted
+	allowedCommands map[string]bool
+	readableExts    map[string]bool  // if set, only these extensions may be read
+	forbiddenExts   map[string]bool  // extensions (or dotfile names) that may never be read
+	forbiddenGreps  []*regexp.Regexp // meta-patterns a grep pattern may not match
+	allowGit        bool             // permit git history lookups such as grep blame
+	relativePaths   bool             // rewrite absolute paths in output, see RelativizePaths
+	pathPrefixes    []pathPrefix
+	maxGlobDirs     int           // directories a ** glob may read, see WithMaxGlobDirs
+	fifoTimeout     time.Duration // longest wait for a named pipe's data, 0 refuses pipes
+}
+
+// Option configures a Handler
+type Option func(*Handler)
+
+// WithAllowedRoots restricts all file operations to paths within the given directories
+func WithAllowedRoots(roots ...string) Option {
+	return func(h *Handler) {
+		for _, root := range roots {
+			if root == "" {
+				continue
+			}
+			h.roots = append(h.roots, canonicalPath(root))
+		}
+	}
+}
+
+// WithReadableExtensions restricts reads to files with the given extensions (e.g. ".go", "md").
+// Entries also match whole file names, so extensionless files can be allowed (e.g. "Makefile").
+func WithReadableExtensions(exts ...string) Option {
+	return func(h *Handler) {
+		h.readableExts = addExtensions(h.readableExts, exts)
+	}
+}
+
+// WithForbiddenExtensions prevents reading files with the given extensions (e.g. ".pem", ".key").
+// Entries also match whole file names (e.g. ".env", "id_rsa").
+func WithForbiddenExtensions(exts ...string) Option {
+	return func(h *Handler) {
+		h.forbiddenExts = addExtensions(h.forbiddenExts, exts)
+	}
+}
+
+// WithForbiddenGrepPatterns refuses greps whose pattern matches any of the
+// given meta-patterns, so the model can't be steered into searching a tree for
+// secrets such as AWS_SECRET or private key headers.
+func WithForbiddenGrepPatterns(patterns ...*regexp.Regexp) Option {
+	return func(h *Handler) {
+		h.forbiddenGreps = append(h.forbiddenGreps, patterns...)
+	}
+}
+
+// checkGrepPattern returns a permission error if a grep pattern matches a forbidden meta-pattern
+func (h *Handler) checkGrepPattern(pattern string) error {
+	for _, forbidden := range h.forbiddenGreps {
+		if forbidden.MatchString(pattern) {
+			return fmt.Errorf("%w: searching for %q is forbidden by server policy, as it looks like a search for secrets", fs.ErrPermission, pattern)
+		}
+	}
+	return nil
+}
+
+// addExtensions normalizes extensions to lowercase with a leading dot and adds them to set
+func addExtensions(set map[string]bool, exts []string) map[string]bool {
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if set == nil {
+			set = make(map[string]bool)
+		}
+		set["."+strings.TrimPrefix(ext, ".")] = true
+	}
+	return set
+}
+
+// checkExtension returns a permission error if the file's extension may not
+// be read. A symlink is checked under its own name and its target's, so a
+// link can't disguise a forbidden file.
+func (h *Handler) checkExtension(path string) error {
+	if h.readableExts == nil && h.forbiddenExts == nil {
+		return nil
+	}
+	if err := h.checkExtensionName(path); err != nil {
+		return err
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil && filepath.Base(real) != filepath.Base(path) {
+		return h.checkExtensionName(real)
+	}
+	return nil
+}
+
+// checkExtensionName applies the extension allow and deny lists to the base
+// name of path
+func (h *Handler) checkExtensionName(path string) error {
+	name := strings.ToLower(filepath.Base(path))
+	ext := filepath.Ext(name)
+	keys := []string{"." + strings.TrimPrefix(name, ".")}
+	if ext != "" {
+		keys = append(keys, ext)
+	}
+
+	for _, key := range keys {
+		if h.forbiddenExts[key] {
+			return fmt.Errorf("%w: reading %s is forbidden by server policy", fs.ErrPermission, filepath.Base(path))
+		}
+	}
+	if h.readableExts != nil {
+		for _, key := range keys {
+			if h.readableExts[key] {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s is not an allowed file type for reading", fs.ErrPermission, filepath.Base(path))
+	}
+	return nil
+}
 
 // New creates a new file operations handler
-func New() *Handler {
-	return &Handler{}
+func New(opts ...Option) *Handler {
+	h := &Handler{}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.relativePaths {
+		h.buildPathPrefixes()
+	}
+	return h
 }
 
 const (
 	maxFileSize = 5 * 1024 * 1024 // 5MB
+
+	maxFileMatches  = 200 // Limit matches returned by GrepInFile
+	maxContextLines = 20
+
+	maxRecursiveGrepFiles = 5000 // Limit files searched when grep_files descends into directories
 )
 
+// ignoredGrepDirs are never descended into by recursive grep_files searches
+var ignoredGrepDirs = map[string]bool{"node_modules": true, "vendor": true, "dist": true, "build": true}
+
+// uriScheme matches a leading URI scheme such as file:// or https://
+var uriScheme = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.\-]*):`)
+
+// fromFileURI converts a file:// URI to a local path. Plain paths are returned
+// unchanged; other schemes are rejected. Accepts file:///abs/path,
+// file://localhost/abs/path and relative forms such as file:rel/path,
+// file://./rel/path and file://~/path.
+func fromFileURI(path string) (string, error) {
+	m := uriScheme.FindStringSubmatch(path)
+	// One-letter schemes are Windows drive letters (C:\...), not URIs
+	if m == nil || len(m[1]) == 1 {
+		return path, nil
+	}
+	if !strings.EqualFold(m[1], "file") {
+		if strings.HasPrefix(path[len(m[0]):], "//") {
+			return "", fmt.Errorf("unsupported URI scheme %q: only file:// URIs and local paths are supported", m[1])
+		}
+		// Not a URI, e.g. a file name containing a colon
+		return path, nil
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid file URI %s: %w", path, err)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid file URI %s: query strings and fragments are not supported", path)
+	}
+
+	var local string
+	switch {
+	case u.Opaque != "":
+		// file:rel/path
+		local, err = url.PathUnescape(u.Opaque)
+		if err != nil {
+			return "", fmt.Errorf("invalid file URI %s: %w", path, err)
+		}
+	case u.Host == "" || strings.EqualFold(u.Host, "localhost"):
+		local = u.Path
+		// file:///C:/dir becomes /C:/dir; drop the slash before the drive letter
+		if runtime.GOOS == "windows" && len(local) >= 3 && local[0] == '/' && local[2] == ':' {
+			local = local[1:]
+		}
+	case u.Host == "." || u.Host == ".." || u.Host == "~":
+		// file://./rel/path, file://../rel/path and file://~/path
+		local = u.Host + u.Path
+	default:
+		return "", fmt.Errorf("unsupported file URI %s: remote hosts (%s) are not supported", path, u.Host)
+	}
+	if local == "" {
+		return "", fmt.Errorf("invalid file URI %s: empty path", path)
+	}
+	return filepath.FromSlash(local), nil
+}
+
+// localPath converts file:// URIs and expands ~ to give a local filesystem path
+func localPath(path string) (string, error) {
+	path, err := fromFileURI(path)
+	if err != nil {
+		return "", err
+	}
+	return expandHome(path)
+}
+
+// expandHome expands a leading ~ to the home directory (only ~/path, not ~user/path)
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	if len(path) > 1 && path[1] != '/' && path[1] != filepath.Separator {
+		return "", fmt.Errorf("unsupported path format: only ~/ is supported, not ~username")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// canonicalPath returns the absolute path with symlinks resolved where possible
+func canonicalPath(path string) string {
+	if expanded, err := localPath(path); err == nil {
+		path = expanded
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	return path
+}
+
+// withinRoots reports whether path falls inside one of the allowed roots
+func (h *Handler) withinRoots(path string) bool {
+	if len(h.roots) == 0 {
+		return true
+	}
+	path = canonicalPath(path)
+	for _, root := range h.roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePath converts file:// URIs, expands ~ and checks the path is within the allowed roots
+func (h *Handler) resolvePath(path string) (string, error) {
+	path, err := localPath(path)
+	if err != nil {
+		return "", err
+	}
+	if !h.withinRoots(path) {
+		return "", h.outsideRootsError("path", path)
+	}
+	return path, nil
+}
+
+// outsideRootsError explains that a path or pattern is out of bounds and how to
+// stay within the allowed roots, so the model can correct itself rather than retry
+func (h *Handler) outsideRootsError(kind, path string) error {
+	example := filepath.Join(h.roots[0], "**", "*")
+	hint := ""
+	if !filepath.IsAbs(path) {
+		if cwd, err := os.Getwd(); err == nil {
+			hint = fmt.Sprintf(" Relative paths resolve against %s, so prefer absolute paths.", cwd)
+		}
+	}
+	return fmt.Errorf("%w: %s %s is outside the allowed roots. Only these directories can be accessed: %s. Use paths under them, or run glob_files with a pattern such as %s to discover files; do not retry paths outside them.%s",
+		fs.ErrPermission, kind, path, strings.Join(h.roots, ", "), example, hint)
+}
+
+// resolvePattern converts file:// URIs, expands ~ and checks the static prefix of a glob pattern is within the allowed roots
+func (h *Handler) resolvePattern(pattern string) (string, error) {
+	pattern, err := localPath(pattern)
+	if err != nil {
+		return "", err
+	}
+	base, _ := doublestar.SplitPattern(filepath.ToSlash(pattern))
+	if !h.withinRoots(filepath.FromSlash(base)) {
+		return "", h.outsideRootsError("pattern", pattern)
+	}
+	return pattern, nil
+}
+
 // ReadFile reads a file and returns its contents
 func (h *Handler) ReadFile(ctx context.Context, path string) (string, error) {
 	// Check context before starting
@@ -29,16 +318,15 @@ func (h *Handler) ReadFile(ctx context.Context, path string) (string, error) {
 		return "", err
 	}
 
-	// Expand ~ to home directory (only ~/path, not ~user/path)
-	if strings.HasPrefix(path, "~") {
-		if len(path) > 1 && path[1] != '/' && path[1] != filepath.Separator {
-			return "", fmt.Errorf("unsupported path format: only ~/ is supported, not ~username")
-		}
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
-		}
-		path = filepath.Join(home, path[1:])
+	// Expand ~ to home directory and enforce allowed roots
+	path, err := h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Enforce extension allow/deny lists before opening
+	if err := h.checkExtension(path); err != nil {
+		return "", err
 	}
 
 	// Check file size before reading
@@ -47,8 +335,16 @@ func (h *Handler) ReadFile(ctx context.Context, path string) (string, error) {
 		return "", fmt.Errorf("failed to stat file: %w", err)
 	}
 
+	// Refuse directories and special files, which would error, block or never end
+	if err := h.checkFileMode(path, info); err != nil {
+		return "", err
+	}
+	if info.Mode()&fs.ModeNamedPipe != 0 {
+		return h.readFIFO(ctx, path)
+	}
+
 	if info.Size() > maxFileSize {
-		return "", fmt.Errorf("file too large (%d bytes, max %d bytes): consider using grep_files instead", info.Size(), maxFileSize)
+		return "", fmt.Errorf("file too large (%d bytes, max %d bytes): read a line range with start_line and end_line, or use grep_in_file instead", info.Size(), maxFileSize)
 	}
 
 	// Check context again before reading
@@ -65,12 +361,134 @@ func (h *Handler) ReadFile(ctx context.Context, path string) (string, error) {
 	return string(content), nil
 }
 
-// GrepFiles searches for a pattern in files
-func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ignoreCase bool) (string, error) {
+// ReadFileRange returns lines startLine through endLine of a file, streaming
+// it so only the requested window is held in memory. A zero startLine or
+// endLine leaves that end of the range open. The size limit applies to the
+// returned lines rather than the whole file, so large files can be paged
+// through, and a range past the end of the file is reported rather than
+// treated as an error.
+func (h *Handler) ReadFileRange(ctx context.Context, path string, startLine, endLine int) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	startLine = max(startLine, 1)
+	if endLine > 0 && startLine > endLine {
+		return "", fmt.Errorf("start_line (%d) is after end_line (%d)", startLine, endLine)
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	path, err := h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Enforce extension allow/deny lists before opening
+	if err := h.checkExtension(path); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+	if err := h.checkFileMode(path, info); err != nil {
+		return "", err
+	}
+	if info.Mode()&fs.ModeNamedPipe != 0 {
+		return "", fmt.Errorf("%s is a named pipe: read it without a line range", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Allow lines up to the size limit; the buffer only grows as needed
+	scanner.Buffer(make([]byte, 0, 64*1024), maxFileSize)
+
+	var (
+		b         strings.Builder
+		lineNum   int
+		lastLine  int  // last line written to b
+		more      bool // lines follow the returned range
+		truncated bool
+	)
+	for scanner.Scan() {
+		lineNum++
+
+		// Check context periodically
+		if lineNum%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+
+		if lineNum < startLine {
+			continue
+		}
+		if endLine > 0 && lineNum > endLine {
+			more = true
+			break
+		}
+		line := scanner.Text()
+		if b.Len()+len(line)+1 > maxFileSize {
+			truncated = true
+			break
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+		lastLine = lineNum
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error scanning %s: %w", path, err)
+	}
+
+	if lastLine == 0 && !truncated {
+		if lineNum == 0 {
+			return fmt.Sprintf("%s is empty", path), nil
+		}
+		return fmt.Sprintf("%s has %d lines: start_line %d is past the end of the file", path, lineNum, startLine), nil
+	}
+	if truncated && lastLine == 0 {
+		return "", fmt.Errorf("line %d of %s is longer than %d bytes: use grep_in_file instead", startLine, path, maxFileSize)
+	}
+
+	var output strings.Builder
+	fmt.Fprintf(&output, "%s: lines %d-%d", path, startLine, lastLine)
+	if !more && !truncated {
+		fmt.Fprintf(&output, " of %d (end of file)", lineNum)
+	}
+	output.WriteString("\n")
+	output.WriteString(b.String())
+	switch {
+	case more:
+		output.WriteString(truncate.Marker(fmt.Sprintf("end_line %d reached", endLine), fmt.Sprintf("lines from %d on", lastLine+1), fmt.Sprintf("Continue with start_line %d.", lastLine+1)))
+	case truncated:
+		output.WriteString(truncate.Marker(fmt.Sprintf("limit of %d bytes", maxFileSize), fmt.Sprintf("lines from %d on", lastLine+1), fmt.Sprintf("Continue with start_line %d.", lastLine+1)))
+	}
+	return output.String(), nil
+}
+
+// GrepFiles searches for a pattern in files, showing beforeContext and
+// afterContext lines around each match like grep -B and -A. With withBlame,
+// matches in git-tracked files are annotated with the commit that last
+// changed them. With recursive, directories matched by pathPattern are
+// searched like grep -r; otherwise they are skipped.
+func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ignoreCase, withBlame, recursive bool, beforeContext, afterContext int) (string, error) {
 	// Check context before starting
 	if err := ctx.Err(); err != nil {
 		return "", err
 	}
+	if withBlame && !h.allowGit {
+		return "", fmt.Errorf("with_blame requires the server to be started with -allow-git")
+	}
+	if err := h.checkGrepPattern(pattern); err != nil {
+		return "", err
+	}
 
 	// Compile regex
 	flags := ""
@@ -81,30 +499,33 @@ func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ig
 	if err != nil {
 		return "", fmt.Errorf("invalid regex pattern: %w", err)
 	}
+	beforeContext = min(max(beforeContext, 0), maxContextLines)
+	afterContext = min(max(afterContext, 0), maxContextLines)
 
-	// Expand ~ to home directory (only ~/path, not ~user/path)
-	if strings.HasPrefix(pathPattern, "~") {
-		if len(pathPattern) > 1 && pathPattern[1] != '/' && pathPattern[1] != filepath.Separator {
-			return "", fmt.Errorf("unsupported path format: only ~/ is supported, not ~username")
-		}
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
-		}
-		pathPattern = filepath.Join(home, pathPattern[1:])
+	// Expand ~ to home directory and enforce allowed roots
+	pathPattern, err = h.resolvePattern(pathPattern)
+	if err != nil {
+		return "", err
 	}
 
 	// Find matching files
-	matches, err := filepath.Glob(pathPattern)
+	matches, note, err := h.globPaths(pathPattern)
 	if err != nil {
 		return "", fmt.Errorf("invalid path pattern: %w", err)
 	}
 
 	if len(matches) == 0 {
-		return "No files matched the pattern", nil
+		return h.noMatch(ctx, pathPattern) + globNote(note), nil
+	}
+	if recursive {
+		if matches, err = h.expandDirs(ctx, matches); err != nil {
+			return "", err
+		}
 	}
 
 	var results []string
+	var skipped []skippedFile
+	blamedFiles := 0
 
 	// Search each file
 	for _, path := range matches {
@@ -115,13 +536,28 @@ func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ig
 		default:
 		}
 
+		// Skip matches that escape the allowed roots via symlinks
+		if !h.withinRoots(path) {
+			skipped = append(skipped, skippedFile{path, "outside allowed roots"})
+			continue
+		}
+
 		info, err := os.Stat(path)
-		if err != nil || info.IsDir() {
+		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		if err := h.checkExtension(path); err != nil {
+			skipped = append(skipped, skippedFile{path, "forbidden by server policy"})
 			continue
 		}
 
 		file, err := os.Open(path)
 		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
 			continue
 		}
 
@@ -130,7 +566,8 @@ func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ig
 		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 
 		lineNum := 0
-		var fileResults []string
+		hunks := &contextWriter{before: beforeContext, after: afterContext}
+		var matchedLines, matchIndexes []int
 
 		for scanner.Scan() {
 			// Check context periodically
@@ -144,7 +581,10 @@ func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ig
 			lineNum++
 			line := scanner.Text()
 			if re.MatchString(line) {
-				fileResults = append(fileResults, fmt.Sprintf("%d:%s", lineNum, line))
+				matchIndexes = append(matchIndexes, hunks.match(lineNum, line))
+				matchedLines = append(matchedLines, lineNum)
+			} else {
+				hunks.line(lineNum, line)
 			}
 		}
 
@@ -156,49 +596,347 @@ func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ig
 
 		_ = file.Close()
 
-		if len(fileResults) > 0 {
+		if len(matchedLines) > 0 {
+			matches := make([]string, len(matchIndexes))
+			for i, at := range matchIndexes {
+				matches[i] = hunks.lines[at]
+			}
+			if withBlame {
+				blamedFiles++
+				if blamedFiles <= maxBlameFiles {
+					annotateBlame(ctx, path, matchedLines, matches)
+					for i, at := range matchIndexes {
+						hunks.lines[at] = matches[i]
+					}
+				}
+			}
 			results = append(results, fmt.Sprintf("\n%s:", path))
-			results = append(results, fileResults...)
+			results = append(results, hunks.lines...)
+			reportMatches(ctx, path, matches)
 		}
 	}
 
 	if len(results) == 0 {
+		return "No matches found" + skippedNote(skipped) + globNote(note), nil
+	}
+
+	if blamedFiles > maxBlameFiles {
+		results = append(results, "\n"+truncate.Marker(fmt.Sprintf("blame limit of %d files", maxBlameFiles), fmt.Sprintf("blame for %d files", blamedFiles-maxBlameFiles), "Narrow the pattern for more."))
+	}
+
+	return strings.Join(results, "\n") + skippedNote(skipped) + globNote(note), nil
+}
+
+// expandDirs replaces directories in paths with the files below them, skipping
+// ignored and hidden directories and files read_file may not open
+func (h *Handler) expandDirs(ctx context.Context, paths []string) ([]string, error) {
+	seen := make(map[string]bool, len(paths))
+	var files []string
+	add := func(path string) error {
+		if seen[path] {
+			return nil
+		}
+		if len(files) >= maxRecursiveGrepFiles {
+			return fmt.Errorf("more than %d files to search: narrow the path", maxRecursiveGrepFiles)
+		}
+		seen[path] = true
+		files = append(files, path)
+		return nil
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			if err := add(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			name := d.Name()
+			if d.IsDir() {
+				if p != path && (ignoredGrepDirs[name] || strings.HasPrefix(name, ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || h.checkExtension(p) != nil {
+				return nil
+			}
+			return add(p)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// GrepInFile streams a single file, of any size, and returns lines matching pattern
+// within [startLine, endLine] with contextLines of surrounding context. A zero
+// startLine or endLine leaves that end of the range open.
+func (h *Handler) GrepInFile(ctx context.Context, path, pattern string, ignoreCase bool, startLine, endLine, contextLines int) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := h.checkGrepPattern(pattern); err != nil {
+		return "", err
+	}
+
+	// Compile regex
+	flags := ""
+	if ignoreCase {
+		flags = "(?i)"
+	}
+	re, err := regexp.Compile(flags + pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex pattern: %w", err)
+	}
+
+	if endLine > 0 && startLine > endLine {
+		return "", fmt.Errorf("start_line (%d) is after end_line (%d)", startLine, endLine)
+	}
+	contextLines = min(max(contextLines, 0), maxContextLines)
+
+	// Expand ~ to home directory and enforce allowed roots
+	path, err = h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Enforce extension allow/deny lists before opening
+	if err := h.checkExtension(path); err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Increase buffer size to handle long lines (1MB max token)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		hunks      = &contextWriter{before: contextLines, after: contextLines}
+		matchCount int
+		truncated  bool
+		lineNum    int
+	)
+
+	for scanner.Scan() {
+		lineNum++
+
+		// Check context periodically
+		if lineNum%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+		}
+
+		if lineNum < startLine {
+			continue
+		}
+		if endLine > 0 && lineNum > endLine {
+			break
+		}
+
+		line := scanner.Text()
+		switch {
+		case !re.MatchString(line):
+			hunks.line(lineNum, line)
+		case matchCount >= maxFileMatches:
+			truncated = true
+		default:
+			hunks.match(lineNum, line)
+			matchCount++
+		}
+
+		if truncated {
+			break
+		}
+	}
+
+	// Check for scanner errors
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error scanning %s: %w", path, err)
+	}
+
+	if matchCount == 0 {
 		return "No matches found", nil
 	}
 
-	return strings.Join(results, "\n"), nil
+	output := fmt.Sprintf("%s: %d matches\n%s", path, matchCount, strings.Join(hunks.lines, "\n"))
+	if truncated {
+		output += "\n" + truncate.Marker(fmt.Sprintf("stopped after %d matches", maxFileMatches), fmt.Sprintf("matches from line %d on", lineNum), "Narrow the pattern or line range.")
+	}
+	return output, nil
 }
 
-// GlobFiles returns a list of files matching the glob pattern
-func (h *Handler) GlobFiles(ctx context.Context, pattern string) (string, error) {
+// numberedLine is a line of a file with its line number
+type numberedLine struct {
+	num  int
+	text string
+}
+
+// contextWriter formats grep output with context like grep -B and -A: matches
+// as "N:text", context lines as "N-text", and "--" between non-contiguous
+// hunks. Overlapping context of nearby matches is merged, so no line is
+// written twice.
+type contextWriter struct {
+	before, after int // context lines to show before and after each match
+
+	lines     []string
+	pending   []numberedLine // recent unwritten lines for leading context
+	lastWrite int            // last line number written
+	afterLeft int            // trailing context lines still to write
+}
+
+// match writes a matching line with its leading context, returning the
+// index of the match in lines
+func (w *contextWriter) match(num int, text string) int {
+	// Separate non-contiguous hunks like grep does when showing context
+	first := num
+	if len(w.pending) > 0 {
+		first = w.pending[0].num
+	}
+	if (w.before > 0 || w.after > 0) && w.lastWrite > 0 && first > w.lastWrite+1 {
+		w.lines = append(w.lines, "--")
+	}
+	for _, p := range w.pending {
+		w.lines = append(w.lines, fmt.Sprintf("%d-%s", p.num, p.text))
+	}
+	w.pending = w.pending[:0]
+	w.lines = append(w.lines, fmt.Sprintf("%d:%s", num, text))
+	w.lastWrite = num
+	w.afterLeft = w.after
+	return len(w.lines) - 1
+}
+
+// line handles a non-matching line, writing it as trailing context or
+// keeping it as possible leading context for the next match
+func (w *contextWriter) line(num int, text string) {
+	switch {
+	case w.afterLeft > 0:
+		w.lines = append(w.lines, fmt.Sprintf("%d-%s", num, text))
+		w.lastWrite = num
+		w.afterLeft--
+	case w.before > 0:
+		w.pending = append(w.pending, numberedLine{num, text})
+		if len(w.pending) > w.before {
+			w.pending = w.pending[1:]
+		}
+	}
+}
+
+// MatchFiles returns the regular files matching a glob pattern within the allowed roots
+func (h *Handler) MatchFiles(ctx context.Context, pattern string) ([]string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	pattern, err := h.resolvePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, _, err := h.globPaths(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern: %w", err)
+	}
+
+	var files []string
+	for _, path := range matches {
+		if !h.withinRoots(path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// Fingerprint summarizes the paths, sizes and modification times of everything
+// matching a path or glob pattern, so callers can tell when cached results
+// derived from those files are stale. With recursive, matched directories
+// are replaced by the files a recursive grep_files would search below them.
+func (h *Handler) Fingerprint(ctx context.Context, pattern string, recursive bool) (string, error) {
 	// Check context before starting
 	if err := ctx.Err(); err != nil {
 		return "", err
 	}
 
-	// Expand ~ to home directory (only ~/path, not ~user/path)
-	if strings.HasPrefix(pattern, "~") {
-		if len(pattern) > 1 && pattern[1] != '/' && pattern[1] != filepath.Separator {
-			return "", fmt.Errorf("unsupported path format: only ~/ is supported, not ~username")
+	// Expand ~ to home directory and enforce allowed roots
+	pattern, err := h.resolvePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	matches, _, err := h.globPaths(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid glob pattern: %w", err)
+	}
+	// A literal path containing glob metacharacters (e.g. [id].tsx) matches nothing as a pattern
+	if len(matches) == 0 {
+		matches = []string{pattern}
+	}
+	if recursive {
+		if matches, err = h.expandDirs(ctx, matches); err != nil {
+			return "", err
 		}
-		home, err := os.UserHomeDir()
+	}
+
+	hash := fnv.New64a()
+	for _, path := range matches {
+		info, err := os.Stat(path)
 		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
+			fmt.Fprintf(hash, "%s:missing\n", path)
+			continue
 		}
-		pattern = filepath.Join(home, pattern[1:])
+		fmt.Fprintf(hash, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%d:%x", len(matches), hash.Sum64()), nil
+}
+
+// GlobFiles returns a list of files matching the glob pattern
+func (h *Handler) GlobFiles(ctx context.Context, pattern string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	pattern, err := h.resolvePattern(pattern)
+	if err != nil {
+		return "", err
 	}
 
 	// Find matching files
-	matches, err := filepath.Glob(pattern)
+	matches, note, err := h.globPaths(pattern)
 	if err != nil {
 		return "", fmt.Errorf("invalid glob pattern: %w", err)
 	}
 
 	if len(matches) == 0 {
-		return "No files matched the pattern", nil
+		return h.noMatch(ctx, pattern) + globNote(note), nil
 	}
 
 	var results []string
+	var skipped []skippedFile
 	for _, path := range matches {
 		// Check context periodically
 		select {
@@ -207,18 +945,59 @@ func (h *Handler) GlobFiles(ctx context.Context, pattern string) (string, error)
 		default:
 		}
 
+		// Skip matches that escape the allowed roots via symlinks
+		if !h.withinRoots(path) {
+			skipped = append(skipped, skippedFile{path, "outside allowed roots"})
+			continue
+		}
+
 		info, err := os.Stat(path)
 		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
 			continue
 		}
 
 		// Mark directories with trailing /
-		if info.IsDir() {
+		switch {
+		case info.IsDir():
 			results = append(results, path+"/")
-		} else {
+		case h.checkExtension(path) != nil:
+			skipped = append(skipped, skippedFile{path, "forbidden by server policy"})
+		default:
 			results = append(results, path)
 		}
 	}
 
-	return strings.Join(results, "\n"), nil
+	return strings.Join(results, "\n") + skippedNote(skipped) + globNote(note), nil
+}
+
+// skippedFile records a path that couldn't be processed and why
+type skippedFile struct {
+	path   string
+	reason string
+}
+
+// skipReason summarizes why a file couldn't be accessed
+func skipReason(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied"
+	case errors.Is(err, fs.ErrNotExist):
+		return "no longer exists"
+	default:
+		return "unreadable: " + err.Error()
+	}
+}
+
+// skippedNote formats a consolidated report of skipped files, or "" if none were skipped
+func skippedNote(skipped []skippedFile) string {
+	if len(skipped) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(skipped)+1)
+	lines = append(lines, fmt.Sprintf("\n\nSkipped %d files (permission denied / unreadable):", len(skipped)))
+	for _, s := range skipped {
+		lines = append(lines, fmt.Sprintf("- %s: %s", s.path, s.reason))
+	}
+	return strings.Join(lines, "\n")
 }
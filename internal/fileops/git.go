@@ -0,0 +1,206 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	gitTimeout    = 10 * time.Second
+	maxGitOutput  = 1024 * 1024 // 1MB
+	defaultGitRev = "HEAD"
+
+	maxBlameFiles  = 20  // Limit files blamed by a single grep
+	maxBlameRanges = 100 // Above this many matches, blame the whole file instead of each line
+)
+
+// WithGitAccess permits git history lookups, such as blame annotations on grep matches
+func WithGitAccess(enabled bool) Option {
+	return func(h *Handler) {
+		h.allowGit = enabled
+	}
+}
+
+// GitFileDiff returns the unified diff of a single file against a git revision (HEAD by default).
+// Any other revision requires git access.
+func (h *Handler) GitFileDiff(ctx context.Context, path, rev string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	path, err := h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	if rev == "" {
+		rev = defaultGitRev
+	} else if !h.allowGit {
+		return "", fmt.Errorf("diffing against a revision requires the server to be started with -allow-git")
+	}
+	// Reject anything git would parse as an option
+	if strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("invalid revision: %s", rev)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	// Locate the repository root containing the file
+	root, _, err := runGit(ctx, filepath.Dir(absPath), "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not inside a git repository: %w", err)
+	}
+	root = strings.TrimSpace(root)
+
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the repository root %s", path, root)
+	}
+
+	diff, truncated, err := runGit(ctx, root, "diff", "--no-color", "--no-ext-diff", rev, "--", relPath)
+	if err != nil {
+		return "", fmt.Errorf("git diff failed: %w", err)
+	}
+
+	if diff == "" {
+		return fmt.Sprintf("No differences between working tree and %s for %s", rev, relPath), nil
+	}
+
+	if truncated {
+		diff += "\n" + truncate.Marker(fmt.Sprintf("git output limit of %d bytes", maxGitOutput), "the rest of the diff", "")
+	}
+
+	return diff, nil
+}
+
+// blameLine is the last commit to change a line
+type blameLine struct {
+	commit string
+	author string
+	date   string
+}
+
+// annotateBlame prefixes grep results for lines in path with their blame, using
+// one git blame call per file. Files that aren't tracked are left unannotated.
+func annotateBlame(ctx context.Context, path string, lines []int, results []string) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	args := []string{"blame", "--line-porcelain"}
+	if len(lines) <= maxBlameRanges {
+		for _, line := range lines {
+			args = append(args, "-L", fmt.Sprintf("%d,%d", line, line))
+		}
+	}
+	args = append(args, "--", filepath.Base(absPath))
+
+	out, _, err := runGit(ctx, filepath.Dir(absPath), args...)
+	if err != nil {
+		return
+	}
+	blame := parseBlame(out)
+
+	for i, line := range lines {
+		b, ok := blame[line]
+		switch {
+		case !ok:
+		case strings.Trim(b.commit, "0") == "":
+			results[i] = strings.Replace(results[i], ":", ":[not committed] ", 1)
+		default:
+			results[i] = strings.Replace(results[i], ":", fmt.Sprintf(":[%s %s %s] ", b.commit[:min(len(b.commit), 8)], b.author, b.date), 1)
+		}
+	}
+}
+
+// parseBlame parses git blame --line-porcelain output into final line number -> blame
+func parseBlame(out string) map[int]blameLine {
+	blame := make(map[int]blameLine)
+	var current blameLine
+	lineNum := 0
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			// The line's content ends each entry
+			if lineNum > 0 {
+				blame[lineNum] = current
+			}
+			lineNum = 0
+		case strings.HasPrefix(line, "author "):
+			current.author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			if secs, err := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64); err == nil {
+				current.date = time.Unix(secs, 0).UTC().Format("2006-01-02")
+			}
+		case lineNum == 0:
+			// Header: <commit> <original line> <final line> [<group size>]
+			fields := strings.Fields(line)
+			if len(fields) >= 3 && len(fields[0]) == 40 {
+				current = blameLine{commit: fields[0]}
+				lineNum, _ = strconv.Atoi(fields[2])
+			}
+		}
+	}
+	return blame
+}
+
+// runGit runs a git command in dir, capping captured stdout at maxGitOutput
+func runGit(ctx context.Context, dir string, args ...string) (string, bool, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	stdout := &cappedBuffer{limit: maxGitOutput}
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", false, fmt.Errorf("timed out after %s", gitTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", false, fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", false, err
+	}
+
+	return stdout.buf.String(), stdout.truncated, nil
+}
+
+// cappedBuffer collects writes up to limit bytes and silently discards the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+	dropped   int // bytes written past the limit
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining < len(p) {
+		b.buf.Write(p[:max(remaining, 0)])
+		b.truncated = true
+		b.dropped += len(p) - max(remaining, 0)
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,143 @@
+package fileops
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	defaultMaxGlobDirs = 10000 // directories a ** pattern may read before the walk stops
+	maxReportedCycles  = 5     // symlink cycles named in the glob note
+)
+
+// WithMaxGlobDirs limits the directories a ** glob reads before it stops and
+// returns what it has matched so far. Zero or less keeps the default.
+func WithMaxGlobDirs(n int) Option {
+	return func(h *Handler) {
+		if n > 0 {
+			h.maxGlobDirs = n
+		}
+	}
+}
+
+// globPaths expands a glob pattern supporting ** for recursive matching and
+// {a,b} brace sets. Recursive patterns are walked with symlink cycles cut
+// and a limit on the directories read, so a looped or huge tree returns
+// partial matches with a note saying so instead of hanging.
+func (h *Handler) globPaths(pattern string) ([]string, string, error) {
+	if !strings.Contains(pattern, "**") {
+		matches, err := doublestar.FilepathGlob(pattern)
+		return matches, "", err
+	}
+
+	base, rest := doublestar.SplitPattern(filepath.ToSlash(filepath.Clean(pattern)))
+	if !doublestar.ValidatePattern(rest) {
+		return nil, "", doublestar.ErrBadPattern
+	}
+	limit := h.maxGlobDirs
+	if limit <= 0 {
+		limit = defaultMaxGlobDirs
+	}
+	fsys := &guardedFS{FS: os.DirFS(filepath.FromSlash(base)), base: filepath.FromSlash(base), limit: limit, listed: make(map[string]bool), real: make(map[string]string)}
+
+	var matches []string
+	err := doublestar.GlobWalk(fsys, rest, func(p string, _ fs.DirEntry) error {
+		matches = append(matches, filepath.Join(fsys.base, filepath.FromSlash(p)))
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return matches, fsys.note(), nil
+}
+
+// guardedFS is the filesystem a recursive glob walks. It refuses to list a
+// directory that resolves to one of its own ancestors, which would loop
+// forever through a symlink, and stops listing directories once limit have
+// been read.
+type guardedFS struct {
+	fs.FS
+	base    string
+	limit   int
+	listed  map[string]bool // directories read so far
+	stopped bool
+	real    map[string]string // resolved path of each directory seen, by slash path
+	cycles  []string
+}
+
+// ReadDir implements fs.ReadDirFS
+func (g *guardedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	// The walk may list a directory more than once; only the first counts
+	if !g.listed[name] {
+		if len(g.listed) >= g.limit {
+			g.stopped = true
+			return nil, nil
+		}
+		g.listed[name] = true
+	}
+
+	real, err := g.realPath(name)
+	if err != nil {
+		return nil, err
+	}
+	for dir := name; dir != "."; {
+		dir = path.Dir(dir)
+		if ancestor, err := g.realPath(dir); err == nil && ancestor == real {
+			cycle := fmt.Sprintf("%s -> %s", filepath.Join(g.base, filepath.FromSlash(name)), real)
+			if !slices.Contains(g.cycles, cycle) {
+				g.cycles = append(g.cycles, cycle)
+			}
+			return nil, nil
+		}
+	}
+	return fs.ReadDir(g.FS, name)
+}
+
+// realPath resolves the symlinks of a directory, caching the result
+func (g *guardedFS) realPath(name string) (string, error) {
+	if real, ok := g.real[name]; ok {
+		return real, nil
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(g.base, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	g.real[name] = real
+	return real, nil
+}
+
+// note describes the symlink cycles cut and whether the walk was stopped, or
+// is empty when the walk was complete
+func (g *guardedFS) note() string {
+	var lines []string
+	if len(g.cycles) > 0 {
+		lines = append(lines, fmt.Sprintf("Skipped %d symlinked directories that loop back to their own ancestors:", len(g.cycles)))
+		for i, cycle := range g.cycles {
+			if i == maxReportedCycles {
+				lines = append(lines, "- "+truncate.Marker(fmt.Sprintf("limit of %d cycles", maxReportedCycles), fmt.Sprintf("%d more cycles", len(g.cycles)-maxReportedCycles), ""))
+				break
+			}
+			lines = append(lines, "- "+cycle)
+		}
+	}
+	if g.stopped {
+		lines = append(lines, truncate.Marker(fmt.Sprintf("traversal limit reached after reading %d directories", g.limit), "matches in the directories not read", "Use a narrower pattern, such as a subdirectory before the **."))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// globNote formats a glob's note for the end of a tool result, or "" if there is none
+func globNote(note string) string {
+	if note == "" {
+		return ""
+	}
+	return "\n\n" + note
+}
@@ -0,0 +1,85 @@
+package fileops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+func TestGlobPathsBraces(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "go.mod", "go.sum", "README.md", "cmd/tool/main.go", "cmd/tool/go.mod"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "brace set",
+			pattern: "*.{go,mod}",
+			want:    []string{"go.mod", "main.go"},
+		},
+		{
+			name:    "nested braces",
+			pattern: "{*.go,go.{mod,sum}}",
+			want:    []string{"go.mod", "go.sum", "main.go"},
+		},
+		{
+			name:    "brace set under **",
+			pattern: "**/*.{go,mod}",
+			want:    []string{"cmd/tool/go.mod", "cmd/tool/main.go", "go.mod", "main.go"},
+		},
+		{
+			name:    "unmatched open brace",
+			pattern: "*.{go,mod",
+			wantErr: doublestar.ErrBadPattern,
+		},
+		{
+			name:    "unmatched open brace under **",
+			pattern: "**/*.{go",
+			wantErr: doublestar.ErrBadPattern,
+		},
+		{
+			name:    "unmatched close brace",
+			pattern: "*.go}",
+			wantErr: doublestar.ErrBadPattern,
+		},
+	}
+
+	h := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, _, err := h.globPaths(filepath.Join(dir, tt.pattern))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, match := range matches {
+				rel, err := filepath.Rel(dir, match)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matches = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
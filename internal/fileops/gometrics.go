@@ -0,0 +1,125 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultMetricsTopN = 20
+	maxMetricsTopN     = 100
+	highComplexity     = 10 // Complexity at which functions are flagged
+)
+
+// funcMetrics holds the metrics of a single function
+type funcMetrics struct {
+	name       string
+	pos        token.Position
+	lines      int
+	complexity int
+}
+
+// GoMetrics reports per-function line counts and cyclomatic complexity for a
+// Go file or package directory, listing the topN most complex functions
+func (h *Handler) GoMetrics(ctx context.Context, path string, topN int) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if topN <= 0 {
+		topN = defaultMetricsTopN
+	}
+	topN = min(topN, maxMetricsTopN)
+
+	fset, files, err := h.parseGoPath(ctx, path, true, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var metrics []funcMetrics
+	totalLines := 0
+	for _, f := range files {
+		for _, decl := range f.ast.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			start := fset.Position(fn.Pos())
+			end := fset.Position(fn.End())
+			m := funcMetrics{
+				name:       funcName(fn),
+				pos:        start,
+				lines:      end.Line - start.Line + 1,
+				complexity: cyclomaticComplexity(fn.Body),
+			}
+			totalLines += m.lines
+			metrics = append(metrics, m)
+		}
+	}
+
+	if len(metrics) == 0 {
+		return "No functions found", nil
+	}
+
+	sort.SliceStable(metrics, func(i, j int) bool {
+		if metrics[i].complexity != metrics[j].complexity {
+			return metrics[i].complexity > metrics[j].complexity
+		}
+		return metrics[i].lines > metrics[j].lines
+	})
+
+	flagged := 0
+	totalComplexity := 0
+	for _, m := range metrics {
+		totalComplexity += m.complexity
+		if m.complexity >= highComplexity {
+			flagged++
+		}
+	}
+
+	var results []string
+	results = append(results, fmt.Sprintf("%d functions in %d files: avg complexity %.1f, avg %d lines, %d with complexity >= %d",
+		len(metrics), len(files), float64(totalComplexity)/float64(len(metrics)), totalLines/len(metrics), flagged, highComplexity))
+	results = append(results, fmt.Sprintf("\nTop %d by cyclomatic complexity:", min(topN, len(metrics))))
+	results = append(results, "complexity  lines  function  location")
+	for _, m := range metrics[:min(topN, len(metrics))] {
+		marker := ""
+		if m.complexity >= highComplexity {
+			marker = "  [HIGH]"
+		}
+		results = append(results, fmt.Sprintf("%10d  %5d  %s  %s:%d%s", m.complexity, m.lines, m.name, m.pos.Filename, m.pos.Line, marker))
+	}
+
+	return strings.Join(results, "\n"), nil
+}
+
+// cyclomaticComplexity estimates complexity as 1 plus the number of branch points.
+// Branches inside closures count towards the enclosing function.
+func cyclomaticComplexity(body *ast.BlockStmt) int {
+	complexity := 1
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if n.List != nil { // default clauses don't add a branch
+				complexity++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
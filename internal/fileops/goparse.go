@@ -0,0 +1,166 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const maxGoFiles = 500 // Limit Go files parsed by a single tool call
+
+// goFile is a parsed Go source file
+type goFile struct {
+	path string
+	ast  *ast.File
+}
+
+// parseGoPath parses a single .go file, or every .go file directly inside a
+// directory, within the allowed roots. Test files are skipped unless includeTests is set.
+func (h *Handler) parseGoPath(ctx context.Context, path string, includeTests bool, mode parser.Mode) (*token.FileSet, []goFile, error) {
+	// Expand ~ to home directory and enforce allowed roots
+	path, err := h.resolvePath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat path: %w", err)
+	}
+
+	var paths []string
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read directory: %w", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			if !includeTests && strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			paths = append(paths, filepath.Join(path, name))
+		}
+		if len(paths) == 0 {
+			return nil, nil, fmt.Errorf("no Go files in %s", path)
+		}
+	} else {
+		if !strings.HasSuffix(path, ".go") {
+			return nil, nil, fmt.Errorf("not a Go file: %s", path)
+		}
+		paths = []string{path}
+	}
+
+	return h.parseGoFiles(ctx, paths, mode)
+}
+
+// parseGoTree parses every .go file below root, skipping vendor, testdata and hidden directories
+func (h *Handler) parseGoTree(ctx context.Context, root string, includeTests bool, mode parser.Mode) (*token.FileSet, []goFile, error) {
+	// Expand ~ to home directory and enforce allowed roots
+	root, err := h.resolvePath(h.defaultDir(root))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var paths []string
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || (!includeTests && strings.HasSuffix(name, "_test.go")) {
+			return nil
+		}
+		if len(paths) >= maxGoFiles {
+			return fmt.Errorf("more than %d Go files under %s: narrow the path", maxGoFiles, root)
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil, fmt.Errorf("no Go files under %s", root)
+	}
+
+	return h.parseGoFiles(ctx, paths, mode)
+}
+
+// defaultDir returns dir, or the first allowed root (or ".") when dir is empty
+func (h *Handler) defaultDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if len(h.roots) > 0 {
+		return h.roots[0]
+	}
+	return "."
+}
+
+// parseGoFiles parses the given files, skipping any outside the allowed roots
+func (h *Handler) parseGoFiles(ctx context.Context, paths []string, mode parser.Mode) (*token.FileSet, []goFile, error) {
+	if len(paths) > maxGoFiles {
+		return nil, nil, fmt.Errorf("too many Go files (%d, max %d): narrow the path", len(paths), maxGoFiles)
+	}
+	sort.Strings(paths)
+
+	fset := token.NewFileSet()
+	files := make([]goFile, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if !h.withinRoots(path) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, mode)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		files = append(files, goFile{path: path, ast: f})
+	}
+	return fset, files, nil
+}
+
+// funcName returns a function's name, qualified with its receiver type for methods
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	return receiverType(fn.Recv.List[0].Type) + "." + fn.Name.Name
+}
+
+// receiverType returns the base type name of a method receiver
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(t.X)
+	case *ast.IndexExpr:
+		return receiverType(t.X)
+	case *ast.IndexListExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	default:
+		return "?"
+	}
+}
@@ -0,0 +1,159 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	defaultHistoryCommits = 20
+	maxHistoryCommits     = 100
+	maxCommitDiffBytes    = 8 * 1024  // Limit each commit's diff shown by FileHistory
+	maxHistoryDiffBytes   = 64 * 1024 // Limit all diffs shown by FileHistory
+)
+
+// historyCommit is one commit in a file's history
+type historyCommit struct {
+	hash, date, author, subject string
+	renamedFrom                 string // previous path when the commit renamed the file
+	diff                        string
+}
+
+// FileHistory returns the commits that changed a file, newest first and
+// following renames, optionally with each commit's capped diff of the file
+func (h *Handler) FileHistory(ctx context.Context, path string, maxCommits int, includeDiffs bool) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if !h.allowGit {
+		return "", fmt.Errorf("file_history requires the server to be started with -allow-git")
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	path, err := h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	if maxCommits <= 0 {
+		maxCommits = defaultHistoryCommits
+	}
+	maxCommits = min(maxCommits, maxHistoryCommits)
+
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	// Locate the repository root containing the file
+	root, _, err := runGit(ctx, filepath.Dir(absPath), "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not inside a git repository: %w", err)
+	}
+	root = strings.TrimSpace(root)
+
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the repository root %s", path, root)
+	}
+
+	// Each commit starts with a record separator and a header of fields split
+	// by unit separators; its patch or name-status lines follow
+	args := []string{"log", "--follow", "--no-color", "--date=short", "-n", fmt.Sprint(maxCommits),
+		"--format=%x1e%H%x1f%ad%x1f%an%x1f%s"}
+	if includeDiffs {
+		args = append(args, "-p", "--no-ext-diff")
+	} else {
+		args = append(args, "--name-status")
+	}
+	args = append(args, "--", relPath)
+
+	out, truncated, err := runGit(ctx, root, args...)
+	if err != nil {
+		return "", fmt.Errorf("git log failed: %w", err)
+	}
+
+	commits := parseHistory(out, includeDiffs)
+	if len(commits) == 0 {
+		return fmt.Sprintf("No commits found for %s: the file isn't tracked by git, or hasn't been committed yet", relPath), nil
+	}
+
+	return formatHistory(relPath, commits, maxCommits, includeDiffs, truncated), nil
+}
+
+// parseHistory splits git log output into commits
+func parseHistory(out string, includeDiffs bool) []historyCommit {
+	var commits []historyCommit
+	for _, record := range strings.Split(out, "\x1e") {
+		header, body, _ := strings.Cut(record, "\n")
+		fields := strings.Split(header, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		c := historyCommit{hash: fields[0], date: fields[1], author: fields[2], subject: fields[3]}
+		body = strings.Trim(body, "\n")
+		if includeDiffs {
+			c.diff = body
+			for _, line := range strings.Split(body, "\n") {
+				if from, ok := strings.CutPrefix(line, "rename from "); ok {
+					c.renamedFrom = from
+					break
+				}
+			}
+		} else {
+			// Renames are listed as R<score>\t<old>\t<new>
+			for _, line := range strings.Split(body, "\n") {
+				parts := strings.Split(line, "\t")
+				if len(parts) == 3 && strings.HasPrefix(parts[0], "R") {
+					c.renamedFrom = parts[1]
+				}
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
+
+// formatHistory renders a file's history, capping each diff and their total
+func formatHistory(relPath string, commits []historyCommit, maxCommits int, includeDiffs, truncated bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "History of %s: %d commits, newest first (following renames)", relPath, len(commits))
+	if len(commits) == maxCommits {
+		fmt.Fprintf(&b, "\n%s", truncate.Marker(fmt.Sprintf("limit of %d commits", maxCommits), "any older commits", fmt.Sprintf("Raise max_commits (up to %d) for more.", maxHistoryCommits)))
+	}
+	b.WriteString("\n")
+
+	diffBytes := 0
+	for _, c := range commits {
+		fmt.Fprintf(&b, "\n%s %s %s: %s\n", c.hash[:min(len(c.hash), 8)], c.date, c.author, c.subject)
+		if c.renamedFrom != "" {
+			fmt.Fprintf(&b, "  renamed from %s\n", c.renamedFrom)
+		}
+		if !includeDiffs || c.diff == "" {
+			continue
+		}
+		if diffBytes >= maxHistoryDiffBytes {
+			fmt.Fprintf(&b, "  %s\n", truncate.Marker(fmt.Sprintf("diff limit of %d bytes reached", maxHistoryDiffBytes), "this commit's diff", "Request fewer commits."))
+			continue
+		}
+		diff := c.diff
+		if len(diff) > maxCommitDiffBytes {
+			diff = truncate.Bytes(diff, maxCommitDiffBytes, fmt.Sprintf("per-commit diff limit of %d bytes", maxCommitDiffBytes), "Use git_file_diff for the full change.")
+		}
+		diffBytes += len(diff)
+		fmt.Fprintf(&b, "%s\n", diff)
+	}
+
+	if truncated {
+		fmt.Fprintf(&b, "\n%s", truncate.Marker(fmt.Sprintf("git output limit of %d bytes", maxGitOutput), "older commits", "Request fewer commits."))
+	}
+	return b.String()
+}
@@ -0,0 +1,333 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+// qualifier matches the package qualifier of a type, such as "io." in io.Reader
+var qualifier = regexp.MustCompile(`\b\w+\.`)
+
+// implMethod is a method of a type or interface
+type implMethod struct {
+	sig     string // parameter and result types without names or package qualifiers
+	pointer bool   // declared on a pointer receiver
+}
+
+// implType is a named type declared in a package directory
+type implType struct {
+	name  string
+	dir   string
+	pkg   string
+	pos   token.Position
+	spec  *ast.TypeSpec
+	iface *ast.InterfaceType // nil for non-interface types
+}
+
+// implIndex holds the types and methods of every package in a tree, keyed by
+// directory and type name
+type implIndex struct {
+	types   map[string]*implType
+	methods map[string]map[string]implMethod
+}
+
+// implKey identifies a type within a tree
+func implKey(dir, name string) string {
+	return dir + "\x00" + name
+}
+
+// FindImplementations lists the types under root whose method sets satisfy
+// the named Go interface, which may be qualified with its package name as
+// pkg.Interface. Matching is structural, by method name and signature without
+// type checking, so results are best-effort: package qualifiers are ignored
+// when comparing types, and only embedding within a package is followed.
+func (h *Handler) FindImplementations(ctx context.Context, name, root string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	pkgName, ifaceName, qualified := strings.Cut(name, ".")
+	if !qualified {
+		pkgName, ifaceName = "", name
+	}
+
+	fset, files, err := h.parseGoTree(ctx, root, true, 0)
+	if err != nil {
+		return "", err
+	}
+	idx := buildImplIndex(fset, files)
+
+	var targets []*implType
+	for _, t := range idx.types {
+		if t.iface != nil && t.name == ifaceName && (pkgName == "" || t.pkg == pkgName) {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Sprintf("No interface named %s found in %d Go files", name, len(files)), nil
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].dir < targets[j].dir })
+
+	var sections []string
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		section, err := idx.implementationsOf(target)
+		if err != nil {
+			return "", err
+		}
+		sections = append(sections, section)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// buildImplIndex collects the named types and methods of the parsed files
+func buildImplIndex(fset *token.FileSet, files []goFile) implIndex {
+	idx := implIndex{types: make(map[string]*implType), methods: make(map[string]map[string]implMethod)}
+	for _, f := range files {
+		dir := filepath.Dir(f.path)
+		for _, decl := range f.ast.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range d.Specs {
+					ts := spec.(*ast.TypeSpec)
+					t := &implType{name: ts.Name.Name, dir: dir, pkg: f.ast.Name.Name, pos: fset.Position(ts.Pos()), spec: ts}
+					t.iface, _ = ts.Type.(*ast.InterfaceType)
+					idx.types[implKey(dir, t.name)] = t
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil || len(d.Recv.List) == 0 {
+					continue
+				}
+				key := implKey(dir, receiverType(d.Recv.List[0].Type))
+				if idx.methods[key] == nil {
+					idx.methods[key] = make(map[string]implMethod)
+				}
+				_, pointer := d.Recv.List[0].Type.(*ast.StarExpr)
+				idx.methods[key][d.Name.Name] = implMethod{sig: signature(d.Type), pointer: pointer}
+			}
+		}
+	}
+	return idx
+}
+
+// implementationsOf reports the types implementing one interface, and those
+// with all of its method names whose signatures differ
+func (idx implIndex) implementationsOf(target *implType) (string, error) {
+	want, unresolved, err := idx.interfaceMethods(target, map[string]bool{})
+	if err != nil {
+		return "", err
+	}
+	if len(want) == 0 && len(unresolved) == 0 {
+		return "", fmt.Errorf("%s.%s has no methods, so every type implements it", target.pkg, target.name)
+	}
+	names := make([]string, 0, len(want))
+	for m := range want {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+
+	var matches, nearMisses []string
+	var keys []string
+	for key := range idx.types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		t := idx.types[key]
+		if t.iface != nil {
+			continue
+		}
+		have := idx.typeMethods(t.dir, t.name, map[string]bool{})
+		if len(have) == 0 {
+			continue
+		}
+		pointer := false
+		var mismatched []string
+		missing := false
+		for _, m := range names {
+			got, ok := have[m]
+			switch {
+			case !ok:
+				missing = true
+			case got.sig != want[m].sig:
+				mismatched = append(mismatched, fmt.Sprintf("%s%s, want %s%s", m, got.sig, m, want[m].sig))
+			case got.pointer:
+				pointer = true
+			}
+			if missing {
+				break
+			}
+		}
+		if missing {
+			continue
+		}
+		label := t.name
+		if t.dir != target.dir {
+			label = t.pkg + "." + label
+		}
+		if pointer {
+			label = "*" + label
+		}
+		line := fmt.Sprintf("%s:%d: %s", t.pos.Filename, t.pos.Line, label)
+		if len(mismatched) > 0 {
+			nearMisses = append(nearMisses, fmt.Sprintf("%s (%s)", line, strings.Join(mismatched, "; ")))
+			continue
+		}
+		if pointer {
+			line += " (pointer receiver: only the pointer implements it)"
+		}
+		matches = append(matches, line)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Implementations of %s.%s (%s:%d, methods: %s), best-effort match by method name and signature without type checking:\n", target.pkg, target.name, target.pos.Filename, target.pos.Line, strings.Join(names, ", "))
+	if len(unresolved) > 0 {
+		fmt.Fprintf(&b, "Embedded interfaces not found in the tree, whose methods aren't checked: %s\n", strings.Join(unresolved, ", "))
+	}
+	if len(matches) == 0 {
+		b.WriteString("No implementing types found\n")
+	}
+	writeCapped(&b, matches, "implementations")
+	if len(nearMisses) > 0 {
+		fmt.Fprintf(&b, "\nTypes with every method name but a differing signature (%d):\n", len(nearMisses))
+		writeCapped(&b, nearMisses, "near misses")
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// writeCapped writes lines up to maxSymbolResults, then a truncation marker
+func writeCapped(b *strings.Builder, lines []string, what string) {
+	for i, line := range lines {
+		if i == maxSymbolResults {
+			b.WriteString(truncate.Marker(fmt.Sprintf("limit of %d %s", maxSymbolResults, what), fmt.Sprintf("%d %s", len(lines)-maxSymbolResults, what), "Narrow the path.") + "\n")
+			break
+		}
+		b.WriteString(line + "\n")
+	}
+}
+
+// interfaceMethods returns the method set of an interface including the
+// interfaces it embeds, and the embedded interfaces that couldn't be found
+func (idx implIndex) interfaceMethods(t *implType, seen map[string]bool) (map[string]implMethod, []string, error) {
+	methods := make(map[string]implMethod)
+	var unresolved []string
+	if t.spec.TypeParams != nil {
+		return nil, nil, fmt.Errorf("%s.%s is generic, which find_implementations doesn't support", t.pkg, t.name)
+	}
+	seen[implKey(t.dir, t.name)] = true
+	for _, field := range t.iface.Methods.List {
+		if len(field.Names) > 0 {
+			if fn, ok := field.Type.(*ast.FuncType); ok {
+				for _, n := range field.Names {
+					methods[n.Name] = implMethod{sig: signature(fn)}
+				}
+			}
+			continue
+		}
+
+		// An embedded interface, or a type constraint
+		var embedded *implType
+		switch e := field.Type.(type) {
+		case *ast.Ident:
+			if e.Name == "error" {
+				methods["Error"] = implMethod{sig: "() (string)"}
+				continue
+			}
+			embedded = idx.types[implKey(t.dir, e.Name)]
+		case *ast.SelectorExpr:
+			if pkg, ok := e.X.(*ast.Ident); ok {
+				embedded = idx.interfaceInPackage(pkg.Name, e.Sel.Name)
+			}
+		default:
+			return nil, nil, fmt.Errorf("%s.%s is a type constraint, not a method set", t.pkg, t.name)
+		}
+		if embedded == nil || embedded.iface == nil {
+			unresolved = append(unresolved, types.ExprString(field.Type))
+			continue
+		}
+		if seen[implKey(embedded.dir, embedded.name)] {
+			continue
+		}
+		inner, innerUnresolved, err := idx.interfaceMethods(embedded, seen)
+		if err != nil {
+			return nil, nil, err
+		}
+		for m, sig := range inner {
+			methods[m] = sig
+		}
+		unresolved = append(unresolved, innerUnresolved...)
+	}
+	return methods, unresolved, nil
+}
+
+// interfaceInPackage finds an interface by the name of its package
+func (idx implIndex) interfaceInPackage(pkg, name string) *implType {
+	for _, t := range idx.types {
+		if t.iface != nil && t.pkg == pkg && t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// typeMethods returns the methods declared on a type plus those promoted from
+// struct fields it embeds from the same package
+func (idx implIndex) typeMethods(dir, name string, seen map[string]bool) map[string]implMethod {
+	key := implKey(dir, name)
+	methods := make(map[string]implMethod)
+	if seen[key] {
+		return methods
+	}
+	seen[key] = true
+
+	if t := idx.types[key]; t != nil {
+		if st, ok := t.spec.Type.(*ast.StructType); ok {
+			for _, field := range st.Fields.List {
+				if len(field.Names) > 0 {
+					continue
+				}
+				_, byPointer := field.Type.(*ast.StarExpr)
+				embedded := receiverType(field.Type)
+				inner := idx.typeMethods(dir, embedded, seen)
+				if e := idx.types[implKey(dir, embedded)]; e != nil && e.iface != nil {
+					inner, _, _ = idx.interfaceMethods(e, map[string]bool{})
+				}
+				for m, method := range inner {
+					// Pointer methods of a field embedded by pointer are in the value's method set
+					if byPointer {
+						method.pointer = false
+					}
+					methods[m] = method
+				}
+			}
+		}
+	}
+	// Methods declared on the type itself shadow promoted ones
+	for m, method := range idx.methods[key] {
+		methods[m] = method
+	}
+	return methods
+}
+
+// signature formats a function's parameter and result types without their
+// names or package qualifiers, so signatures written in different packages
+// compare equal
+func signature(fn *ast.FuncType) string {
+	sig := "(" + fieldTypes(fn.Params, false) + ") (" + fieldTypes(fn.Results, false) + ")"
+	return qualifier.ReplaceAllString(sig, "")
+}
@@ -0,0 +1,222 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+// interactionCall is one message of a sequence diagram
+type interactionCall struct {
+	from, to  string // participant labels
+	label     string
+	uncertain string // why the target is uncertain, "" when resolved
+	note      string // recursive or already shown above
+	location  string // file:line of the call
+}
+
+// TraceInteraction renders the calls reachable from entry in the Go package
+// in dir as a sequence diagram in Mermaid or PlantUML syntax. Participants
+// are receiver types, the package itself for plain functions, and imported
+// packages when includeExternal is set. Calls resolved by name only
+// (dynamic, unresolved and ambiguous) are drawn dashed and listed as uncertain.
+func (h *Handler) TraceInteraction(ctx context.Context, dir, entry, format string, depth int, includeExternal bool) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if format == "" {
+		format = "mermaid"
+	}
+	if format != "mermaid" && format != "plantuml" {
+		return "", fmt.Errorf("unknown diagram format %q: must be mermaid or plantuml", format)
+	}
+	if depth <= 0 {
+		depth = defaultCallGraphDepth
+	}
+	depth = min(depth, maxCallGraphDepth)
+
+	fset, idx, entry, err := h.indexCalls(ctx, dir, entry)
+	if err != nil {
+		return "", err
+	}
+
+	var calls []interactionCall
+	expanded := map[string]bool{entry: true}
+	truncated := false
+	external := 0
+
+	var walk func(name string, level int, onPath map[string]bool)
+	walk = func(name string, level int, onPath map[string]bool) {
+		if truncated || ctx.Err() != nil {
+			return
+		}
+		from := idx.participant(name)
+		for _, edge := range callEdges(fset, idx.funcs[name], idx.funcs, idx.methods, idx.types) {
+			if len(calls) >= maxCallGraphNodes {
+				truncated = true
+				return
+			}
+			call := interactionCall{
+				from:     from,
+				to:       idx.participant(edge.target),
+				label:    callLabel(edge.target) + "()",
+				location: fmt.Sprintf("%s:%d", edge.pos.Filename, edge.pos.Line),
+			}
+			switch edge.kind {
+			case "":
+			case "external":
+				if !includeExternal {
+					external++
+					continue
+				}
+				call.to = strings.SplitN(edge.target, ".", 2)[0]
+			default:
+				call.to = uncertainParticipant(edge.target)
+				call.uncertain = edge.kind
+			}
+			switch {
+			case edge.kind != "":
+				calls = append(calls, call)
+			case onPath[edge.target]:
+				call.note = "recursive"
+				calls = append(calls, call)
+			case expanded[edge.target]:
+				call.note = "see above"
+				calls = append(calls, call)
+			case level >= depth:
+				call.note = "not expanded past the depth limit"
+				calls = append(calls, call)
+			default:
+				calls = append(calls, call)
+				expanded[edge.target] = true
+				onPath[edge.target] = true
+				walk(edge.target, level+1, onPath)
+				delete(onPath, edge.target)
+			}
+		}
+	}
+	walk(entry, 1, map[string]bool{entry: true})
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	entryPos := fset.Position(idx.funcs[entry].decl.Pos())
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sequence of calls from %s (%s:%d), depth %d, best-effort: calls are matched by name without type information\n\n", entry, entryPos.Filename, entryPos.Line, depth)
+	b.WriteString(renderSequence(format, idx.participant(entry), entry, calls))
+	if truncated {
+		fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("stopped after %d calls", maxCallGraphNodes), "the rest of the interaction", "Reduce the depth."))
+	}
+	if external > 0 {
+		fmt.Fprintf(&b, "\n%d calls into other packages are left out; set include_external to draw them.\n", external)
+	}
+
+	var uncertain []string
+	for _, call := range calls {
+		if call.uncertain != "" {
+			uncertain = append(uncertain, fmt.Sprintf("- %s -> %s [%s] (%s)", call.from, call.label, call.uncertain, call.location))
+		}
+	}
+	if len(uncertain) > 0 {
+		fmt.Fprintf(&b, "\nUncertain calls (%d), drawn dashed; the real target depends on runtime values or interface implementations:\n%s\n", len(uncertain), strings.Join(uncertain, "\n"))
+	}
+	return b.String(), nil
+}
+
+// participant names the component a package function belongs to: its
+// receiver type for a method, otherwise the package
+func (idx callIndex) participant(name string) string {
+	if typ, _, ok := strings.Cut(name, "."); ok && idx.funcs[name].decl != nil && idx.funcs[name].decl.Recv != nil {
+		return typ
+	}
+	return idx.pkg
+}
+
+// uncertainParticipant names the receiver of an unresolved call by its
+// expression, such as c.store for c.store.Get
+func uncertainParticipant(target string) string {
+	if i := strings.LastIndex(target, "."); i > 0 {
+		return target[:i] + " (?)"
+	}
+	return "? (" + target + ")"
+}
+
+// callLabel is the last element of a call target
+func callLabel(target string) string {
+	return target[strings.LastIndex(target, ".")+1:]
+}
+
+// renderSequence writes the calls as a fenced Mermaid or PlantUML sequence
+// diagram. Participants get short aliases since their labels may hold
+// characters neither syntax allows in names.
+func renderSequence(format, first, entry string, calls []interactionCall) string {
+	aliases := map[string]string{}
+	var order []string
+	alias := func(label string) string {
+		if a, ok := aliases[label]; ok {
+			return a
+		}
+		a := fmt.Sprintf("P%d", len(order))
+		aliases[label] = a
+		order = append(order, label)
+		return a
+	}
+	alias(first)
+	for _, call := range calls {
+		alias(call.from)
+		alias(call.to)
+	}
+
+	var lines []string
+	if format == "plantuml" {
+		lines = append(lines, "```plantuml", "@startuml")
+		for _, label := range order {
+			lines = append(lines, fmt.Sprintf("participant %q as %s", label, aliases[label]))
+		}
+		lines = append(lines, fmt.Sprintf("note over %s: %s", aliases[first], entry))
+		for _, call := range calls {
+			arrow := "->"
+			if call.uncertain != "" {
+				arrow = "-->"
+			}
+			lines = append(lines, fmt.Sprintf("%s %s %s: %s", aliases[call.from], arrow, aliases[call.to], messageText(call)))
+		}
+		lines = append(lines, "@enduml", "```")
+	} else {
+		lines = append(lines, "```mermaid", "sequenceDiagram")
+		for _, label := range order {
+			lines = append(lines, fmt.Sprintf("    participant %s as %s", aliases[label], mermaidText(label)))
+		}
+		lines = append(lines, fmt.Sprintf("    Note over %s: %s", aliases[first], mermaidText(entry)))
+		for _, call := range calls {
+			arrow := "->>"
+			if call.uncertain != "" {
+				arrow = "-->>"
+			}
+			lines = append(lines, fmt.Sprintf("    %s%s%s: %s", aliases[call.from], arrow, aliases[call.to], mermaidText(messageText(call))))
+		}
+		lines = append(lines, "```")
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// messageText labels a call, marking uncertain targets and calls not expanded
+func messageText(call interactionCall) string {
+	text := call.label
+	if call.uncertain != "" {
+		text += " [uncertain: " + strings.SplitN(call.uncertain, ":", 2)[0] + "]"
+	}
+	if call.note != "" {
+		text += " (" + call.note + ")"
+	}
+	return text
+}
+
+// mermaidText escapes characters Mermaid treats as syntax in labels
+func mermaidText(s string) string {
+	return strings.NewReplacer(";", "#59;", "#", "#35;").Replace(s)
+}
@@ -0,0 +1,238 @@
+package fileops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	maxJSONDiffs     = 200 // Limit differences returned by JSONDiff
+	maxJSONValueLen  = 120 // Limit the length of values quoted in JSONDiff output
+	jsonNumberBits   = 256 // Precision used to compare JSON numbers by value
+	jsonDiffRootPath = "$"
+)
+
+// jsonDifference is one structural difference between two JSON documents
+type jsonDifference struct {
+	op       string // "+" added, "-" removed, "~" changed
+	path     string
+	old, new any
+}
+
+// JSONDiff compares two JSON documents structurally and lists the keys and
+// elements added or removed and the values changed, each with its JSON path.
+// Key order and whitespace are ignored and numbers are compared by value.
+// Each document is given inline or as a path to a JSON file.
+func (h *Handler) JSONDiff(ctx context.Context, expected, actual string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	want, wantName, err := h.loadJSONDocument(ctx, expected, "expected")
+	if err != nil {
+		return "", err
+	}
+	got, gotName, err := h.loadJSONDocument(ctx, actual, "actual")
+	if err != nil {
+		return "", err
+	}
+
+	var diffs []jsonDifference
+	diffJSON(jsonDiffRootPath, want, got, &diffs)
+
+	if len(diffs) == 0 {
+		return fmt.Sprintf("No differences: %s and %s are equivalent JSON", wantName, gotName), nil
+	}
+
+	counts := map[string]int{}
+	for _, d := range diffs {
+		counts[d.op]++
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d differences between %s and %s (%d added, %d removed, %d changed):\n\n",
+		len(diffs), wantName, gotName, counts["+"], counts["-"], counts["~"])
+	for i, d := range diffs {
+		if i >= maxJSONDiffs {
+			fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("showing %d of %d differences", maxJSONDiffs, len(diffs)), fmt.Sprintf("%d differences", len(diffs)-maxJSONDiffs), "Compare smaller sub-documents for the rest."))
+			break
+		}
+		b.WriteString(d.describe())
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// loadJSONDocument parses value as inline JSON, or otherwise reads it as a
+// path to a JSON file. It returns the document and a name for it in output.
+func (h *Handler) loadJSONDocument(ctx context.Context, value, role string) (any, string, error) {
+	doc, err := decodeJSON(value)
+	if err == nil {
+		return doc, role, nil
+	}
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return nil, "", fmt.Errorf("%s is not valid JSON: %w", role, err)
+	}
+
+	content, err := h.ReadFile(ctx, trimmed)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s is neither inline JSON nor a readable file: %w", role, err)
+	}
+	doc, err = decodeJSON(content)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s as JSON: %w", trimmed, err)
+	}
+	return doc, trimmed, nil
+}
+
+// decodeJSON parses a single JSON document, keeping numbers exact
+func decodeJSON(content string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected content after the JSON document")
+	}
+	return doc, nil
+}
+
+// diffJSON appends the differences between want and got at path to diffs
+func diffJSON(path string, want, got any, diffs *[]jsonDifference) {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			wv, inWant := w[k]
+			gv, inGot := g[k]
+			child := jsonChildPath(path, k)
+			switch {
+			case !inGot:
+				*diffs = append(*diffs, jsonDifference{op: "-", path: child, old: wv})
+			case !inWant:
+				*diffs = append(*diffs, jsonDifference{op: "+", path: child, new: gv})
+			default:
+				diffJSON(child, wv, gv, diffs)
+			}
+		}
+		return
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+		for i := range max(len(w), len(g)) {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(g):
+				*diffs = append(*diffs, jsonDifference{op: "-", path: child, old: w[i]})
+			case i >= len(w):
+				*diffs = append(*diffs, jsonDifference{op: "+", path: child, new: g[i]})
+			default:
+				diffJSON(child, w[i], g[i], diffs)
+			}
+		}
+		return
+	case json.Number:
+		if g, ok := got.(json.Number); ok && numbersEqual(w, g) {
+			return
+		}
+	default:
+		if want == got {
+			return
+		}
+	}
+	*diffs = append(*diffs, jsonDifference{op: "~", path: path, old: want, new: got})
+}
+
+// numbersEqual reports whether two JSON numbers have the same value, so 1, 1.0 and 1e0 match
+func numbersEqual(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	x, _, errX := big.ParseFloat(a.String(), 10, jsonNumberBits, big.ToNearestEven)
+	y, _, errY := big.ParseFloat(b.String(), 10, jsonNumberBits, big.ToNearestEven)
+	return errX == nil && errY == nil && x.Cmp(y) == 0
+}
+
+// jsonIdentifier matches object keys that can be written in dot notation
+var jsonIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// jsonChildPath appends an object key to a JSON path, bracket-quoting keys that need it
+func jsonChildPath(path, key string) string {
+	if jsonIdentifier.MatchString(key) {
+		return path + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return path + "[" + string(quoted) + "]"
+}
+
+// describe renders a difference as one line
+func (d jsonDifference) describe() string {
+	switch d.op {
+	case "+":
+		return fmt.Sprintf("+ %s: added %s", d.path, jsonValue(d.new))
+	case "-":
+		return fmt.Sprintf("- %s: removed %s", d.path, jsonValue(d.old))
+	}
+	if oldType, newType := jsonType(d.old), jsonType(d.new); oldType != newType {
+		return fmt.Sprintf("~ %s: type changed from %s %s to %s %s", d.path, oldType, jsonValue(d.old), newType, jsonValue(d.new))
+	}
+	return fmt.Sprintf("~ %s: changed %s -> %s", d.path, jsonValue(d.old), jsonValue(d.new))
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// jsonValue renders a decoded value as compact JSON, shortened for display
+func jsonValue(v any) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	s := string(raw)
+	if len(s) > maxJSONValueLen {
+		s = s[:maxJSONValueLen-3] + "..."
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package fileops
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		want, got string
+		diffs     []string
+	}{
+		{
+			name: "equivalent",
+			want: `{"a": 1, "b": [true, null]}`,
+			got:  `{"b":[true,null],"a":1}`,
+		},
+		{
+			name: "numbers compared by value",
+			want: `{"n": 1, "f": 0.5, "big": 12345678901234567890}`,
+			got:  `{"n": 1.0, "f": 5e-1, "big": 1.2345678901234567890e19}`,
+		},
+		{
+			name: "added removed and changed keys",
+			want: `{"keep": 1, "gone": "x", "num": 2}`,
+			got:  `{"keep": 1, "new": false, "num": 3}`,
+			diffs: []string{
+				`- $.gone: removed "x"`,
+				`+ $.new: added false`,
+				`~ $.num: changed 2 -> 3`,
+			},
+		},
+		{
+			name: "nested paths",
+			want: `{"items": [{"id": 1}, {"id": 2}], "my key": {"x-y": 1}}`,
+			got:  `{"items": [{"id": 1}, {"id": 4}, {"id": 5}], "my key": {"x-y": 2}}`,
+			diffs: []string{
+				`~ $.items[1].id: changed 2 -> 4`,
+				`+ $.items[2]: added {"id":5}`,
+				`~ $["my key"]["x-y"]: changed 1 -> 2`,
+			},
+		},
+		{
+			name: "type change",
+			want: `{"port": 8080}`,
+			got:  `{"port": "8080"}`,
+			diffs: []string{
+				`~ $.port: type changed from number 8080 to string "8080"`,
+			},
+		},
+		{
+			name: "root replaced",
+			want: `[1]`,
+			got:  `{"a": 1}`,
+			diffs: []string{
+				`~ $: type changed from array [1] to object {"a":1}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := decodeJSON(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeJSON(tt.got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var diffs []jsonDifference
+			diffJSON(jsonDiffRootPath, want, got, &diffs)
+			var lines []string
+			for _, d := range diffs {
+				lines = append(lines, d.describe())
+			}
+			if !slices.Equal(lines, tt.diffs) {
+				t.Errorf("diffs = %q, want %q", lines, tt.diffs)
+			}
+		})
+	}
+}
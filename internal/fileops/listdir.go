@@ -0,0 +1,122 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxListEntries = 1000 // Limit entries returned by a recursive listing
+
+// ListDirectory lists the entries of a directory, marking directories with a
+// trailing / and giving the size of files. A recursive listing walks the
+// whole tree, indented by depth, without descending into hidden, vendor,
+// node_modules, dist and build directories.
+func (h *Handler) ListDirectory(ctx context.Context, path string, recursive bool) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	root, err := h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory: use read_file for files", root)
+	}
+
+	var lines []string
+	var skipped []skippedFile
+	files, dirs := 0, 0
+	truncated := false
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			skipped = append(skipped, skippedFile{p, skipReason(err)})
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		// Stop walking rather than count the rest of a huge tree
+		if len(lines) == maxListEntries {
+			truncated = true
+			return filepath.SkipAll
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		indent := strings.Repeat("  ", strings.Count(rel, string(filepath.Separator)))
+		name := d.Name()
+		switch {
+		case d.IsDir():
+			dirs++
+			if !recursive {
+				lines = append(lines, name+"/")
+				return filepath.SkipDir
+			}
+			if ignoredGrepDirs[name] || strings.HasPrefix(name, ".") {
+				lines = append(lines, indent+name+"/ (not listed)")
+				return filepath.SkipDir
+			}
+			lines = append(lines, indent+name+"/")
+		case d.Type()&fs.ModeSymlink != 0:
+			files++
+			target, err := os.Readlink(p)
+			if err != nil {
+				target = "?"
+			}
+			lines = append(lines, fmt.Sprintf("%s%s -> %s", indent, name, target))
+		default:
+			files++
+			info, err := d.Info()
+			if err != nil {
+				skipped = append(skipped, skippedFile{p, skipReason(err)})
+				return nil
+			}
+			lines = append(lines, fmt.Sprintf("%s%s (%d bytes)", indent, name, info.Size()))
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ctx.Err()) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to list directory: %w", err)
+	}
+
+	if len(lines) == 0 && len(skipped) == 0 {
+		return fmt.Sprintf("%s/ is empty", root), nil
+	}
+	var b strings.Builder
+	if truncated {
+		fmt.Fprintf(&b, "%s/ (first %d files and %d directories)\n", root, files, dirs)
+	} else {
+		fmt.Fprintf(&b, "%s/ (%d files, %d directories)\n", root, files, dirs)
+	}
+	b.WriteString(strings.Join(lines, "\n"))
+	if truncated {
+		fmt.Fprintf(&b, "\n%s", truncate.Marker(fmt.Sprintf("limit of %d entries", maxListEntries), "the rest of the tree", "List a subdirectory, or without recursive."))
+	}
+	return b.String() + skippedNote(skipped), nil
+}
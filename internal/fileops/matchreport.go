@@ -0,0 +1,25 @@
+package fileops
+
+import "context"
+
+// matchReporterKey carries a MatchReporter in a context
+type matchReporterKey struct{}
+
+// MatchReporter receives the matching lines of one file as a search finds
+// them, before the search as a whole returns
+type MatchReporter func(path string, lines []string)
+
+// WithMatchReporter returns a context under which GrepFiles reports each
+// file's matches to fn as soon as the file has been searched, so callers can
+// stream early hits of a long search. The full result is still returned at
+// the end.
+func WithMatchReporter(ctx context.Context, fn MatchReporter) context.Context {
+	return context.WithValue(ctx, matchReporterKey{}, fn)
+}
+
+// reportMatches passes a file's matches to the context's MatchReporter, if any
+func reportMatches(ctx context.Context, path string, lines []string) {
+	if fn, ok := ctx.Value(matchReporterKey{}).(MatchReporter); ok {
+		fn(path, lines)
+	}
+}
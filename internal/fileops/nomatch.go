@@ -0,0 +1,147 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// NoMatchSentinel is the first line of every result for a glob pattern that
+// matched nothing, so callers can detect the case reliably. Hints for
+// correcting the pattern may follow on later lines.
+const NoMatchSentinel = "No files matched the pattern"
+
+const (
+	maxNearMissEntries = 20000 // Limit entries walked looking for near misses
+	maxListedEntries   = 10    // Limit directory entries listed in a hint
+)
+
+// noMatch explains that pattern matched nothing, with hints for near misses:
+// a missing base directory, files with the pattern's extension elsewhere under
+// it (or none at all), or what the base directory does contain
+func (h *Handler) noMatch(ctx context.Context, pattern string) string {
+	base, rest := doublestar.SplitPattern(filepath.ToSlash(pattern))
+	dir := filepath.FromSlash(base)
+	hints := []string{}
+
+	info, err := os.Stat(dir)
+	switch {
+	case err != nil:
+		hint := fmt.Sprintf("The directory %s does not exist", dir)
+		if !filepath.IsAbs(dir) {
+			if cwd, err := os.Getwd(); err == nil {
+				hint += fmt.Sprintf(" (relative paths resolve against %s)", cwd)
+			}
+		}
+		hints = append(hints, hint)
+	case !info.IsDir():
+		hints = append(hints, fmt.Sprintf("%s is a file, not a directory", dir))
+	default:
+		if ext := patternExtension(rest); ext != "" {
+			hints = append(hints, h.extensionHint(ctx, dir, rest, ext))
+		} else if listing := h.listEntries(dir); listing != "" {
+			hints = append(hints, listing)
+		}
+	}
+
+	if len(hints) == 0 {
+		return NoMatchSentinel
+	}
+	return NoMatchSentinel + "\n- " + strings.Join(hints, "\n- ")
+}
+
+// patternExtension returns the literal extension of a pattern's last segment,
+// such as ".go" for "**/*.go", or "" if it has none or it contains wildcards
+func patternExtension(pattern string) string {
+	ext := path.Ext(path.Base(pattern))
+	if ext == "" || strings.ContainsAny(ext, "*?[]{}\\") {
+		return ""
+	}
+	return ext
+}
+
+// extensionHint reports whether files with ext exist anywhere under dir,
+// suggesting a recursive pattern when they do and the pattern isn't recursive
+func (h *Handler) extensionHint(ctx context.Context, dir, rest, ext string) string {
+	count := 0
+	example := ""
+	limited := false
+	entries := 0
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entries++
+		if entries > maxNearMissEntries {
+			limited = true
+			return filepath.SkipAll
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != dir && (ignoredGrepDirs[name] || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.EqualFold(filepath.Ext(name), ext) && h.withinRoots(p) {
+			count++
+			if example == "" {
+				example = p
+			}
+		}
+		return nil
+	})
+
+	if count == 0 {
+		if limited {
+			return fmt.Sprintf("No %s files found in the first %d entries under %s; check the extension and directory", ext, maxNearMissEntries, dir)
+		}
+		return fmt.Sprintf("No %s files exist anywhere under %s (outside hidden and vendored directories); check the extension and directory", ext, dir)
+	}
+
+	atLeast := ""
+	if limited {
+		atLeast = "at least "
+	}
+	hint := fmt.Sprintf("%s%d %s files do exist under %s, e.g. %s", atLeast, count, ext, dir, example)
+	if !strings.Contains(rest, "**") {
+		hint += fmt.Sprintf("; try the recursive pattern %s", filepath.Join(dir, "**", "*"+ext))
+	}
+	return hint
+}
+
+// listEntries summarizes what a directory contains, or "" if it can't be read
+func (h *Handler) listEntries(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	if len(entries) == 0 {
+		return fmt.Sprintf("The directory %s is empty", dir)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	more := ""
+	if len(names) > maxListedEntries {
+		more = fmt.Sprintf(" and %d more", len(names)-maxListedEntries)
+		names = names[:maxListedEntries]
+	}
+	return fmt.Sprintf("%s contains %s%s", dir, strings.Join(names, ", "), more)
+}
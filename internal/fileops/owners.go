@@ -0,0 +1,286 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxOwnedFiles = 500 // Limit files reported by FindOwners
+
+// codeownersLocations are where GitHub looks for a CODEOWNERS file, in order
+var codeownersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// ownerRule is one pattern line of a CODEOWNERS file
+type ownerRule struct {
+	line    int
+	pattern string
+	glob    string   // pattern as a doublestar glob relative to the repository root
+	dirGlob string   // glob matching files below a directory the pattern names, empty if none
+	owners  []string // empty when the pattern explicitly removes ownership
+}
+
+// FindOwners reports the owners of each file matching pattern according to the
+// CODEOWNERS file of the repository at root, where the last matching rule wins
+func (h *Handler) FindOwners(ctx context.Context, pattern, root string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	root, err := h.resolvePath(h.defaultDir(root))
+	if err != nil {
+		return "", err
+	}
+	root = canonicalPath(root)
+
+	ownersPath, rules, invalid, err := h.loadCodeowners(root)
+	if err != nil {
+		return "", err
+	}
+	if ownersPath == "" {
+		return fmt.Sprintf("No CODEOWNERS file found in %s (looked for %s). Ownership isn't configured for this repository, so base reviewer suggestions on other evidence such as git history", root, strings.Join(codeownersLocations, ", ")), nil
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	pattern, err = h.resolvePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	matches, note, err := h.globPaths(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid path pattern: %w", err)
+	}
+
+	header := fmt.Sprintf("Ownership from %s (%d rules, last matching rule wins)", ownersPath, len(rules))
+	for _, line := range invalid {
+		header += fmt.Sprintf("\nWARNING: %s", line)
+	}
+	if len(matches) == 0 {
+		return header + "\n\n" + h.noMatch(ctx, pattern) + globNote(note), nil
+	}
+
+	var results []string
+	var skipped []skippedFile
+	owned, unowned := 0, 0
+	truncated := false
+
+	for _, path := range matches {
+		// Check context periodically
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		if !h.withinRoots(path) {
+			skipped = append(skipped, skippedFile{path, "outside allowed roots"})
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		rel, err := filepath.Rel(root, canonicalPath(path))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			skipped = append(skipped, skippedFile{path, "outside the repository"})
+			continue
+		}
+
+		if len(results) >= maxOwnedFiles {
+			truncated = true
+			break
+		}
+
+		rule := matchOwnerRule(rules, filepath.ToSlash(rel))
+		switch {
+		case rule == nil:
+			unowned++
+			results = append(results, fmt.Sprintf("%s: no owners (no matching rule)", path))
+		case len(rule.owners) == 0:
+			unowned++
+			results = append(results, fmt.Sprintf("%s: no owners (line %d: %s)", path, rule.line, rule.pattern))
+		default:
+			owned++
+			results = append(results, fmt.Sprintf("%s: %s (line %d: %s)", path, strings.Join(rule.owners, " "), rule.line, rule.pattern))
+		}
+	}
+
+	if len(results) == 0 {
+		return header + "\n\n" + NoMatchSentinel + skippedNote(skipped) + globNote(note), nil
+	}
+
+	summary := fmt.Sprintf("%d files: %d owned, %d without owners", len(results), owned, unowned)
+	output := header + "\n" + summary + "\n\n" + strings.Join(results, "\n")
+	if truncated {
+		output += "\n\n" + truncate.Marker(fmt.Sprintf("stopped after %d files", maxOwnedFiles), "any further files", "Narrow the pattern.")
+	}
+	return output + skippedNote(skipped) + globNote(note), nil
+}
+
+// loadCodeowners finds and parses the CODEOWNERS file of the repository at
+// root. It returns an empty path when there is none, and descriptions of
+// lines that couldn't be used.
+func (h *Handler) loadCodeowners(root string) (string, []ownerRule, []string, error) {
+	for _, location := range codeownersLocations {
+		path := filepath.Join(root, filepath.FromSlash(location))
+		if !h.withinRoots(path) {
+			continue
+		}
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+
+		if err := h.checkExtension(path); err != nil {
+			return "", nil, nil, err
+		}
+
+		rules, invalid, err := parseCodeowners(file)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return path, rules, invalid, nil
+	}
+	return "", nil, nil, nil
+}
+
+// parseCodeowners parses CODEOWNERS rules, skipping comments, blank lines and
+// GitLab-style [Section] headers
+func parseCodeowners(file *os.File) ([]ownerRule, []string, error) {
+	scanner := bufio.NewScanner(file)
+	// Increase buffer size to handle long lines (1MB max token)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var rules []ownerRule
+	var invalid []string
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+
+		fields := codeownersFields(line)
+		pattern := fields[0]
+		var owners []string
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "#") {
+				break // trailing comment
+			}
+			owners = append(owners, field)
+		}
+
+		if strings.HasPrefix(pattern, "!") {
+			invalid = append(invalid, fmt.Sprintf("line %d: negated pattern %s is not supported by CODEOWNERS and is ignored", lineNum, pattern))
+			continue
+		}
+		rule, err := newOwnerRule(lineNum, pattern, owners)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("line %d: %v", lineNum, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, invalid, scanner.Err()
+}
+
+// codeownersFields splits a CODEOWNERS line on whitespace, keeping
+// backslash-escaped spaces in the pattern
+func codeownersFields(line string) []string {
+	var fields []string
+	var current strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			if r != ' ' {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ' ' || r == '\t':
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// newOwnerRule converts a gitignore-style CODEOWNERS pattern to globs. A
+// pattern with a leading or inner slash is anchored to the repository root,
+// otherwise it matches at any depth. A pattern naming a directory also owns
+// everything below it, except that a trailing /* owns only direct children.
+func newOwnerRule(line int, pattern string, owners []string) (ownerRule, error) {
+	trimmed := strings.TrimSuffix(pattern, "/")
+	dirOnly := trimmed != pattern
+	anchored := strings.Contains(trimmed, "/")
+	glob := strings.TrimPrefix(trimmed, "/")
+	if glob == "" {
+		return ownerRule{}, fmt.Errorf("pattern %q matches nothing", pattern)
+	}
+	if !anchored {
+		glob = "**/" + glob
+	}
+	if !doublestar.ValidatePattern(glob) {
+		return ownerRule{}, fmt.Errorf("invalid pattern %q", pattern)
+	}
+
+	rule := ownerRule{line: line, pattern: pattern, glob: glob, owners: owners}
+	if !strings.HasSuffix(glob, "/*") {
+		rule.dirGlob = glob + "/**"
+	}
+	if dirOnly {
+		rule.glob = "" // only files below the directory match
+	}
+	return rule, nil
+}
+
+// matchOwnerRule returns the last rule matching a slash-separated path
+// relative to the repository root, or nil if none does
+func matchOwnerRule(rules []ownerRule, rel string) *ownerRule {
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := &rules[i]
+		if rule.glob != "" {
+			if ok, _ := doublestar.Match(rule.glob, rel); ok {
+				return rule
+			}
+		}
+		if rule.dirGlob != "" {
+			if ok, _ := doublestar.Match(rule.dirGlob, rel); ok {
+				return rule
+			}
+		}
+	}
+	return nil
+}
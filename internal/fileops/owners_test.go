@@ -0,0 +1,67 @@
+package fileops
+
+import "testing"
+
+func TestMatchOwnerRule(t *testing.T) {
+	var rules []ownerRule
+	for i, pattern := range []string{
+		"*",
+		"*.go",
+		"/build/",
+		"docs/*",
+		"apps",
+		"/scripts/deploy.sh",
+	} {
+		var owners []string
+		if pattern != "/scripts/deploy.sh" {
+			owners = []string{"@team"}
+		}
+		rule, err := newOwnerRule(i+1, pattern, owners)
+		if err != nil {
+			t.Fatalf("newOwnerRule(%q): %v", pattern, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantLine int // 0 for no matching rule
+	}{
+		{name: "catch-all", path: "README.md", wantLine: 1},
+		{name: "unanchored extension at any depth", path: "cmd/tool/main.go", wantLine: 2},
+		{name: "anchored directory", path: "build/out.bin", wantLine: 3},
+		{name: "anchored directory nested file", path: "build/linux/out.bin", wantLine: 3},
+		{name: "anchored directory elsewhere", path: "pkg/build/out.bin", wantLine: 1},
+		{name: "trailing /* direct child", path: "docs/guide.md", wantLine: 4},
+		{name: "trailing /* grandchild", path: "docs/api/ref.md", wantLine: 1},
+		{name: "last match wins", path: "docs/example.go", wantLine: 4},
+		{name: "unanchored directory at root", path: "apps/web/index.html", wantLine: 5},
+		{name: "unanchored directory nested", path: "src/apps/main.go", wantLine: 5},
+		{name: "rule without owners", path: "scripts/deploy.sh", wantLine: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := matchOwnerRule(rules, tt.path)
+			got := 0
+			if rule != nil {
+				got = rule.line
+			}
+			if got != tt.wantLine {
+				t.Errorf("matchOwnerRule(%q) = line %d, want line %d", tt.path, got, tt.wantLine)
+			}
+		})
+	}
+
+	if rule := matchOwnerRule(rules[1:], "README.md"); rule != nil {
+		t.Errorf("matchOwnerRule without a catch-all = line %d, want no match", rule.line)
+	}
+}
+
+func TestNewOwnerRuleInvalid(t *testing.T) {
+	for _, pattern := range []string{"/", "src/[a-"} {
+		if _, err := newOwnerRule(1, pattern, []string{"@team"}); err == nil {
+			t.Errorf("newOwnerRule(%q) succeeded, want an error", pattern)
+		}
+	}
+}
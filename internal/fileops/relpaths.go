@@ -0,0 +1,110 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pathPrefix is an absolute directory rewritten by RelativizePaths
+type pathPrefix struct {
+	dir         string
+	replacement string // "." for the base directory itself
+}
+
+// WithRelativePaths makes RelativizePaths rewrite absolute paths under the
+// allowed roots relative to the first root (or the working directory when
+// unrestricted), and other paths under the home directory to ~. Relative
+// paths resolve against the working directory, so the server should run from
+// the base directory.
+func WithRelativePaths(enabled bool) Option {
+	return func(h *Handler) {
+		h.relativePaths = enabled
+	}
+}
+
+// buildPathPrefixes computes the rewrites for RelativizePaths, longest directory first
+func (h *Handler) buildPathPrefixes() {
+	base := canonicalPath(h.defaultDir(""))
+
+	seen := make(map[string]bool)
+	add := func(dir, replacement string) {
+		for _, d := range []string{dir, canonicalPath(dir)} {
+			if d == "" || d == string(filepath.Separator) || seen[d] {
+				continue
+			}
+			seen[d] = true
+			h.pathPrefixes = append(h.pathPrefixes, pathPrefix{dir: d, replacement: replacement})
+		}
+	}
+	add(base, ".")
+	for _, root := range h.roots {
+		if rel, err := filepath.Rel(base, root); err == nil {
+			add(root, rel)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		add(home, "~")
+	}
+
+	sort.SliceStable(h.pathPrefixes, func(i, j int) bool {
+		return len(h.pathPrefixes[i].dir) > len(h.pathPrefixes[j].dir)
+	})
+}
+
+// RelativizePaths rewrites absolute paths in text to be relative to the base
+// directory, or ~-relative under the home directory, when the handler was
+// created with WithRelativePaths. Otherwise text is returned unchanged.
+func (h *Handler) RelativizePaths(text string) string {
+	if len(h.pathPrefixes) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != filepath.Separator || (i > 0 && pathByte(text[i-1])) {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+		matched := false
+		for _, p := range h.pathPrefixes {
+			if !strings.HasPrefix(text[i:], p.dir) {
+				continue
+			}
+			end := i + len(p.dir)
+			// Only whole path components match: /home/u/proj must not match /home/u/project
+			if end < len(text) && text[end] != filepath.Separator && pathByte(text[end]) && !sentenceEnd(text, end) {
+				continue
+			}
+			switch {
+			case p.replacement == "." && end < len(text) && text[end] == filepath.Separator:
+				end++ // base/x becomes x rather than ./x
+			case p.replacement == "." && end < len(text) && text[end] == '.':
+				b.WriteString("./") // not "..", which reads as the parent directory
+			default:
+				b.WriteString(p.replacement)
+			}
+			i = end
+			matched = true
+			break
+		}
+		if !matched {
+			b.WriteByte(text[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// sentenceEnd reports whether text[i] is punctuation ending a sentence rather than part of a path
+func sentenceEnd(text string, i int) bool {
+	return text[i] == '.' && (i+1 == len(text) || !pathByte(text[i+1]))
+}
+
+// pathByte reports whether c can continue a path component
+func pathByte(c byte) bool {
+	return c == '-' || c == '_' || c == '.' || c == '~' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,194 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"gopkg.in/yaml.v3"
+)
+
+const maxSchemaErrors = 100 // Limit validation errors returned by ValidateSchema
+
+// schemaLoader loads $ref'd schema files through ReadFile, so references are
+// held to the allowed roots and extension filters. Remote references are refused.
+type schemaLoader struct {
+	ctx context.Context
+	h   *Handler
+}
+
+// Load implements jsonschema.URLLoader
+func (l schemaLoader) Load(rawURL string) (any, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("remote schema references are not supported: %s", rawURL)
+	}
+	path, err := jsonschema.FileLoader{}.ToFile(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	content, err := l.h.ReadFile(l.ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := decodeDocuments(path, content)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) != 1 {
+		return nil, fmt.Errorf("%s: a schema must be a single document, found %d", path, len(docs))
+	}
+	return docs[0], nil
+}
+
+// ValidateSchema validates a JSON or YAML data file against a JSON Schema
+// (itself JSON or YAML) and lists each violation with the JSON pointer of the
+// offending value. Each document of a multi-document YAML file is validated.
+func (h *Handler) ValidateSchema(ctx context.Context, dataPath, schemaPath string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	resolvedSchema, err := h.resolvePath(schemaPath)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(resolvedSchema)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve schema path: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(schemaLoader{ctx: ctx, h: h})
+	schema, err := compiler.Compile(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid schema: %w", err)
+	}
+
+	content, err := h.ReadFile(ctx, dataPath)
+	if err != nil {
+		return "", err
+	}
+	docs, err := decodeDocuments(dataPath, content)
+	if err != nil {
+		return "", err
+	}
+	if len(docs) == 0 {
+		return "", fmt.Errorf("%s contains no documents", dataPath)
+	}
+
+	var problems []string
+	total := 0
+	for i, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		verr := schema.Validate(doc)
+		if verr == nil {
+			continue
+		}
+		var validationErr *jsonschema.ValidationError
+		if !errors.As(verr, &validationErr) {
+			return "", fmt.Errorf("validation failed: %w", verr)
+		}
+		prefix := ""
+		if len(docs) > 1 {
+			prefix = fmt.Sprintf("document %d ", i+1)
+		}
+		for _, unit := range schemaErrorLeaves(validationErr.DetailedOutput()) {
+			total++
+			if len(problems) < maxSchemaErrors {
+				location := unit.InstanceLocation
+				if location == "" {
+					location = "/"
+				}
+				problems = append(problems, fmt.Sprintf("- %s%s: %s (schema %s)", prefix, location, unit.Error, unit.KeywordLocation))
+			}
+		}
+	}
+
+	if total == 0 {
+		if len(docs) > 1 {
+			return fmt.Sprintf("valid: all %d documents in %s conform to %s", len(docs), dataPath, schemaPath), nil
+		}
+		return fmt.Sprintf("valid: %s conforms to %s", dataPath, schemaPath), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid: %d validation errors in %s against %s\n", total, dataPath, schemaPath)
+	b.WriteString(strings.Join(problems, "\n"))
+	b.WriteString("\n")
+	if total > len(problems) {
+		fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("showing %d of %d errors", len(problems), total), fmt.Sprintf("%d errors", total-len(problems)), "Fix these and validate again."))
+	}
+	return b.String(), nil
+}
+
+// schemaErrorLeaves returns the innermost errors of a validation output tree,
+// dropping the grouping and $ref errors that only wrap them
+func schemaErrorLeaves(unit *jsonschema.OutputUnit) []*jsonschema.OutputUnit {
+	if len(unit.Errors) == 0 {
+		if unit.Error == nil {
+			return nil
+		}
+		return []*jsonschema.OutputUnit{unit}
+	}
+	var leaves []*jsonschema.OutputUnit
+	for i := range unit.Errors {
+		leaves = append(leaves, schemaErrorLeaves(&unit.Errors[i])...)
+	}
+	return leaves
+}
+
+// decodeDocuments parses a .yaml/.yml file (which may hold several documents)
+// or a JSON file into values suitable for schema validation
+func decodeDocuments(path, content string) ([]any, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".yaml" && ext != ".yml" {
+		doc, err := jsonschema.UnmarshalJSON(strings.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s as JSON: %w", path, err)
+		}
+		return []any{doc}, nil
+	}
+
+	var docs []any
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var doc any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s as YAML: %w", path, err)
+		}
+		if doc == nil {
+			continue
+		}
+		// Round-trip through JSON so values have the types the validator expects
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s to JSON: %w", path, err)
+		}
+		value, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s to JSON: %w", path, err)
+		}
+		docs = append(docs, value)
+	}
+	return docs, nil
+}
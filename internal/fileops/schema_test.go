@@ -0,0 +1,81 @@
+package fileops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchemaLocations(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{
+  "type": "object",
+  "required": ["name"],
+  "properties": {
+    "name": {"type": "string"},
+    "items": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {"price": {"type": "number"}}
+      }
+    }
+  }
+}`
+	if err := os.WriteFile(filepath.Join(dir, "schema.json"), []byte(schema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		data string
+		want []string // lines expected in the output
+	}{
+		{
+			name: "valid",
+			file: "valid.json",
+			data: `{"name": "widget", "items": [{"price": 1.5}]}`,
+			want: []string{"valid: "},
+		},
+		{
+			name: "nested array element",
+			file: "nested.json",
+			data: `{"name": "widget", "items": [{"price": 1}, {"price": "free"}]}`,
+			want: []string{"- /items/1/price: ", "(schema /properties/items/items/properties/price/type)"},
+		},
+		{
+			name: "missing property reported at the root",
+			file: "missing.json",
+			data: `{"items": []}`,
+			want: []string{"- /: ", "(schema /required)"},
+		},
+		{
+			name: "second YAML document",
+			file: "docs.yaml",
+			data: "name: first\n---\nname: 42\n",
+			want: []string{"- document 2 /name: ", "(schema /properties/name/type)"},
+		},
+	}
+
+	h := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataPath := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(dataPath, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := h.ValidateSchema(context.Background(), dataPath, filepath.Join(dir, "schema.json"))
+			if err != nil {
+				t.Fatalf("ValidateSchema: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output missing %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const fifoPollInterval = 50 * time.Millisecond // how often readFIFO checks for a writer
+
+// WithFIFOTimeout lets read_file read named pipes, waiting at most d for
+// data before returning what arrived. Zero or less refuses them, since a
+// pipe nobody writes to would block the read forever.
+func WithFIFOTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.fifoTimeout = max(d, 0)
+	}
+}
+
+// checkFileMode refuses files that can't be read like regular files:
+// directories, devices, sockets and, unless enabled with WithFIFOTimeout,
+// named pipes
+func (h *Handler) checkFileMode(path string, info fs.FileInfo) error {
+	mode := info.Mode()
+	switch {
+	case mode.IsRegular():
+		return nil
+	case mode.IsDir():
+		return fmt.Errorf("%s is a directory: use list_directory or glob_files to see its contents", path)
+	case mode&fs.ModeNamedPipe != 0:
+		if h.fifoTimeout > 0 {
+			return nil
+		}
+		return fmt.Errorf("%s is a named pipe, which may block forever: reading pipes is disabled by server policy", path)
+	case mode&fs.ModeDevice != 0:
+		return fmt.Errorf("%s is a device, not a file: reading devices is refused", path)
+	case mode&fs.ModeSocket != 0:
+		return fmt.Errorf("%s is a socket, not a file: reading sockets is refused", path)
+	default:
+		return fmt.Errorf("%s is not a regular file (mode %s): reading it is refused", path, mode.Type())
+	}
+}
+
+// readFIFO reads a named pipe until its writer closes it, the FIFO timeout
+// passes or the size limit is reached, returning whatever arrived with a note
+// if the read was cut short
+func (h *Handler) readFIFO(ctx context.Context, path string) (string, error) {
+	// Opening without O_NONBLOCK waits for a writer, which may never come
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to open named pipe: %w", err)
+	}
+	defer file.Close()
+
+	deadline := time.Now().Add(h.fifoTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := file.SetReadDeadline(deadline); err != nil {
+		return "", fmt.Errorf("failed to set read deadline on named pipe: %w", err)
+	}
+
+	var content []byte
+	timedOut := false
+	buf := make([]byte, 64*1024)
+	for len(content) <= maxFileSize {
+		n, err := file.Read(buf)
+		content = append(content, buf[:n]...)
+		if errors.Is(err, io.EOF) && len(content) == 0 {
+			// No writer has opened the pipe yet; poll until one does
+			if time.Now().After(deadline) {
+				timedOut = true
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(fifoPollInterval):
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			timedOut = true
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read named pipe: %w", err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(content) > maxFileSize:
+		return string(content[:maxFileSize]) + "\n" + truncate.Marker(fmt.Sprintf("limit of %d bytes", maxFileSize), "the rest of the pipe's data", ""), nil
+	case timedOut && len(content) == 0:
+		return fmt.Sprintf("No data arrived from named pipe %s within %s", path, h.fifoTimeout), nil
+	case timedOut:
+		return string(content) + "\n" + truncate.Marker(fmt.Sprintf("stopped waiting for the named pipe after %s", h.fifoTimeout), "any data written later", ""), nil
+	}
+	return string(content), nil
+}
@@ -0,0 +1,142 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxSymbolResults = 200 // Limit definitions and references returned by LocateSymbol
+
+// symbolHit is a definition or reference of a symbol
+type symbolHit struct {
+	pos  token.Position
+	kind string
+	desc string
+}
+
+// LocateSymbol finds definitions (and optionally references) of a Go symbol
+// across every .go file under root. Methods may be named as Type.Method.
+func (h *Handler) LocateSymbol(ctx context.Context, name, root string, includeReferences bool) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	typeName, member, qualified := strings.Cut(name, ".")
+	if !qualified {
+		member = name
+	}
+
+	fset, files, err := h.parseGoTree(ctx, root, true, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var defs, refs []symbolHit
+	seen := make(map[string]bool)
+	add := func(list *[]symbolHit, hit symbolHit) {
+		key := fmt.Sprintf("%s:%d:%s", hit.pos.Filename, hit.pos.Line, hit.kind)
+		if !seen[key] {
+			seen[key] = true
+			*list = append(*list, hit)
+		}
+	}
+	defPos := make(map[token.Pos]bool)
+
+	for _, f := range files {
+		for _, decl := range f.ast.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				recv := ""
+				if d.Recv != nil && len(d.Recv.List) > 0 {
+					recv = receiverType(d.Recv.List[0].Type)
+				}
+				if d.Name.Name != member || (qualified && recv != typeName) {
+					continue
+				}
+				kind := "func"
+				if recv != "" {
+					kind = "method"
+				}
+				defPos[d.Name.Pos()] = true
+				add(&defs, symbolHit{pos: fset.Position(d.Pos()), kind: kind, desc: funcName(d)})
+
+			case *ast.GenDecl:
+				if qualified {
+					continue
+				}
+				for _, spec := range d.Specs {
+					switch sp := spec.(type) {
+					case *ast.TypeSpec:
+						if sp.Name.Name == name {
+							defPos[sp.Name.Pos()] = true
+							add(&defs, symbolHit{pos: fset.Position(sp.Pos()), kind: "type", desc: name})
+						}
+					case *ast.ValueSpec:
+						for _, ident := range sp.Names {
+							if ident.Name == name {
+								defPos[ident.Pos()] = true
+								add(&defs, symbolHit{pos: fset.Position(ident.Pos()), kind: d.Tok.String(), desc: name})
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if includeReferences {
+		for _, f := range files {
+			ast.Inspect(f.ast, func(n ast.Node) bool {
+				ident, ok := n.(*ast.Ident)
+				if !ok || ident.Name != member || defPos[ident.Pos()] {
+					return true
+				}
+				add(&refs, symbolHit{pos: fset.Position(ident.Pos()), kind: "ref"})
+				return true
+			})
+		}
+	}
+
+	if len(defs) == 0 && len(refs) == 0 {
+		return fmt.Sprintf("No definitions of %s found in %d Go files", name, len(files)), nil
+	}
+
+	byLocation := func(list []symbolHit) {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].pos.Filename != list[j].pos.Filename {
+				return list[i].pos.Filename < list[j].pos.Filename
+			}
+			return list[i].pos.Line < list[j].pos.Line
+		})
+	}
+	byLocation(defs)
+	byLocation(refs)
+
+	var results []string
+	results = append(results, fmt.Sprintf("Definitions of %s (%d):", name, len(defs)))
+	for _, d := range defs[:min(len(defs), maxSymbolResults)] {
+		results = append(results, fmt.Sprintf("%s:%d: %s %s", d.pos.Filename, d.pos.Line, d.kind, d.desc))
+	}
+	if len(defs) > maxSymbolResults {
+		results = append(results, truncate.Marker(fmt.Sprintf("limit of %d definitions", maxSymbolResults), fmt.Sprintf("%d definitions", len(defs)-maxSymbolResults), "Qualify the name or narrow the path."))
+	}
+
+	if includeReferences {
+		results = append(results, fmt.Sprintf("\nReferences to %s (%d, by identifier name):", member, len(refs)))
+		for _, r := range refs[:min(len(refs), maxSymbolResults)] {
+			results = append(results, fmt.Sprintf("%s:%d", r.pos.Filename, r.pos.Line))
+		}
+		if len(refs) > maxSymbolResults {
+			results = append(results, truncate.Marker(fmt.Sprintf("limit of %d references", maxSymbolResults), fmt.Sprintf("%d references", len(refs)-maxSymbolResults), "Qualify the name or narrow the path."))
+		}
+	}
+
+	return strings.Join(results, "\n"), nil
+}
@@ -0,0 +1,146 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const (
+	defaultTailLines = 500
+	maxTailLines     = 10000
+	maxTailOutput    = 1024 * 1024       // Limit bytes returned by TailFile
+	maxTailScan      = 256 * 1024 * 1024 // Limit bytes scanned backwards when filtering
+	tailChunkSize    = 64 * 1024
+)
+
+// TailFile returns the last n lines of a file of any size, reading backwards
+// from the end. With a pattern, it returns the last n lines matching it.
+func (h *Handler) TailFile(ctx context.Context, path string, n int, pattern string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if n <= 0 {
+		n = defaultTailLines
+	}
+	n = min(n, maxTailLines)
+
+	var re *regexp.Regexp
+	if pattern != "" {
+		if err := h.checkGrepPattern(pattern); err != nil {
+			return "", err
+		}
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex pattern: %w", err)
+		}
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	path, err := h.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Enforce extension allow/deny lists before opening
+	if err := h.checkExtension(path); err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	var lines []string // newest first
+	var carry []byte   // partial line at the start of the previous chunk
+	offset := info.Size()
+	scanned := int64(0)
+	outputBytes := 0
+	stopped := ""
+	first := true
+
+	for offset > 0 && len(lines) < n && stopped == "" {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if re != nil && scanned >= maxTailScan {
+			stopped = truncate.Marker(fmt.Sprintf("scan limit of the last %d bytes", maxTailScan), "any earlier matching lines", "Use grep_in_file with a line range to search the rest.")
+			break
+		}
+
+		size := min(int64(tailChunkSize), offset)
+		offset -= size
+		chunk := make([]byte, size, int(size)+len(carry))
+		if _, err := file.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		scanned += size
+		data := append(chunk, carry...)
+
+		parts := strings.Split(string(data), "\n")
+		// The first part may continue in the previous chunk unless we reached the start
+		carry = nil
+		if offset > 0 {
+			carry = []byte(parts[0])
+			parts = parts[1:]
+		}
+		// A line with no newline in sight would otherwise be buffered whole
+		if len(carry) > maxFileSize {
+			stopped = truncate.Marker(fmt.Sprintf("line length limit of %d bytes", maxFileSize), "a longer line and any lines before it", "Use grep_in_file to search the file instead.")
+		}
+		// Ignore the empty string after a trailing newline
+		if first && len(parts) > 0 && parts[len(parts)-1] == "" {
+			parts = parts[:len(parts)-1]
+		}
+		first = false
+
+		for i := len(parts) - 1; i >= 0 && len(lines) < n; i-- {
+			line := strings.TrimSuffix(parts[i], "\r")
+			if re != nil && !re.MatchString(line) {
+				continue
+			}
+			if outputBytes+len(line) > maxTailOutput {
+				stopped = truncate.Marker(fmt.Sprintf("output limit of %d bytes", maxTailOutput), "earlier lines", "Request fewer lines.")
+				break
+			}
+			outputBytes += len(line) + 1
+			lines = append(lines, line)
+		}
+	}
+
+	// Restore file order
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	header := fmt.Sprintf("Last %d lines of %s (%d bytes)", len(lines), path, info.Size())
+	if re != nil {
+		header = fmt.Sprintf("Last %d lines matching %q in %s (%d bytes, scanned last %d)", len(lines), pattern, path, info.Size(), scanned)
+	}
+	header += ":"
+	if stopped != "" {
+		header += "\n" + stopped
+	}
+	if len(lines) == 0 {
+		return header + "\nNo lines found", nil
+	}
+	return header + "\n" + strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,171 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxTodos = 500 // Limit markers returned by FindTodos
+
+// defaultTodoMarkers are searched when no markers are given
+var defaultTodoMarkers = []string{"TODO", "FIXME", "XXX", "HACK"}
+
+// todo is a single marker occurrence
+type todo struct {
+	path   string
+	line   int
+	author string
+	text   string
+}
+
+// FindTodos searches files matching pattern for TODO-style markers and groups them by marker and file
+func (h *Handler) FindTodos(ctx context.Context, pattern string, markers []string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if len(markers) == 0 {
+		markers = defaultTodoMarkers
+	}
+	quoted := make([]string, len(markers))
+	for i, marker := range markers {
+		if err := h.checkGrepPattern(marker); err != nil {
+			return "", err
+		}
+		quoted[i] = regexp.QuoteMeta(marker)
+	}
+	// Matches MARKER, MARKER: and MARKER(author): forms, but not identifiers like context.TODO()
+	re, err := regexp.Compile(`(?:^|[^.\w])(` + strings.Join(quoted, "|") + `)(?:\(([^)]+)\))?(?::|\s|$)\s*(.*)`)
+	if err != nil {
+		return "", fmt.Errorf("invalid markers: %w", err)
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	pattern, err = h.resolvePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	matches, note, err := h.globPaths(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid path pattern: %w", err)
+	}
+
+	if len(matches) == 0 {
+		return h.noMatch(ctx, pattern) + globNote(note), nil
+	}
+
+	byMarker := make(map[string][]todo)
+	var skipped []skippedFile
+	total := 0
+	truncated := false
+
+	for _, path := range matches {
+		if truncated {
+			break
+		}
+
+		// Check context periodically
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		if !h.withinRoots(path) {
+			skipped = append(skipped, skippedFile{path, "outside allowed roots"})
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		if err := h.checkExtension(path); err != nil {
+			skipped = append(skipped, skippedFile{path, "forbidden by server policy"})
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+			continue
+		}
+
+		scanner := bufio.NewScanner(file)
+		// Increase buffer size to handle long lines (1MB max token)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			m := re.FindStringSubmatch(scanner.Text())
+			if m == nil {
+				continue
+			}
+			if total >= maxTodos {
+				truncated = true
+				break
+			}
+			byMarker[m[1]] = append(byMarker[m[1]], todo{
+				path:   path,
+				line:   lineNum,
+				author: strings.TrimSpace(m[2]),
+				text:   strings.TrimSpace(m[3]),
+			})
+			total++
+		}
+
+		if err := scanner.Err(); err != nil {
+			skipped = append(skipped, skippedFile{path, skipReason(err)})
+		}
+		_ = file.Close()
+	}
+
+	if total == 0 {
+		return "No markers found" + skippedNote(skipped) + globNote(note), nil
+	}
+
+	var results []string
+	results = append(results, fmt.Sprintf("Found %d markers", total))
+	for _, marker := range markers {
+		todos := byMarker[marker]
+		if len(todos) == 0 {
+			continue
+		}
+		results = append(results, fmt.Sprintf("\n%s (%d):", marker, len(todos)))
+
+		sort.SliceStable(todos, func(i, j int) bool { return todos[i].path < todos[j].path })
+		lastPath := ""
+		for _, t := range todos {
+			if t.path != lastPath {
+				results = append(results, fmt.Sprintf("  %s:", t.path))
+				lastPath = t.path
+			}
+			line := fmt.Sprintf("    %d:", t.line)
+			if t.text != "" {
+				line += " " + t.text
+			}
+			if t.author != "" {
+				line += fmt.Sprintf(" [author: %s]", t.author)
+			}
+			results = append(results, line)
+		}
+	}
+
+	if truncated {
+		results = append(results, "\n"+truncate.Marker(fmt.Sprintf("stopped after %d markers", maxTodos), "any further markers", "Narrow the pattern."))
+	}
+
+	return strings.Join(results, "\n") + skippedNote(skipped) + globNote(note), nil
+}
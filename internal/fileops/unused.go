@@ -0,0 +1,262 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+)
+
+const maxUnusedSymbols = 200 // Limit symbols listed by UnusedSymbols
+
+// exportedSymbol is an exported declaration checked for references
+type exportedSymbol struct {
+	name   string // Name, or Type.Method for methods
+	ident  string // bare identifier
+	kind   string
+	method bool
+	pos    token.Position
+}
+
+// UnusedSymbols lists exported symbols of the Go package in dir that nothing
+// references, searching the package itself and every .go file under scope.
+// Identifiers are matched by name without type information, so the result is
+// best-effort: reflection, build tags, interface satisfaction and code outside
+// scope are not considered.
+func (h *Handler) UnusedSymbols(ctx context.Context, dir, scope string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	resolved, err := h.resolvePath(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat path: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory: unused_symbols takes a package directory", dir)
+	}
+
+	fset, pkgFiles, err := h.parseGoPath(ctx, resolved, true, 0)
+	if err != nil {
+		return "", err
+	}
+	pkgName := ""
+	for _, f := range pkgFiles {
+		if !strings.HasSuffix(f.path, "_test.go") {
+			pkgName = f.ast.Name.Name
+			break
+		}
+	}
+	if pkgName == "" {
+		return "", fmt.Errorf("no non-test Go files in %s", dir)
+	}
+
+	// Collect the package's exported declarations
+	var symbols []exportedSymbol
+	declared := make(map[*ast.Ident]bool)
+	add := func(ident *ast.Ident, name, kind string, method bool) {
+		if !ident.IsExported() {
+			return
+		}
+		declared[ident] = true
+		symbols = append(symbols, exportedSymbol{name: name, ident: ident.Name, kind: kind, method: method, pos: fset.Position(ident.Pos())})
+	}
+	for _, f := range pkgFiles {
+		if f.ast.Name.Name != pkgName || strings.HasSuffix(f.path, "_test.go") {
+			continue
+		}
+		for _, decl := range f.ast.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					add(d.Name, d.Name.Name, "func", false)
+				} else if recv := receiverType(d.Recv.List[0].Type); ast.IsExported(recv) {
+					add(d.Name, funcName(d), "method", true)
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch sp := spec.(type) {
+					case *ast.TypeSpec:
+						add(sp.Name, sp.Name.Name, "type", false)
+					case *ast.ValueSpec:
+						for _, ident := range sp.Names {
+							add(ident, ident.Name, d.Tok.String(), false)
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(symbols) == 0 {
+		return fmt.Sprintf("package %s (%s) declares no exported symbols", pkgName, resolved), nil
+	}
+
+	// Identifiers used inside the package, including its in-package tests
+	used := make(map[string]bool)
+	for _, f := range pkgFiles {
+		if f.ast.Name.Name != pkgName {
+			continue
+		}
+		ast.Inspect(f.ast, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && !declared[ident] {
+				used[ident.Name] = true
+			}
+			return true
+		})
+	}
+
+	// Qualified references from dependents under scope, plus any selector for methods
+	_, treeFiles, err := h.parseGoTree(ctx, scope, true, 0)
+	if err != nil {
+		return "", err
+	}
+	importPath := h.importPath(resolved)
+	external := make(map[string]bool)  // Name referenced as pkg.Name
+	selectors := make(map[string]bool) // any x.Name, for methods
+	dependents := 0
+	seen := make(map[string]bool)
+	for _, f := range append(treeFiles, pkgFiles...) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		inPackage := filepath.Dir(f.path) == resolved && f.ast.Name.Name == pkgName
+		if inPackage || seen[f.path] {
+			continue
+		}
+		seen[f.path] = true
+		local, dot := packageImportName(f.ast, importPath, resolved, pkgName)
+		if local != "" || dot {
+			dependents++
+		}
+		ast.Inspect(f.ast, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.SelectorExpr:
+				selectors[x.Sel.Name] = true
+				if id, ok := x.X.(*ast.Ident); ok && local != "" && id.Name == local {
+					external[x.Sel.Name] = true
+				}
+			case *ast.Ident:
+				if dot {
+					external[x.Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	var unused []exportedSymbol
+	for _, sym := range symbols {
+		if used[sym.ident] || external[sym.ident] || (sym.method && selectors[sym.ident]) {
+			continue
+		}
+		unused = append(unused, sym)
+	}
+	if len(unused) == 0 {
+		return fmt.Sprintf("All %d exported symbols of package %s are referenced (%d dependent files found)", len(symbols), pkgName, dependents), nil
+	}
+
+	sort.SliceStable(unused, func(i, j int) bool {
+		if unused[i].pos.Filename != unused[j].pos.Filename {
+			return unused[i].pos.Filename < unused[j].pos.Filename
+		}
+		return unused[i].pos.Line < unused[j].pos.Line
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Likely unused exported symbols in package %s (%s): %d of %d, checked against %d dependent files\n", pkgName, resolved, len(unused), len(symbols), dependents)
+	b.WriteString("Likely unused, not definitively: reflection, build tags, interface satisfaction and code outside the searched tree are not considered.\n\n")
+	for i, sym := range unused {
+		if i >= maxUnusedSymbols {
+			fmt.Fprintf(&b, "\n%s\n", truncate.Marker(fmt.Sprintf("showing %d of %d symbols", maxUnusedSymbols, len(unused)), fmt.Sprintf("%d symbols", len(unused)-maxUnusedSymbols), "Narrow the package."))
+			break
+		}
+		fmt.Fprintf(&b, "- %s %s (%s:%d)\n", sym.kind, sym.name, sym.pos.Filename, sym.pos.Line)
+	}
+	if pkgName == "main" {
+		b.WriteString("\nNote: package main can't be imported, so only its own references count.\n")
+	}
+	return b.String(), nil
+}
+
+// importPath returns the import path of the package in dir from the nearest
+// go.mod within the allowed roots, or "" when there is none
+func (h *Handler) importPath(dir string) string {
+	for d := dir; h.withinRoots(d); d = filepath.Dir(d) {
+		if module := modulePath(filepath.Join(d, "go.mod")); module != "" {
+			rel, err := filepath.Rel(d, dir)
+			if err != nil {
+				return ""
+			}
+			if rel == "." {
+				return module
+			}
+			return module + "/" + filepath.ToSlash(rel)
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return ""
+}
+
+// modulePath reads the module path from a go.mod file, or "" if it can't be read
+func modulePath(gomod string) string {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module "); ok {
+			if module, err := strconv.Unquote(strings.TrimSpace(rest)); err == nil {
+				return module
+			}
+			return strings.TrimSpace(rest)
+		}
+	}
+	return ""
+}
+
+// packageImportName returns the name a file refers to the package by, and whether it
+// dot-imports it. Without an import path, imports are matched by the
+// directory's base name.
+func packageImportName(f *ast.File, importPath, dir, pkgName string) (string, bool) {
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if importPath != "" && path != importPath {
+			continue
+		}
+		if importPath == "" && path != filepath.Base(dir) && !strings.HasSuffix(path, "/"+filepath.Base(dir)) {
+			continue
+		}
+		if spec.Name != nil {
+			switch spec.Name.Name {
+			case ".":
+				return "", true
+			case "_":
+				return "", false
+			}
+			return spec.Name.Name, false
+		}
+		return pkgName, false
+	}
+	return "", false
+}
@@ -0,0 +1,225 @@
+package fileops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	vulnCheckTimeout = 3 * time.Minute  // govulncheck downloads the vulnerability database
+	maxVulnOutput    = 16 * 1024 * 1024 // 16MB of JSON
+)
+
+// vulnEntry is the part of an OSV vulnerability entry reported in findings
+type vulnEntry struct {
+	ID      string   `json:"id"`
+	Summary string   `json:"summary"`
+	Aliases []string `json:"aliases"`
+}
+
+// vulnMessage is one message in govulncheck's -json output stream
+type vulnMessage struct {
+	OSV     *vulnEntry `json:"osv"`
+	Finding *struct {
+		OSV          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+		Trace        []struct {
+			Module   string `json:"module"`
+			Version  string `json:"version"`
+			Package  string `json:"package"`
+			Function string `json:"function"`
+			Receiver string `json:"receiver"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// vulnFinding aggregates govulncheck findings for one vulnerability
+type vulnFinding struct {
+	id       string
+	summary  string
+	aliases  []string
+	module   string
+	version  string
+	fixed    string
+	packages map[string]bool
+	symbols  map[string]bool
+}
+
+// CheckVulns runs govulncheck on the Go module in dir and reports known
+// vulnerabilities in its dependencies, most reachable first. govulncheck
+// must be on the command allowlist.
+func (h *Handler) CheckVulns(ctx context.Context, dir string) (string, error) {
+	// Check context before starting
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !h.allowedCommands["govulncheck"] {
+		return "", fmt.Errorf("check_vulns requires govulncheck in -allowed-commands")
+	}
+
+	// Expand ~ to home directory and enforce allowed roots
+	dir, err := h.resolvePath(h.defaultDir(dir))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+		return "", fmt.Errorf("no go.mod in %s: point check_vulns at a module root", dir)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, vulnCheckTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "govulncheck", "-json", "./...")
+	cmd.Dir = dir
+	stdout := &cappedBuffer{limit: maxVulnOutput}
+	stderr := &cappedBuffer{limit: maxCommandOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			return "", fmt.Errorf("govulncheck timed out after %s", vulnCheckTimeout)
+		case errors.Is(err, exec.ErrNotFound):
+			return "", fmt.Errorf("govulncheck is not installed: go install golang.org/x/vuln/cmd/govulncheck@latest")
+		case errors.As(err, &exitErr):
+			return "", fmt.Errorf("govulncheck failed (exit code %d): %s", exitErr.ExitCode(), strings.TrimSpace(stderr.buf.String()))
+		default:
+			return "", fmt.Errorf("failed to run govulncheck: %w", err)
+		}
+	}
+	if stdout.truncated {
+		return "", fmt.Errorf("govulncheck output exceeded %d bytes", maxVulnOutput)
+	}
+
+	findings, err := parseVulnOutput(stdout.buf.String())
+	if err != nil {
+		return "", err
+	}
+	if len(findings) == 0 {
+		return fmt.Sprintf("No known vulnerabilities found in %s", dir), nil
+	}
+	return formatVulns(dir, findings), nil
+}
+
+// parseVulnOutput groups govulncheck's JSON message stream by vulnerability
+func parseVulnOutput(output string) ([]*vulnFinding, error) {
+	entries := make(map[string]*vulnEntry)
+	byID := make(map[string]*vulnFinding)
+
+	dec := json.NewDecoder(strings.NewReader(output))
+	for {
+		var msg vulnMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse govulncheck output: %w", err)
+		}
+		if msg.OSV != nil {
+			entries[msg.OSV.ID] = msg.OSV
+		}
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+
+		f := byID[msg.Finding.OSV]
+		if f == nil {
+			f = &vulnFinding{id: msg.Finding.OSV, packages: map[string]bool{}, symbols: map[string]bool{}}
+			byID[f.id] = f
+		}
+		// The first trace frame is the vulnerable module, package and symbol
+		frame := msg.Finding.Trace[0]
+		f.module, f.version, f.fixed = frame.Module, frame.Version, msg.Finding.FixedVersion
+		if frame.Package != "" {
+			f.packages[frame.Package] = true
+		}
+		if frame.Function != "" {
+			symbol := frame.Function
+			if frame.Receiver != "" {
+				symbol = strings.TrimPrefix(frame.Receiver, "*") + "." + symbol
+			}
+			f.symbols[symbol] = true
+		}
+	}
+
+	findings := make([]*vulnFinding, 0, len(byID))
+	for id, f := range byID {
+		if entry := entries[id]; entry != nil {
+			f.summary, f.aliases = entry.Summary, entry.Aliases
+		}
+		findings = append(findings, f)
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if a, b := vulnLevel(findings[i]), vulnLevel(findings[j]); a != b {
+			return a > b
+		}
+		return findings[i].id < findings[j].id
+	})
+	return findings, nil
+}
+
+// vulnLevel ranks how directly a vulnerability affects the module: 2 when
+// vulnerable symbols are called, 1 when the package is imported, 0 when the
+// module is only required
+func vulnLevel(f *vulnFinding) int {
+	switch {
+	case len(f.symbols) > 0:
+		return 2
+	case len(f.packages) > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// formatVulns renders findings as a report
+func formatVulns(dir string, findings []*vulnFinding) string {
+	levels := []string{"module required, vulnerable code not imported", "package imported, vulnerable code not called", "vulnerable code is called"}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d known vulnerabilities in %s\n", len(findings), dir)
+	for _, f := range findings {
+		fmt.Fprintf(&b, "\n%s", f.id)
+		if len(f.aliases) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(f.aliases, ", "))
+		}
+		if f.summary != "" {
+			fmt.Fprintf(&b, ": %s", f.summary)
+		}
+		fmt.Fprintf(&b, "\n  Module: %s@%s\n", f.module, f.version)
+		if f.fixed != "" {
+			fmt.Fprintf(&b, "  Fixed in: %s\n", f.fixed)
+		} else {
+			b.WriteString("  Fixed in: no fix available\n")
+		}
+		if len(f.packages) > 0 {
+			fmt.Fprintf(&b, "  Packages: %s\n", strings.Join(sortedKeys(f.packages), ", "))
+		}
+		if len(f.symbols) > 0 {
+			fmt.Fprintf(&b, "  Symbols: %s\n", strings.Join(sortedKeys(f.symbols), ", "))
+		}
+		fmt.Fprintf(&b, "  Impact: %s\n", levels[vulnLevel(f)])
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,108 @@
+// Package logging adds levels to the standard logger. Plain log.Printf calls
+// are info level; Debugf, Warnf and Errorf log at their own levels.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a logging threshold
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var (
+	level   atomic.Int32
+	leveled = log.New(os.Stderr, "", log.LstdFlags) // logs warnings and errors past the info filter
+)
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (must be debug, info, warn or error)", name)
+	}
+}
+
+// SetLevel sets the minimum level that is logged
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// Debugf logs a message at debug level, for per-item detail that would flood production logs
+func Debugf(format string, args ...any) {
+	if Level(level.Load()) <= LevelDebug {
+		_ = log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
+
+// Warnf logs a message at warn level, prefixed with WARNING:
+func Warnf(format string, args ...any) {
+	if Level(level.Load()) <= LevelWarn {
+		_ = leveled.Output(2, "WARNING: "+fmt.Sprintf(format, args...))
+	}
+}
+
+// Errorf logs a message at error level, prefixed with ERROR:
+func Errorf(format string, args ...any) {
+	if Level(level.Load()) <= LevelError {
+		_ = leveled.Output(2, "ERROR: "+fmt.Sprintf(format, args...))
+	}
+}
+
+// Fatal logs a message at every level and exits, like log.Fatal
+func Fatal(args ...any) {
+	_ = leveled.Output(2, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+// Fatalf logs a message at every level and exits, like log.Fatalf
+func Fatalf(format string, args ...any) {
+	_ = leveled.Output(2, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// SetOutput sends log output to w. Messages logged through the standard
+// logger (log.Printf and Debugf) are info or debug level and are dropped when
+// the level is above info; Warnf, Errorf and the Fatal functions write to w
+// with the standard logger's prefix and flags, checking their own level.
+func SetOutput(w io.Writer) {
+	log.SetOutput(&levelWriter{w: w})
+	leveled.SetOutput(w)
+	leveled.SetPrefix(log.Prefix())
+	leveled.SetFlags(log.Flags())
+}
+
+// levelWriter drops the standard logger's output above info level
+type levelWriter struct {
+	w io.Writer
+}
+
+func (lw *levelWriter) Write(p []byte) (int, error) {
+	if Level(level.Load()) > LevelInfo {
+		return len(p), nil
+	}
+	return lw.w.Write(p)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/lox/deep-analysis-mcp/internal/truncate"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	footerSeparator = "\n\n---\n" // starts the usage and elapsed-time footers appended to answers
+	maxFooterBytes  = 1024        // footers longer than this are treated as prose
+)
+
+// truncationHint follows the marker replacing the end of prose cut to fit the result size limit
+const truncationHint = "Narrow the question or split it into smaller requests for the full answer."
+
+// limitResult truncates the prose of a tool result so the result fits in
+// maxBytes. The prose is the first text content; any footers at its end,
+// later content blocks and structured content are kept intact. The result is
+// copied rather than modified, since stored job results are shared.
+func limitResult(result *mcp.CallToolResult, maxBytes int, tool string) *mcp.CallToolResult {
+	if maxBytes <= 0 || result == nil || len(result.Content) == 0 {
+		return result
+	}
+	prose, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		return result
+	}
+
+	size := resultSize(result)
+	if size <= maxBytes {
+		return result
+	}
+
+	// Keep the trailing footers, taking the earliest separator that still leaves a short tail
+	text := prose.Text
+	tailStart := len(text)
+	for {
+		i := strings.LastIndex(text[:tailStart], footerSeparator)
+		if i < 0 || len(text)-i > maxFooterBytes {
+			break
+		}
+		tailStart = i
+	}
+	body, tail := text[:tailStart], text[tailStart:]
+
+	// Reserve room for a marker counting the whole body as omitted, which is never shorter than the real one
+	reason := fmt.Sprintf("result limit of %d bytes", maxBytes)
+	reserve := len("\n\n" + truncate.Marker(reason, fmt.Sprintf("%d bytes", len(body)), truncationHint))
+	keep := max(len(body)-(size-maxBytes)-reserve, 0)
+	for keep > 0 && !utf8.RuneStart(body[keep]) {
+		keep--
+	}
+	prose.Text = body[:keep] + "\n\n" + truncate.Marker(reason, fmt.Sprintf("%d bytes", len(body)-keep), truncationHint) + tail
+
+	limited := *result
+	limited.Content = append([]mcp.Content{prose}, result.Content[1:]...)
+	logging.Warnf("Result truncated to fit -max-result-bytes: tool=%s size=%d limit=%d (narrow the query for a complete answer)", tool, size, maxBytes)
+	return &limited
+}
+
+// resultSize returns the bytes of text and structured content in a result
+func resultSize(result *mcp.CallToolResult) int {
+	size := 0
+	for _, content := range result.Content {
+		if tc, ok := content.(mcp.TextContent); ok {
+			size += len(tc.Text)
+		}
+	}
+	if result.StructuredContent != nil {
+		if raw, err := json.Marshal(result.StructuredContent); err == nil {
+			size += len(raw)
+		}
+	}
+	return size
+}
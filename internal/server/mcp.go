@@ -10,15 +10,55 @@ import (
 // ToolHandler defines the interface for handling tool requests
 type ToolHandler interface {
 	Handle(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleResult(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleSummarize(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleDescribe(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleReviewDiff(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleMinimalRepro(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleExtractTasks(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleAnalyzeLog(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleAnalyzeStackTrace(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleConfirmAction(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
 }
 
-// New creates and configures a new MCP server with the deep-analysis tool
-func New(handler ToolHandler) *server.MCPServer {
+// transportKey is the context key for the transport a tool request arrived on
+type transportKey struct{}
+
+// TransportFromContext returns the transport a tool request arrived on, or "" if unknown
+func TransportFromContext(ctx context.Context) string {
+	transport, _ := ctx.Value(transportKey{}).(string)
+	return transport
+}
+
+// ClientFromContext identifies the client a tool request came from: its
+// transport and MCP session ID, or only the transport outside a session.
+// Unlike a conversation ID, it can't be chosen by the caller.
+func ClientFromContext(ctx context.Context) string {
+	client := TransportFromContext(ctx)
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		client += ":" + session.SessionID()
+	}
+	return client
+}
+
+// New creates and configures a new MCP server with the deep-analysis tool.
+// Tool requests carry the transport name, available via TransportFromContext.
+// Results larger than maxResultBytes have their prose truncated; 0 means unlimited.
+func New(handler ToolHandler, transport string, maxResultBytes int) *server.MCPServer {
 	s := server.NewMCPServer(
 		"Deep Analysis MCP",
 		"1.0.0",
 		server.WithToolCapabilities(false),
 		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+			return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				result, err := next(context.WithValue(ctx, transportKey{}, transport), request)
+				if err != nil {
+					return result, err
+				}
+				return limitResult(result, maxResultBytes, request.Params.Name), nil
+			}
+		}),
 	)
 
 	deepAnalysisTool := mcp.NewTool("deep-analysis",
@@ -34,15 +74,213 @@ func New(handler ToolHandler) *server.MCPServer {
 			mcp.Description("Optional list of file paths to attach. These files will be automatically read and included in the analysis."),
 			mcp.WithStringItems(),
 		),
+		mcp.WithArray("focus_files",
+			mcp.Description("Optional list of file paths or glob patterns the analysis should investigate first. Unlike files, they aren't attached up front; the model reads them on demand, saving tokens. Paths that match no file are reported in a warning."),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("changed_files",
+			mcp.Description("Optional list of files that changed since the last analysis in this conversation. They are attached and the model is asked to update its previous conclusions incrementally instead of starting over. Requires an existing conversation."),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("prior_findings",
+			mcp.Description("Optional findings from an earlier session to build on, as inline text or a path to a file containing them. Included in the prompt under \"Previous Findings\"."),
+		),
+		mcp.WithArray("docs",
+			mcp.Description("Optional reference documentation for libraries or APIs the analysis depends on, as file paths or, if the server allows it, http(s) URLs. Included in the prompt under \"Reference Documentation\", separate from the code, and dropped before attached files if the prompt is too large."),
+			mcp.WithStringItems(),
+		),
 		mcp.WithString("conversation_id",
 			mcp.Description("Identifier to continue a specific conversation; omit to start fresh"),
 		),
 		mcp.WithBoolean("continue",
 			mcp.Description("Continue previous conversation (true) or start fresh (false). Default: true"),
 		),
+		mcp.WithBoolean("ephemeral",
+			mcp.Description("Run a one-off side question: the turn may continue from the stored conversation but leaves it unchanged, so the next call continues from the same point. Default: false"),
+		),
+		mcp.WithBoolean("emit_plan",
+			mcp.Description("Start the answer with a short numbered investigation plan before the findings. Default: false"),
+		),
+		mcp.WithBoolean("pause_for_approval",
+			mcp.Description("Return only the investigation plan, without running any tools, and wait for approval. Proceed by calling again with continue=true in the same conversation; the task can approve or adjust the plan. Default: false"),
+		),
+		mcp.WithString("language",
+			mcp.Description("Optional BCP-47 language code (e.g. \"de\", \"pt-BR\") to write the answer in. Code, identifiers and paths stay unchanged. Default: English"),
+		),
+		mcp.WithArray("compare_models",
+			mcp.Description("Optional list of 2-3 models to run the same analysis against for a second opinion, returning their answers side by side with token usage per model. Only models the server allows may be chosen. The conversation isn't updated unless compare_synthesis is set."),
+			mcp.WithStringItems(),
+		),
+		mcp.WithBoolean("compare_synthesis",
+			mcp.Description("With compare_models, add a final call that reconciles the models' answers, stored as the conversation's turn. Default: false"),
+		),
+		mcp.WithNumber("reasoning_token_budget",
+			mcp.Description("Optional cap on output tokens (including reasoning) spent on this request. When reached, the best partial answer is returned with a note. Default: server setting"),
+			mcp.Min(0),
+		),
+		mcp.WithBoolean("extract_structured",
+			mcp.Description("Also return a machine-readable summary (findings, severity, recommendations) extracted by a secondary model call. Default: false"),
+		),
+		mcp.WithBoolean("confidence_annotations",
+			mcp.Description("Also return structured findings where each carries a confidence level (low, medium, high) and the file:line evidence supporting it, with evidence that doesn't resolve flagged. Supersedes extract_structured. Default: false"),
+		),
+		mcp.WithBoolean("async",
+			mcp.Description("Run the analysis in the background and return a job ID immediately; poll with get_analysis_result. Default: false"),
+		),
 	)
 
 	s.AddTool(deepAnalysisTool, handler.Handle)
 
+	resultTool := mcp.NewTool("get_analysis_result",
+		mcp.WithDescription("Get the status or result of a background deep-analysis started with async=true. Returns partial results while the analysis is still running."),
+		mcp.WithString("job_id",
+			mcp.Required(),
+			mcp.Description("Job ID returned when the background analysis was started"),
+		),
+	)
+
+	s.AddTool(resultTool, handler.HandleResult)
+
+	summarizeTool := mcp.NewTool("summarize_directory",
+		mcp.WithDescription("Produce a structural summary of a module or package: its responsibilities, key types, and how the files fit together. Source files are read automatically (up to 50 files / 1MB) and analyzed in a single pass."),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Directory to summarize"),
+		),
+		mcp.WithString("pattern",
+			mcp.Description("Optional glob pattern, relative to path, selecting files to include. Default: common source and markdown files, recursively"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional identifier to store the summary under, so later deep-analysis calls can continue from it"),
+		),
+	)
+
+	s.AddTool(summarizeTool, handler.HandleSummarize)
+
+	describeTool := mcp.NewTool("describe_conversation",
+		mcp.WithDescription("Report metadata about a conversation's server-side state: turns, current response ID, cumulative tokens, model and settings, and last-used time. Does not return conversation content."),
+		mcp.WithString("conversation_id",
+			mcp.Description("Conversation to describe. Default: the default conversation"),
+		),
+	)
+
+	s.AddTool(describeTool, handler.HandleDescribe)
+
+	reviewTool := mcp.NewTool("review_diff",
+		mcp.WithDescription("Code-review a unified diff (e.g. a PR from git diff). Changed files and hunks are identified from the diff, the current files are attached for context, and findings are reported against file and line."),
+		mcp.WithString("diff",
+			mcp.Description("Unified diff to review, inline. Provide this or diff_path"),
+		),
+		mcp.WithString("diff_path",
+			mcp.Description("Path to a file containing the unified diff. Provide this or diff"),
+		),
+		mcp.WithBoolean("include_files",
+			mcp.Description("Attach the full current contents of changed files for context. Default: true"),
+		),
+		mcp.WithBoolean("per_file",
+			mcp.Description("For large diffs: review each changed file separately (intent, risk and findings), then give an overall assessment, and return the review as structured JSON with one entry per file for CI comments. Default: false"),
+		),
+		mcp.WithNumber("max_files",
+			mcp.Description("With per_file, the number of changed files reviewed individually; the rest are covered only in the overall assessment. Default: 50"),
+		),
+		mcp.WithString("context",
+			mcp.Description("Optional background for the reviewer, such as the PR description or what the change is meant to do"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional identifier to store the review under, so later deep-analysis calls can follow up on it"),
+		),
+	)
+
+	s.AddTool(reviewTool, handler.HandleReviewDiff)
+
+	reproTool := mcp.NewTool("minimal_repro",
+		mcp.WithDescription("Turn a bug report into a minimal, self-contained reproduction. The AI investigates the code, then returns the files to create and commands to run, as prose plus structured JSON."),
+		mcp.WithString("bug_report",
+			mcp.Required(),
+			mcp.Description("The bug report: symptoms, error messages, steps taken, and environment"),
+		),
+		mcp.WithArray("files",
+			mcp.Description("Optional list of relevant file paths to attach"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("context",
+			mcp.Description("Optional background, such as what has already been ruled out"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional identifier to store the result under, so later deep-analysis calls can follow up on it"),
+		),
+	)
+
+	s.AddTool(reproTool, handler.HandleMinimalRepro)
+
+	tasksTool := mcp.NewTool("extract_tasks",
+		mcp.WithDescription("Break a design document into an ordered list of concrete implementation tasks with dependencies and rough effort estimates. The AI reads the code the design affects, then returns the plan as prose plus structured JSON."),
+		mcp.WithString("doc_path",
+			mcp.Required(),
+			mcp.Description("Path to the design document (Markdown or plain text)"),
+		),
+		mcp.WithArray("files",
+			mcp.Description("Optional list of relevant file paths to attach, such as the code the design changes"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("context",
+			mcp.Description("Optional background, such as team size, deadlines or parts already built"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional identifier to store the result under, so later deep-analysis calls can follow up on it"),
+		),
+	)
+
+	s.AddTool(tasksTool, handler.HandleExtractTasks)
+
+	logTool := mcp.NewTool("analyze_log",
+		mcp.WithDescription("Tail a log file of any size, optionally filtering it, and analyze the errors: what they are, how often they occur, and their likely root causes."),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the log file. It is read backwards from the end, so multi-gigabyte logs are fine"),
+		),
+		mcp.WithNumber("lines",
+			mcp.Description("Number of lines to take from the end of the log (max 10000). Default: 500"),
+			mcp.Min(0),
+		),
+		mcp.WithString("pattern",
+			mcp.Description("Optional regular expression; only the last matching lines are included (e.g. 'ERROR|WARN')"),
+		),
+		mcp.WithString("question",
+			mcp.Description("Optional specific question about the log, such as a symptom to explain"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional identifier to store the result under, so later deep-analysis calls can follow up on it"),
+		),
+	)
+
+	s.AddTool(logTool, handler.HandleAnalyzeLog)
+
+	stackTraceTool := mcp.NewTool("analyze_stacktrace",
+		mcp.WithDescription("Analyze a pasted Go, Python or JavaScript stack trace: its frames are parsed, the source around each is read and attached, and the AI identifies the likely failure point with supporting code."),
+		mcp.WithString("stack_trace",
+			mcp.Required(),
+			mcp.Description("The stack trace, panic or traceback, pasted as-is"),
+		),
+		mcp.WithString("context",
+			mcp.Description("Optional background, such as what triggered the failure or the error message logged alongside it"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional identifier to store the result under, so later deep-analysis calls can follow up on it"),
+		),
+	)
+
+	s.AddTool(stackTraceTool, handler.HandleAnalyzeStackTrace)
+
+	confirmTool := mcp.NewTool("confirm_action",
+		mcp.WithDescription("Approve and run a command the analysis wanted to run, held for human approval because the server requires confirmation. Returns the command's output. Only call this when the user has approved the action."),
+		mcp.WithString("action_id",
+			mcp.Required(),
+			mcp.Description("Action ID reported by the analysis for the held command"),
+		),
+	)
+
+	s.AddTool(confirmTool, handler.HandleConfirmAction)
+
 	return s
 }
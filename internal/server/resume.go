@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lox/deep-analysis-mcp/internal/logging"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const maxBufferedEvents = 1000 // Limit events kept per session for resumption
+
+// ResumableSSE serves an SSE server so that its sessions survive dropped
+// connections. Each session's stream runs detached from the client connection
+// and every event is buffered with an ID; a client that reconnects with the
+// Last-Event-ID header gets the events it missed, such as a final analysis
+// result, and then the live stream, instead of a new session. Sessions with no
+// connected client are closed after ttl, and buffered events expire after ttl.
+type ResumableSSE struct {
+	sse     *server.SSEServer
+	ssePath string
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*sseStream // keyed by stream ID, the prefix of event IDs
+}
+
+// NewResumableSSE wraps sse, which must use a static base path, with resumable sessions
+func NewResumableSSE(sse *server.SSEServer, ttl time.Duration) *ResumableSSE {
+	return &ResumableSSE{
+		sse:      sse,
+		ssePath:  sse.CompleteSsePath(),
+		ttl:      ttl,
+		sessions: make(map[string]*sseStream),
+	}
+}
+
+// sseEvent is one buffered event of a stream
+type sseEvent struct {
+	seq  uint64
+	text string // event fields without the id line or the blank line ending it
+	ping bool   // keep-alive ping, not replayed on resumption
+	at   time.Time
+}
+
+// sseStream buffers the events of one SSE session. It is the ResponseWriter
+// the underlying SSE handler writes to, independent of any client connection.
+type sseStream struct {
+	id     string
+	ttl    time.Duration
+	cancel context.CancelFunc
+	header http.Header
+
+	mu       sync.Mutex
+	events   []sseEvent
+	seq      uint64
+	partial  string        // written text not yet ending in a blank line
+	changed  chan struct{} // closed and replaced when an event arrives or the stream ends
+	ended    bool
+	clients  int
+	detaches int // counts disconnects so a stale expiry timer can tell it was superseded
+}
+
+// ServeHTTP serves SSE connections with resumption and passes other requests,
+// such as posted messages, to the SSE server
+func (rs *ResumableSSE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != rs.ssePath || r.Method != http.MethodGet {
+		rs.sse.ServeHTTP(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, cursor := rs.resume(r.Header.Get("Last-Event-ID"))
+	if stream == nil {
+		var err error
+		if stream, err = rs.start(r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	stream.attach()
+	defer stream.detach(rs.remove)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Pings buffered while the client was away are stale, so the replay skips them
+	replay := true
+	for {
+		events, changed, ended := stream.since(cursor)
+		for _, e := range events {
+			cursor = e.seq
+			if replay && e.ping {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s:%d\n%s\n\n", stream.id, e.seq, e.text); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		replay = false
+		if ended {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// resume finds the stream a Last-Event-ID belongs to and the sequence number
+// to continue after, or returns nil to start a new session
+func (rs *ResumableSSE) resume(lastEventID string) (*sseStream, uint64) {
+	if lastEventID == "" {
+		return nil, 0
+	}
+	id, seqText, ok := strings.Cut(lastEventID, ":")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if !ok || err != nil {
+		logging.Warnf("Ignoring malformed Last-Event-ID %q; starting a new SSE session", lastEventID)
+		return nil, 0
+	}
+
+	rs.mu.Lock()
+	stream := rs.sessions[id]
+	rs.mu.Unlock()
+	if stream == nil {
+		logging.Warnf("SSE session %s expired or is unknown; starting a new session (the client must initialize again)", id)
+		return nil, 0
+	}
+
+	stream.mu.Lock()
+	oldest := stream.seq + 1
+	if len(stream.events) > 0 {
+		oldest = stream.events[0].seq
+	}
+	stream.mu.Unlock()
+	if seq+1 < oldest {
+		logging.Warnf("SSE session %s resumed after event %d, but events before %d have expired", id, seq, oldest)
+	}
+	log.Printf("Resuming SSE session %s after event %d", id, seq)
+	return stream, seq
+}
+
+// start runs a new session of the SSE server in the background, detached from
+// the client's connection so it outlives disconnects
+func (rs *ResumableSSE) start(r *http.Request) (*sseStream, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return nil, fmt.Errorf("failed to create SSE session: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	stream := &sseStream{
+		id:      hex.EncodeToString(raw[:]),
+		ttl:     rs.ttl,
+		cancel:  cancel,
+		header:  make(http.Header),
+		changed: make(chan struct{}),
+	}
+
+	rs.mu.Lock()
+	rs.sessions[stream.id] = stream
+	rs.mu.Unlock()
+
+	upstream := r.Clone(ctx)
+	upstream.Header.Del("Last-Event-ID")
+	go func() {
+		rs.sse.ServeHTTP(stream, upstream)
+		stream.end()
+		rs.remove(stream)
+		logging.Debugf("SSE session %s closed", stream.id)
+	}()
+	logging.Debugf("SSE session %s started (resumable for %s after a disconnect)", stream.id, rs.ttl)
+	return stream, nil
+}
+
+// remove forgets a stream so it can no longer be resumed
+func (rs *ResumableSSE) remove(stream *sseStream) {
+	rs.mu.Lock()
+	if rs.sessions[stream.id] == stream {
+		delete(rs.sessions, stream.id)
+	}
+	rs.mu.Unlock()
+}
+
+// Header implements http.ResponseWriter
+func (s *sseStream) Header() http.Header {
+	return s.header
+}
+
+// WriteHeader implements http.ResponseWriter; the client connection writes its own status
+func (s *sseStream) WriteHeader(int) {}
+
+// Flush implements http.Flusher; events are delivered as soon as they're complete
+func (s *sseStream) Flush() {}
+
+// Write buffers the complete events in p and wakes connected clients
+func (s *sseStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partial += strings.ReplaceAll(string(p), "\r\n", "\n")
+	added := false
+	for {
+		i := strings.Index(s.partial, "\n\n")
+		if i < 0 {
+			break
+		}
+		text := s.partial[:i]
+		s.partial = s.partial[i+2:]
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		s.seq++
+		s.events = append(s.events, sseEvent{seq: s.seq, text: text, ping: pingEvent(text), at: time.Now()})
+		added = true
+	}
+	if added {
+		s.prune()
+		s.notify()
+	}
+	return len(p), nil
+}
+
+// prune drops expired events, and the oldest beyond maxBufferedEvents. The caller holds s.mu.
+func (s *sseStream) prune() {
+	cutoff := time.Now().Add(-s.ttl)
+	drop := max(len(s.events)-maxBufferedEvents, 0)
+	for drop < len(s.events) && s.events[drop].at.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		s.events = append(s.events[:0:0], s.events[drop:]...)
+	}
+}
+
+// notify wakes clients waiting for events. The caller holds s.mu.
+func (s *sseStream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// since returns the buffered events after seq, a channel closed when more
+// arrive, and whether the stream has ended
+func (s *sseStream) since(seq uint64) ([]sseEvent, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []sseEvent
+	for i, e := range s.events {
+		if e.seq > seq {
+			events = append(events, s.events[i:]...)
+			break
+		}
+	}
+	return events, s.changed, s.ended
+}
+
+// end marks the stream finished once the SSE server's session has closed
+func (s *sseStream) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+	s.notify()
+}
+
+// attach records a connected client
+func (s *sseStream) attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients++
+}
+
+// detach records a disconnected client. When no client remains the session
+// is closed after the TTL unless one reconnects first.
+func (s *sseStream) detach(remove func(*sseStream)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients--
+	if s.clients > 0 || s.ended {
+		return
+	}
+	s.detaches++
+	detach := s.detaches
+	logging.Debugf("SSE session %s disconnected; resumable for %s", s.id, s.ttl)
+	time.AfterFunc(s.ttl, func() {
+		s.mu.Lock()
+		expired := s.clients == 0 && s.detaches == detach
+		s.mu.Unlock()
+		if expired {
+			log.Printf("SSE session %s expired after %s without a client", s.id, s.ttl)
+			remove(s)
+			s.cancel()
+		}
+	})
+}
+
+// pingEvent reports whether an event is a keep-alive ping request
+func pingEvent(text string) bool {
+	if !strings.Contains(text, `"ping"`) {
+		return false
+	}
+	for _, line := range strings.Split(text, "\n") {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		var msg struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal([]byte(strings.TrimSpace(data)), &msg) == nil && msg.Method == "ping" {
+			return true
+		}
+	}
+	return false
+}
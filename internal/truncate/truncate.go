@@ -0,0 +1,38 @@
+// Package truncate formats the marker left wherever output is cut short to
+// fit a limit. Every tool and attachment uses the same form,
+//
+//	⟦TRUNCATED: <reason>, <what> omitted⟧ <hint>
+//
+// so the model can recognize truncation reliably and ask for the rest more
+// specifically. The system prompt explains the marker.
+package truncate
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Marker returns the truncation marker: why the output was cut, what was left
+// out (such as "57 matches" or "the rest of the diff"), and an optional hint
+// on how to get it
+func Marker(reason, omitted, hint string) string {
+	marker := fmt.Sprintf("⟦TRUNCATED: %s, %s omitted⟧", reason, omitted)
+	if hint != "" {
+		marker += " " + hint
+	}
+	return marker
+}
+
+// Bytes cuts s to at most limit bytes on a rune boundary and appends the
+// marker on its own line, reporting the bytes omitted. s is returned unchanged
+// when it fits.
+func Bytes(s string, limit int, reason, hint string) string {
+	if len(s) <= limit {
+		return s
+	}
+	cut := max(limit, 0)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "\n" + Marker(reason, fmt.Sprintf("%d bytes", len(s)-cut), hint)
+}
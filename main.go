@@ -2,59 +2,427 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/lox/deep-analysis-mcp/internal/client"
 	"github.com/lox/deep-analysis-mcp/internal/fileops"
+	"github.com/lox/deep-analysis-mcp/internal/logging"
 	"github.com/lox/deep-analysis-mcp/internal/server"
 	mcpserver "github.com/mark3labs/mcp-go/server"
 )
 
 func main() {
 	// Configure logging to stderr
-	log.SetOutput(os.Stderr)
 	log.SetPrefix("[deep-analysis-mcp] ")
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+	logging.SetOutput(os.Stderr)
 
 	// CLI flags
+	logLevel := flag.String("log-level", "info", "Minimum level logged: debug, info, warn or error")
 	transport := flag.String("transport", "stdio", "Transport type: stdio, sse, or http")
 	addr := flag.String("addr", ":8080", "Address to listen on for HTTP/SSE transports")
+	readTimeout := flag.Duration("read-timeout", 30*time.Second, "Maximum duration for reading an HTTP/SSE request, including headers")
+	writeTimeout := flag.Duration("write-timeout", 30*time.Minute, "Maximum duration for writing an HTTP/SSE response; keep long enough for streamed analyses (0 for none)")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "Maximum time an idle keep-alive HTTP/SSE connection is held open")
+	sseResumeTTL := flag.Duration("sse-resume-ttl", 5*time.Minute, "How long an SSE session and its buffered events survive a dropped connection, for the client to resume with Last-Event-ID (0 disables resumption)")
+	model := flag.String("model", "", "OpenAI model analyses run on (default $OPENAI_MODEL, or gpt-5-pro)")
+	reasoningBudget := flag.Int64("reasoning-budget", 0, "Default reasoning token budget per request (0 for unlimited)")
+	maxDuration := flag.Duration("max-analysis-duration", 0, "Maximum wall-clock time for a whole analysis before the model is asked to conclude (0 for unlimited)")
+	stateFile := flag.String("state-file", "", "JSON file conversation state is saved to and loaded from at startup, so conversations survive restarts (default: memory only)")
+	showUsage := flag.Bool("show-usage", false, "Append the tokens each analysis used, and its estimated cost when OPENAI_INPUT_PRICE and OPENAI_OUTPUT_PRICE are set, to its result")
+	maxIterations := flag.Int("max-iterations", 10, "Maximum rounds of tool calls in one analysis before it stops and returns the partial answer")
+	maxToolCalls := flag.Int("max-tool-calls", 0, "Maximum tool calls a single analysis may make before the model is asked to conclude (0 for unlimited)")
+	maxRepeatedCalls := flag.Int("max-repeated-tool-calls", 2, "Times the model may repeat an identical tool call, answered from the earlier result, before it is asked to conclude (0 disables deduplication)")
+	maxResultBytes := flag.Int("max-result-bytes", 0, "Maximum bytes of text returned to the client per tool result; longer answers are truncated with a marker, keeping footers and structured output (0 for unlimited)")
+	maxReadBytes := flag.Int64("max-read-bytes-per-request", 0, "Maximum bytes of file content tools may return to the model within one request (0 for unlimited)")
+	ignoreCase := flag.Bool("ignore-case", false, "Default to case-insensitive grep_files searches when the model doesn't specify")
+	maxConcurrentTools := flag.Int("max-concurrent-tools", 16, "Maximum tool executions running at once across all requests (0 for unlimited)")
+	conversationRate := flag.Float64("per-conversation-rate", 0, "Maximum analysis requests per minute for each client session, so none can monopolize a shared server (0 for unlimited)")
+	conversationBurst := flag.Int("per-conversation-burst", 3, "Requests a client session may make back to back before -per-conversation-rate applies")
+	conversationWait := flag.Duration("per-conversation-wait", 30*time.Second, "Longest a request over -per-conversation-rate waits for its turn before it is rejected (0 rejects immediately)")
+	fifoTimeout := flag.Duration("fifo-read-timeout", 2*time.Second, "Longest read_file waits for data from a named pipe before returning what arrived (0 refuses named pipes)")
+	maxGlobDirs := flag.Int("max-glob-dirs", 10000, "Maximum directories a ** glob pattern reads before returning partial matches with a note")
+	maxToolArgs := flag.Int("max-tool-args", 64*1024, "Maximum size in bytes of tool-call arguments accepted from the model")
+	projectArchive := flag.String("project-archive", "", "Path to a .tar.gz project snapshot to extract to a temporary directory and analyze instead of the working directory")
+	archiveLimit := flag.Int64("project-archive-limit", 1<<30, "Maximum total size in bytes of files extracted from -project-archive")
+	allowedRoots := flag.String("allowed-roots", "", "Comma-separated directories file operations are restricted to (default: unrestricted)")
+	readableExts := flag.String("readable-extensions", "", "Comma-separated file extensions read_file may open (default: any)")
+	forbiddenGreps := flag.String("forbidden-grep-patterns", "", "Comma-separated regular expressions; grep patterns matching any of them are refused, case-insensitively (e.g. AWS_SECRET,PRIVATE KEY)")
+	forbiddenExts := flag.String("forbidden-extensions", "", "Comma-separated file extensions or names read_file must never open (e.g. .env,.pem,.key)")
+	allowGit := flag.Bool("allow-git", false, "Allow git history lookups, such as grep_files with_blame, git_file_diff rev, api_diff and file_history")
+	allowExec := flag.Bool("allow-exec", false, "Expose the run_command tool (requires -allowed-commands)")
+	allowedCommands := flag.String("allowed-commands", "", "Comma-separated executables run_command may invoke (e.g. go,git,ls)")
+	requireConfirmation := flag.Bool("require-confirmation", false, "Hold every tool call that runs a command (run_command, test_coverage, build_profile, tools manifest calls, ...) until a human approves it with the confirm_action tool")
+	confirmationTTL := flag.Duration("confirmation-ttl", 15*time.Minute, "How long an action held by -require-confirmation waits for approval")
+	autoContext := flag.String("auto-context", "", "Comma-separated project files (e.g. README.md,CONTRIBUTING.md,AGENTS.md), relative to the first allowed root or working directory, attached as project context when an analysis starts a conversation")
+	compareModels := flag.String("compare-models", "", "Comma-separated models the compare_models argument may select (e.g. gpt-5-pro,o3); empty disables model comparison")
+	allowDocURLs := flag.Bool("allow-doc-urls", false, "Let the docs argument of deep-analysis fetch http(s) URLs, not just read files")
+	allowEnv := flag.Bool("allow-env", false, "Expose the list_env tool, which lists environment variable names with values redacted")
+	envValues := flag.String("env-values", "", "Comma-separated environment variables list_env shows the values of (OPENAI_API_KEY is never shown)")
+	verifyReferences := flag.Bool("verify-references", false, "Check path:line references in answers and flag any that don't exist")
+	emptyFallback := flag.Bool("empty-response-fallback", true, "When the model returns no text, return its refusal instead of an error")
+	emptyRetries := flag.Int("empty-response-retries", 1, "Times to re-issue a request when the API completes it with neither text nor tool calls, before failing")
+	maxAttached := flag.Int("max-attached-files", 20, "Maximum number of files a request may attach")
+	attachedPolicy := flag.String("attached-files-policy", "error", "What to do when too many files are attached: error or truncate")
+	contextOverflow := flag.String("context-overflow", client.OverflowError, "What to do when a prompt is estimated to overflow the context window: error, trim (drop oldest conversation context), drop (drop largest attachments) or mapreduce (analyze attachments in groups, then synthesize)")
+	flag.StringVar(contextOverflow, "large-input-strategy", client.OverflowError, "Alias for -context-overflow")
+	contextFraction := flag.Float64("context-fraction", 0.9, "Share of the model's context window a prompt may use before -context-overflow applies")
+	contextTokens := flag.Int64("context-tokens", 0, "Context window of the model in input tokens (0 looks it up by model name, assuming 128000 for unknown models)")
+	sharedConversations := flag.Bool("shared-conversations", true, "Share conversation state across transports; when false, conversation IDs are partitioned by transport")
+	bundleDir := flag.String("save-bundle-dir", "", "Directory to save a JSON bundle of each completed analysis to (settings, prompt, tool calls, usage and answer)")
+	relativePaths := flag.Bool("relative-paths", false, "Rewrite absolute paths in prompts, tool outputs, answers and logs relative to the first allowed root, and home directory paths to ~")
+	toolsManifest := flag.String("tools-manifest", "", "Path to a JSON manifest of extra command-backed tools to expose to the model")
+	promptVars := keyValueFlag{}
+	flag.Var(promptVars, "prompt-var", "System prompt variable as key=value (repeatable; e.g. project, language, standards)")
 	flag.Parse()
 
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		logging.Fatal(err)
+	}
+	logging.SetLevel(level)
+
+	// Output paths are relative to the launch directory, even after
+	// -project-archive or -relative-paths changes into the analyzed project
+	for _, path := range []*string{stateFile, bundleDir} {
+		if *path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*path)
+		if err != nil {
+			logging.Fatalf("Failed to resolve %s: %v", *path, err)
+		}
+		*path = abs
+	}
+
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is required")
+		logging.Fatal("OPENAI_API_KEY environment variable is required")
+	}
+
+	// An explicit -model wins over OPENAI_MODEL
+	modelName := *model
+	modelSet := false
+	flag.Visit(func(f *flag.Flag) { modelSet = modelSet || f.Name == "model" })
+	if !modelSet {
+		modelName = os.Getenv("OPENAI_MODEL")
+	}
+	if (modelSet || os.Getenv("OPENAI_MODEL") != "") && strings.TrimSpace(modelName) == "" {
+		logging.Fatal("-model and OPENAI_MODEL must not be blank")
+	}
+	modelName = strings.TrimSpace(modelName)
+
+	inputPrice, err := envPrice("OPENAI_INPUT_PRICE")
+	if err != nil {
+		logging.Fatal(err)
+	}
+	outputPrice, err := envPrice("OPENAI_OUTPUT_PRICE")
+	if err != nil {
+		logging.Fatal(err)
+	}
+
+	if *attachedPolicy != "error" && *attachedPolicy != "truncate" {
+		logging.Fatalf("Unknown -attached-files-policy: %s (must be error or truncate)", *attachedPolicy)
+	}
+	switch *contextOverflow {
+	case client.OverflowError, client.OverflowTrim, client.OverflowDrop, client.OverflowMapReduce:
+	default:
+		logging.Fatalf("Unknown -context-overflow: %s (must be error, trim, drop or mapreduce)", *contextOverflow)
+	}
+	if *contextFraction <= 0 || *contextFraction > 1 {
+		logging.Fatalf("-context-fraction must be between 0 and 1, got %v", *contextFraction)
+	}
+
+	var forbiddenGrepPatterns []*regexp.Regexp
+	for _, pattern := range splitList(*forbiddenGreps) {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			logging.Fatalf("Invalid -forbidden-grep-patterns entry %q: %v", pattern, err)
+		}
+		forbiddenGrepPatterns = append(forbiddenGrepPatterns, re)
 	}
 
-	f := fileops.New()
-	c := client.New(apiKey, f)
-	s := server.New(c)
+	if *allowExec && len(splitList(*allowedCommands)) == 0 {
+		logging.Fatal("-allow-exec requires -allowed-commands")
+	}
+
+	var externalTools []client.ExternalTool
+	if *toolsManifest != "" {
+		tools, err := client.LoadToolsManifest(*toolsManifest)
+		if err != nil {
+			logging.Fatal(err)
+		}
+		externalTools = tools
+		log.Printf("Loaded %d tools from %s", len(tools), *toolsManifest)
+	}
+
+	roots := splitList(*allowedRoots)
+	if *projectArchive != "" {
+		dir, cleanup, err := openProjectArchive(*projectArchive, *archiveLimit)
+		if err != nil {
+			logging.Fatal(err)
+		}
+		defer cleanup()
+		// Relative paths, including relative -allowed-roots, now resolve inside the snapshot
+		if err := os.Chdir(dir); err != nil {
+			cleanup()
+			logging.Fatalf("Failed to enter project snapshot: %v", err)
+		}
+		if len(roots) == 0 {
+			roots = []string{dir}
+		}
+	}
+
+	fileOpts := []fileops.Option{
+		fileops.WithAllowedRoots(roots...),
+		fileops.WithReadableExtensions(splitList(*readableExts)...),
+		fileops.WithForbiddenExtensions(splitList(*forbiddenExts)...),
+		fileops.WithForbiddenGrepPatterns(forbiddenGrepPatterns...),
+		fileops.WithGitAccess(*allowGit),
+		fileops.WithRelativePaths(*relativePaths),
+		fileops.WithMaxGlobDirs(*maxGlobDirs),
+		fileops.WithFIFOTimeout(*fifoTimeout),
+	}
+	if *allowExec {
+		fileOpts = append(fileOpts, fileops.WithAllowedCommands(splitList(*allowedCommands)...))
+	}
+
+	// Project context files are looked up in the base directory, resolved
+	// before -relative-paths changes the working directory
+	baseDir := "."
+	if len(roots) > 0 {
+		abs, err := filepath.Abs(roots[0])
+		if err != nil {
+			logging.Fatalf("Failed to resolve %s: %v", roots[0], err)
+		}
+		baseDir = abs
+	}
+
+	f := fileops.New(fileOpts...)
+	if *relativePaths {
+		// The model is given relative paths, so they must resolve against the base root
+		if len(roots) > 0 {
+			if err := os.Chdir(roots[0]); err != nil {
+				logging.Fatalf("Failed to enter %s for -relative-paths: %v", roots[0], err)
+			}
+		}
+		logging.SetOutput(relativePathWriter{w: os.Stderr, f: f})
+	}
+	var contextFiles []string
+	for _, name := range splitList(*autoContext) {
+		contextFiles = append(contextFiles, filepath.Join(baseDir, name))
+	}
+
+	// Conversations are kept in memory unless -state-file saves them
+	var conversationStore client.ConversationStore
+	if *stateFile != "" {
+		store, err := client.NewFileConversationStore(*stateFile)
+		if err != nil {
+			logging.Fatal(err)
+		}
+		conversationStore = store
+	}
+
+	c := client.New(apiKey, f,
+		client.WithModel(modelName),
+		client.WithReasoningBudget(*reasoningBudget),
+		client.WithIgnoreCaseDefault(*ignoreCase),
+		client.WithCommandExecution(*allowExec),
+		client.WithConfirmation(*requireConfirmation, *confirmationTTL),
+		client.WithVulnCheck(*allowExec && slices.Contains(splitList(*allowedCommands), "govulncheck")),
+		client.WithTestCoverage(*allowExec && slices.Contains(splitList(*allowedCommands), "go")),
+		client.WithDocExamples(*allowExec && slices.Contains(splitList(*allowedCommands), "go")),
+		client.WithBuildProfile(*allowExec && slices.Contains(splitList(*allowedCommands), "go")),
+		client.WithEnvListing(*allowEnv, splitList(*envValues)),
+		client.WithDocURLs(*allowDocURLs),
+		client.WithCompareModels(splitList(*compareModels)),
+		client.WithAutoContext(contextFiles),
+		client.WithGitHistory(*allowGit),
+		client.WithMaxToolArgsSize(*maxToolArgs),
+		client.WithMaxConcurrentTools(*maxConcurrentTools),
+		client.WithConversationRate(*conversationRate, *conversationBurst, *conversationWait),
+		client.WithReferenceVerification(*verifyReferences),
+		client.WithEmptyResponseFallback(*emptyFallback),
+		client.WithEmptyResponseRetries(*emptyRetries),
+		client.WithMaxAttachedFiles(*maxAttached, *attachedPolicy == "truncate"),
+		client.WithMaxAnalysisDuration(*maxDuration),
+		client.WithShowUsage(*showUsage),
+		client.WithTokenPrices(inputPrice, outputPrice),
+		client.WithMaxIterations(*maxIterations),
+		client.WithMaxToolCalls(*maxToolCalls),
+		client.WithMaxRepeatedToolCalls(*maxRepeatedCalls),
+		client.WithMaxReadBytes(*maxReadBytes),
+		client.WithContextOverflow(*contextOverflow, *contextFraction),
+		client.WithContextTokens(*contextTokens),
+		client.WithBundleDir(*bundleDir),
+		client.WithSharedConversations(*sharedConversations),
+		client.WithConversationStore(conversationStore),
+		client.WithExternalTools(externalTools),
+		client.WithPromptVars(promptVars),
+	)
+	log.Printf("Using model %s", c.Model())
+	s := server.New(c, *transport, *maxResultBytes)
 
 	switch *transport {
 	case "stdio":
 		log.Println("Starting MCP server with stdio transport")
 		if err := mcpserver.ServeStdio(s); err != nil {
-			log.Fatal(err)
+			logging.Fatal(err)
 		}
 
 	case "sse":
-		log.Printf("Starting MCP server with SSE transport on %s", *addr)
+		log.Printf("Starting MCP server with SSE transport on %s (read=%s write=%s idle=%s)", *addr, *readTimeout, *writeTimeout, *idleTimeout)
+		srv := newHTTPServer(*addr, *readTimeout, *writeTimeout, *idleTimeout)
 		sseServer := mcpserver.NewSSEServer(s,
 			mcpserver.WithBasePath("/sse"),
+			mcpserver.WithHTTPServer(srv),
+			mcpserver.WithKeepAlive(true),
 		)
+		srv.Handler = sseServer
+		if *sseResumeTTL > 0 {
+			srv.Handler = server.NewResumableSSE(sseServer, *sseResumeTTL)
+		}
 		if err := sseServer.Start(*addr); err != nil {
-			log.Fatal(err)
+			logging.Fatal(err)
 		}
 
 	case "http":
-		log.Printf("Starting MCP server with HTTP streaming transport on %s", *addr)
-		httpServer := mcpserver.NewStreamableHTTPServer(s)
+		log.Printf("Starting MCP server with HTTP streaming transport on %s (read=%s write=%s idle=%s)", *addr, *readTimeout, *writeTimeout, *idleTimeout)
+		srv := newHTTPServer(*addr, *readTimeout, *writeTimeout, *idleTimeout)
+		httpServer := mcpserver.NewStreamableHTTPServer(s,
+			mcpserver.WithStreamableHTTPServer(srv),
+		)
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", httpServer)
+		srv.Handler = mux
 		if err := httpServer.Start(*addr); err != nil {
-			log.Fatal(err)
+			logging.Fatal(err)
 		}
 
 	default:
-		log.Fatalf("Unknown transport: %s (must be stdio, sse, or http)", *transport)
+		logging.Fatalf("Unknown transport: %s (must be stdio, sse, or http)", *transport)
+	}
+}
+
+// openProjectArchive extracts a project snapshot into a new temporary directory.
+// The returned cleanup removes it, and also runs if the process is interrupted.
+func openProjectArchive(archive string, limit int64) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "deep-analysis-snapshot-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			if err := os.RemoveAll(dir); err != nil {
+				logging.Warnf("Failed to remove project snapshot %s: %v", dir, err)
+			}
+		})
+	}
+
+	if err := fileops.ExtractArchive(archive, dir, limit); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to extract -project-archive %s: %w", archive, err)
+	}
+	log.Printf("Extracted project archive %s to %s", archive, dir)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		cleanup()
+		log.Printf("Received %s, removed project snapshot", sig)
+		os.Exit(1)
+	}()
+
+	return dir, cleanup, nil
+}
+
+// newHTTPServer creates the http.Server used by the HTTP and SSE transports
+func newHTTPServer(addr string, readTimeout, writeTimeout, idleTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// relativePathWriter rewrites absolute paths in log output for -relative-paths
+type relativePathWriter struct {
+	w io.Writer
+	f *fileops.Handler
+}
+
+func (p relativePathWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, p.f.RelativizePaths(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envPrice reads a price in US dollars per million tokens from an
+// environment variable, returning 0 when it is unset
+func envPrice(name string) (float64, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return 0, nil
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || price < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative price in US dollars per million tokens, got %q", name, value)
+	}
+	return price, nil
+}
+
+// keyValueFlag collects repeatable key=value flags
+type keyValueFlag map[string]string
+
+var flagKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	key = strings.TrimSpace(key)
+	if !flagKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid key %q: use letters, digits, and underscores", key)
 	}
+	f[key] = val
+	return nil
 }